@@ -0,0 +1,94 @@
+package attestation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/veraison/go-cose"
+)
+
+// DefaultAlgorithms are the signature algorithms accepted when
+// VerifyOptions.Algorithms is empty. The NSM signs with ECDSA P-384 and SHA-384.
+var DefaultAlgorithms = []cose.Algorithm{cose.AlgorithmES384}
+
+// ErrMissingAlgorithm is returned when the protected header of the COSE message
+// has no valid alg parameter.
+var ErrMissingAlgorithm = errors.New("COSE protected header has no valid algorithm")
+
+// AlgorithmNotAllowedError is returned when the algorithm of the protected
+// header is not in the allow-list.
+type AlgorithmNotAllowedError struct {
+	Algorithm cose.Algorithm
+	Allowed   []cose.Algorithm
+}
+
+func (e *AlgorithmNotAllowedError) Error() string {
+	return fmt.Sprintf("COSE algorithm %v is not allowed, expected one of %v", e.Algorithm, e.Allowed)
+}
+
+// AlgorithmKeyMismatchError is returned when the algorithm of the protected
+// header cannot be used with the public key of the attestation certificate.
+type AlgorithmKeyMismatchError struct {
+	Algorithm cose.Algorithm
+	KeyType   string // e.g. "ECDSA P-256", "RSA" or "Ed25519"
+}
+
+func (e *AlgorithmKeyMismatchError) Error() string {
+	return fmt.Sprintf("COSE algorithm %v does not match the %s key of the attestation certificate", e.Algorithm, e.KeyType)
+}
+
+// signatureAlgorithm reads the algorithm from the protected header, checks it
+// against allowed and checks that it can be used with publicKey.
+func signatureAlgorithm(headers cose.ProtectedHeader, allowed []cose.Algorithm, publicKey crypto.PublicKey) (cose.Algorithm, error) {
+	if len(allowed) == 0 {
+		allowed = DefaultAlgorithms
+	}
+
+	alg, err := headers.Algorithm()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrMissingAlgorithm, err)
+	}
+	if !slices.Contains(allowed, alg) {
+		return 0, &AlgorithmNotAllowedError{Algorithm: alg, Allowed: allowed}
+	}
+
+	keyType, ok := algorithmMatchesKey(alg, publicKey)
+	if !ok {
+		return 0, &AlgorithmKeyMismatchError{Algorithm: alg, KeyType: keyType}
+	}
+	return alg, nil
+}
+
+// algorithmMatchesKey reports whether alg can be used with publicKey, and a
+// description of the key type.
+func algorithmMatchesKey(alg cose.Algorithm, publicKey crypto.PublicKey) (string, bool) {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		keyType := "ECDSA " + key.Curve.Params().Name
+		switch alg {
+		case cose.AlgorithmES256:
+			return keyType, key.Curve == elliptic.P256()
+		case cose.AlgorithmES384:
+			return keyType, key.Curve == elliptic.P384()
+		case cose.AlgorithmES512:
+			return keyType, key.Curve == elliptic.P521()
+		}
+		return keyType, false
+	case *rsa.PublicKey:
+		switch alg {
+		case cose.AlgorithmPS256, cose.AlgorithmPS384, cose.AlgorithmPS512:
+			return "RSA", true
+		}
+		return "RSA", false
+	case ed25519.PublicKey:
+		return "Ed25519", alg == cose.AlgorithmEdDSA
+	default:
+		return fmt.Sprintf("%T", publicKey), false
+	}
+}
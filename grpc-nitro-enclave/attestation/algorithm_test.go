@@ -0,0 +1,79 @@
+package attestation_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/veraison/go-cose"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+)
+
+func TestVerifyAlgorithm(t *testing.T) {
+	nsm := newNSM(t)
+
+	sign := func(t *testing.T, alg cose.Algorithm) []byte {
+		t.Helper()
+		doc, err := nsm.NewDocument(nil, nil, nil)
+		if err != nil {
+			t.Fatalf("NewDocument: %v", err)
+		}
+		doc.Algorithm = alg
+		raw, err := doc.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		return raw
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		opts := attestation.VerifyOptions{Roots: nsm.CA.Roots(), Algorithms: []cose.Algorithm{cose.AlgorithmES256, cose.AlgorithmES384}}
+		if _, err := attestation.Verify(sign(t, cose.AlgorithmES384), opts); err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		_, err := attestation.Verify(sign(t, cose.AlgorithmES512), attestation.VerifyOptions{Roots: nsm.CA.Roots()})
+		var notAllowed *attestation.AlgorithmNotAllowedError
+		if !errors.As(err, &notAllowed) {
+			t.Fatalf("Verify error = %v, want AlgorithmNotAllowedError", err)
+		}
+		if notAllowed.Algorithm != cose.AlgorithmES512 {
+			t.Errorf("Algorithm = %v, want %v", notAllowed.Algorithm, cose.AlgorithmES512)
+		}
+	})
+
+	// The test CA issues P-384 keys, which cannot verify ES256 or PS384 signatures
+	// even when those algorithms are allowed.
+	for _, alg := range []cose.Algorithm{cose.AlgorithmES256, cose.AlgorithmPS384, cose.AlgorithmEdDSA} {
+		t.Run("key mismatch "+alg.String(), func(t *testing.T) {
+			opts := attestation.VerifyOptions{Roots: nsm.CA.Roots(), Algorithms: []cose.Algorithm{alg}}
+			_, err := attestation.Verify(sign(t, alg), opts)
+			var mismatch *attestation.AlgorithmKeyMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("Verify error = %v, want AlgorithmKeyMismatchError", err)
+			}
+			if mismatch.KeyType != "ECDSA P-384" {
+				t.Errorf("KeyType = %q, want %q", mismatch.KeyType, "ECDSA P-384")
+			}
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		var msg cose.UntaggedSign1Message
+		if err := msg.UnmarshalCBOR(sign(t, cose.AlgorithmES384)); err != nil {
+			t.Fatalf("UnmarshalCBOR: %v", err)
+		}
+		delete(msg.Headers.Protected, cose.HeaderLabelAlgorithm)
+		msg.Headers.RawProtected = nil
+		raw, err := msg.MarshalCBOR()
+		if err != nil {
+			t.Fatalf("MarshalCBOR: %v", err)
+		}
+		_, err = attestation.Verify(raw, attestation.VerifyOptions{Roots: nsm.CA.Roots()})
+		if !errors.Is(err, attestation.ErrMissingAlgorithm) {
+			t.Fatalf("Verify error = %v, want ErrMissingAlgorithm", err)
+		}
+	})
+}
@@ -0,0 +1,292 @@
+// Package attestation parses and verifies AWS Nitro Enclaves attestation documents.
+//
+// An attestation document is a COSE_Sign1 structure whose payload is a CBOR map
+// described by AttestationDocument. Verify checks the syntax of the payload, the
+// certificate chain up to a trusted root, the COSE signature and optionally the
+// document age, its nonce and user data and the enclave measurements against a
+// PCRPolicy, and returns the parsed document. VerifyReport performs the same
+// checks and describes each of them in a VerificationReport.
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/tracing"
+)
+
+// AttestationDocument represents the structure of the attestation payload.
+type AttestationDocument struct {
+	ModuleID    string         `cbor:"module_id"`
+	Timestamp   uint64         `cbor:"timestamp"`
+	Digest      string         `cbor:"digest"`
+	PCRs        map[int][]byte `cbor:"pcrs"`
+	Certificate []byte         `cbor:"certificate"`
+	CABundle    [][]byte       `cbor:"cabundle"`
+	PublicKey   []byte         `cbor:"public_key,omitempty"`
+	UserData    []byte         `cbor:"user_data,omitempty"`
+	Nonce       []byte         `cbor:"nonce,omitempty"`
+}
+
+// VerifyOptions configures Verify.
+type VerifyOptions struct {
+	// Roots is the set of trusted root certificates. If nil, the embedded
+	// AWS Nitro Enclaves root certificate is used.
+	Roots *x509.CertPool
+
+	// CurrentTime is the time at which the certificate chain is validated and
+	// against which the document age is measured. If zero, the current time is used.
+	CurrentTime time.Time
+
+	// MaxAge, if positive, is the maximum age of the document timestamp
+	// relative to CurrentTime. Documents timestamped in the future by more than
+	// ClockSkew are rejected too.
+	MaxAge time.Duration
+
+	// ClockSkew is the tolerated difference between the clocks of the enclave
+	// and the verifier. It only applies when MaxAge is set.
+	ClockSkew time.Duration
+
+	// AuditMode validates the certificate chain at the document timestamp
+	// instead of CurrentTime, so that historical documents whose certificates
+	// have expired since can be verified. Leave MaxAge zero to accept
+	// documents of any age.
+	AuditMode bool
+
+	// Nonce, if non-nil, must be equal to the nonce field of the document.
+	Nonce []byte
+
+	// UserData, if non-nil, must be equal to the user_data field of the document.
+	UserData []byte
+
+	// AllowOnDemand accepts documents handed out by AttestationService, whose
+	// user_data starts with OnDemandPrefix. They are rejected by default,
+	// since their fields are chosen by the caller.
+	AllowOnDemand bool
+
+	// Policy, if non-nil, lists the acceptable PCR values of the enclave.
+	Policy *PCRPolicy
+
+	// Algorithms lists the COSE signature algorithms accepted in the protected
+	// header. If empty, DefaultAlgorithms is used.
+	Algorithms []cose.Algorithm
+}
+
+// Verify parses the COSE_Sign1 encoded attestation document doc, validates its
+// fields, its certificate chain and its signature, and returns the parsed payload.
+// On failure, the returned error is an *Error matching one of the Err* sentinels.
+func Verify(doc []byte, opts VerifyOptions) (*AttestationDocument, error) {
+	return VerifyContext(context.Background(), doc, opts)
+}
+
+// VerifyContext is like Verify, and traces the verification as a child of the
+// span of ctx, if any.
+func VerifyContext(ctx context.Context, doc []byte, opts VerifyOptions) (*AttestationDocument, error) {
+	report := VerifyReportContext(ctx, doc, opts)
+	if !report.OK() {
+		return nil, report.Err
+	}
+	return report.Document, nil
+}
+
+// VerifyReport performs the same checks as Verify and returns a report of every
+// check. Checks after the first failure are reported as skipped.
+func VerifyReport(doc []byte, opts VerifyOptions) *VerificationReport {
+	return VerifyReportContext(context.Background(), doc, opts)
+}
+
+// VerifyReportContext is like VerifyReport, and traces the verification as a
+// child of the span of ctx, if any: an "attestation.verify" span with children
+// for loading the roots, building the certificate chain and verifying the COSE
+// signature.
+func VerifyReportContext(ctx context.Context, doc []byte, opts VerifyOptions) *VerificationReport {
+	ctx, span := tracing.Start(ctx, "attestation.verify", trace.WithAttributes(attribute.Int("attestation.document_size", len(doc))))
+	report := verifyReport(ctx, doc, opts)
+	if report.Err != nil {
+		var e *Error
+		if errors.As(report.Err, &e) {
+			span.SetAttributes(attribute.String("attestation.failed_check", string(e.Check)))
+		}
+		tracing.RecordError(span, report.Err)
+	}
+	span.End()
+	return report
+}
+
+func verifyReport(ctx context.Context, doc []byte, opts VerifyOptions) *VerificationReport {
+	report := &VerificationReport{}
+
+	roots := opts.Roots
+	if roots == nil {
+		_, span := tracing.Start(ctx, "attestation.load_roots")
+		roots = AWSNitroRoots()
+		span.End()
+	}
+
+	// Parse the COSE message and unmarshal its payload into AttestationDocument
+	msg, attDoc, err := ParseMessage(doc)
+	if err != nil {
+		e := err.(*Error)
+		if e.Check == CheckPayload {
+			report.pass(CheckCOSE, "")
+		}
+		return report.fail(e.Check, e.Kind, e.Err)
+	}
+	report.pass(CheckCOSE, "")
+	report.Document = attDoc
+	report.pass(CheckPayload, "")
+
+	// Syntactic validation
+	if err := validateFields(attDoc); err != nil {
+		return report.fail(CheckFields, ErrMalformed, fmt.Errorf("syntactic validation failed: %w", err))
+	}
+	report.pass(CheckFields, "")
+
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	// Parse and validate the certificate chain
+	chainTime := now
+	if opts.AuditMode {
+		chainTime = attDoc.Time()
+	}
+	_, span := tracing.Start(ctx, "attestation.chain", trace.WithAttributes(attribute.Int("attestation.cabundle_size", len(attDoc.CABundle))))
+	chain, err := buildCertificateChain(attDoc.Certificate, attDoc.CABundle, roots, chainTime)
+	tracing.RecordError(span, err)
+	span.End()
+	if err != nil {
+		return report.fail(CheckChain, ErrChain, fmt.Errorf("certificate chain validation failed: %w", err))
+	}
+	report.setChain(chain)
+	report.pass(CheckChain, "validated at "+chainTime.UTC().Format(time.RFC3339))
+
+	// Verify the COSE signature with the public key of the attestation certificate,
+	// using the algorithm named in the protected header
+	alg, err := signatureAlgorithm(msg.Headers.Protected, opts.Algorithms, chain[0].PublicKey)
+	if err != nil {
+		return report.fail(CheckAlgorithm, ErrAlgorithm, err)
+	}
+	report.Algorithm = alg
+	report.pass(CheckAlgorithm, alg.String())
+
+	_, span = tracing.Start(ctx, "attestation.cose_verify", trace.WithAttributes(attribute.String("cose.algorithm", alg.String())))
+	err = verifySignature(msg, alg, chain[0].PublicKey)
+	tracing.RecordError(span, err)
+	span.End()
+	if err != nil {
+		return report.fail(CheckSignature, ErrSignature, err)
+	}
+	report.pass(CheckSignature, "")
+
+	// Check the document age
+	if opts.MaxAge > 0 {
+		if err := checkFreshness(attDoc.Time(), now, opts.MaxAge, opts.ClockSkew); err != nil {
+			return report.fail(CheckFreshness, ErrStale, err)
+		}
+		report.pass(CheckFreshness, "age "+now.Sub(attDoc.Time()).String())
+	} else {
+		report.skip(CheckFreshness, "no maximum age configured")
+	}
+
+	// Check that the document is bound to the expected request
+	if opts.Nonce != nil {
+		if !bytes.Equal(attDoc.Nonce, opts.Nonce) {
+			return report.fail(CheckNonce, ErrNonceMismatch, errors.New("nonce in attestation document does not match the expected nonce"))
+		}
+		report.pass(CheckNonce, "")
+	} else {
+		report.skip(CheckNonce, "no nonce expected")
+	}
+	if !opts.AllowOnDemand && attDoc.OnDemand() {
+		return report.fail(CheckUserData, ErrOnDemand, errors.New("attestation document was issued on demand and binds caller-chosen fields"))
+	}
+	if opts.UserData != nil {
+		if !bytes.Equal(attDoc.UserData, opts.UserData) {
+			return report.fail(CheckUserData, ErrUserDataMismatch, errors.New("user_data in attestation document does not match the expected user data"))
+		}
+		report.pass(CheckUserData, "")
+	} else {
+		report.skip(CheckUserData, "no user data expected")
+	}
+
+	// Check the enclave measurements
+	if opts.Policy != nil {
+		if err := opts.Policy.Check(attDoc.PCRs); err != nil {
+			return report.fail(CheckPCRs, ErrPCRMismatch, fmt.Errorf("PCR policy check failed: %w", err))
+		}
+		report.pass(CheckPCRs, "")
+	} else {
+		report.skip(CheckPCRs, "no PCR policy configured")
+	}
+
+	return report
+}
+
+// verifySignature verifies the COSE signature of msg with publicKey.
+func verifySignature(msg *cose.UntaggedSign1Message, alg cose.Algorithm, publicKey crypto.PublicKey) error {
+	verifier, err := cose.NewVerifier(alg, publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to create COSE verifier: %w", err)
+	}
+	if err := msg.Verify(nil, verifier); err != nil {
+		return fmt.Errorf("COSE signature verification failed: %w", err)
+	}
+	return nil
+}
+
+// Parse decodes the payload of the attestation document doc without verifying
+// its certificate chain or signature. Only use it for documents from a trusted
+// source, such as an enclave reading its own PCRs from the local NSM.
+func Parse(doc []byte) (*AttestationDocument, error) {
+	_, attDoc, err := ParseMessage(doc)
+	return attDoc, err
+}
+
+// ParseMessage is like Parse, and also returns the COSE_Sign1 message, e.g. to
+// inspect its headers and signature. It decodes documents exactly as Verify
+// does; on failure, the returned error is an *Error for CheckCOSE or CheckPayload.
+func ParseMessage(doc []byte) (*cose.UntaggedSign1Message, *AttestationDocument, error) {
+	var msg cose.UntaggedSign1Message
+	if err := msg.UnmarshalCBOR(doc); err != nil {
+		return nil, nil, &Error{Check: CheckCOSE, Kind: ErrMalformed, Err: fmt.Errorf("failed to unmarshal COSE message: %w", err)}
+	}
+	if len(msg.Payload) == 0 {
+		return nil, nil, &Error{Check: CheckPayload, Kind: ErrMalformed, Err: errors.New("payload is empty in the attestation document")}
+	}
+	var attDoc AttestationDocument
+	if err := cbor.Unmarshal(msg.Payload, &attDoc); err != nil {
+		return nil, nil, &Error{Check: CheckPayload, Kind: ErrMalformed, Err: fmt.Errorf("failed to unmarshal payload as AttestationDocument: %w", err)}
+	}
+	return &msg, &attDoc, nil
+}
+
+// DebugMode reports whether the document comes from an enclave started in
+// debug mode, for which the NSM reports all-zero PCRs: the image, kernel and
+// application measurements PCR0, PCR1 and PCR2 are checked. The local
+// development attester reports all-zero PCRs too.
+func (d *AttestationDocument) DebugMode() bool {
+	for i := 0; i <= 2; i++ {
+		pcr := d.PCRs[i]
+		if len(pcr) == 0 {
+			return false
+		}
+		for _, b := range pcr {
+			if b != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
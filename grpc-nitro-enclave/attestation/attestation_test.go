@@ -0,0 +1,369 @@
+package attestation_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veraison/go-cose"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+)
+
+func newNSM(t testing.TB) *attestertest.NSM {
+	t.Helper()
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	return nsm
+}
+
+func TestVerify(t *testing.T) {
+	nsm := newNSM(t)
+	nonce := []byte("nonce")
+	userData := []byte("user data")
+	publicKey := []byte("public key")
+
+	raw, err := nsm.Attest(nonce, userData, publicKey)
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+
+	doc, err := attestation.Verify(raw, attestation.VerifyOptions{
+		Roots:    nsm.CA.Roots(),
+		Nonce:    nonce,
+		UserData: userData,
+		Policy:   &attestation.PCRPolicy{Allowed: []attestation.Measurements{{0: nsm.PCRs[0], 8: nsm.PCRs[8]}}},
+	})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if doc.ModuleID != attestertest.ModuleID {
+		t.Errorf("ModuleID = %q, want %q", doc.ModuleID, attestertest.ModuleID)
+	}
+	if !bytes.Equal(doc.PublicKey, publicKey) {
+		t.Errorf("PublicKey = %q, want %q", doc.PublicKey, publicKey)
+	}
+	if len(doc.PCRs) != len(nsm.PCRs) {
+		t.Errorf("got %d PCRs, want %d", len(doc.PCRs), len(nsm.PCRs))
+	}
+}
+
+// TestVerifyReissuedRoot checks that a CA bundle is accepted when headed by a
+// copy of the trusted root re-issued with the same subject and key.
+func TestVerifyReissuedRoot(t *testing.T) {
+	nsm := newNSM(t)
+	raw, err := nsm.Attest([]byte("nonce"), nil, nil)
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(selfSign(t, nsm.CA.Root, nsm.CA.RootKey))
+
+	if _, err := attestation.Verify(raw, attestation.VerifyOptions{Roots: roots}); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	nsm := newNSM(t)
+	otherCA, err := attestertest.NewCA()
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(*attestertest.Document)
+		opts    func(*attestation.VerifyOptions)
+		wantErr string
+	}{
+		{
+			name:    "nonce mismatch",
+			opts:    func(o *attestation.VerifyOptions) { o.Nonce = []byte("other nonce") },
+			wantErr: "nonce",
+		},
+		{
+			name:    "user data mismatch",
+			opts:    func(o *attestation.VerifyOptions) { o.UserData = []byte("other user data") },
+			wantErr: "user_data",
+		},
+		{
+			name:    "untrusted root",
+			opts:    func(o *attestation.VerifyOptions) { o.Roots = otherCA.Roots() },
+			wantErr: "certificate chain",
+		},
+		{
+			name:    "AWS root",
+			opts:    func(o *attestation.VerifyOptions) { o.Roots = nil },
+			wantErr: "certificate chain",
+		},
+		{
+			name:    "expired leaf",
+			opts:    func(o *attestation.VerifyOptions) { o.CurrentTime = time.Now().Add(4 * time.Hour) },
+			wantErr: "certificate chain",
+		},
+		{
+			name: "PCR mismatch",
+			opts: func(o *attestation.VerifyOptions) {
+				o.Policy = &attestation.PCRPolicy{Allowed: []attestation.Measurements{{2: bytes.Repeat([]byte{0xff}, 48)}}}
+			},
+			wantErr: "PCR2 mismatch",
+		},
+		{
+			name: "signed by another key",
+			tamper: func(d *attestertest.Document) {
+				_, key, err := otherCA.IssueLeaf(time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+				if err != nil {
+					t.Fatalf("IssueLeaf: %v", err)
+				}
+				d.Key = key
+			},
+			wantErr: "signature",
+		},
+		{
+			name:    "missing module_id",
+			tamper:  func(d *attestertest.Document) { d.ModuleID = "" },
+			wantErr: "module_id",
+		},
+		{
+			name:    "ES256 algorithm header",
+			tamper:  func(d *attestertest.Document) { d.Algorithm = cose.AlgorithmES256 },
+			wantErr: "not allowed",
+		},
+		{
+			name:    "ES512 algorithm header",
+			tamper:  func(d *attestertest.Document) { d.Algorithm = cose.AlgorithmES512 },
+			wantErr: "not allowed",
+		},
+		{
+			name:    "PS384 algorithm header",
+			tamper:  func(d *attestertest.Document) { d.Algorithm = cose.AlgorithmPS384 },
+			wantErr: "not allowed",
+		},
+		{
+			name:    "EdDSA algorithm header",
+			tamper:  func(d *attestertest.Document) { d.Algorithm = cose.AlgorithmEdDSA },
+			wantErr: "not allowed",
+		},
+		{
+			name:    "tagged COSE_Sign1",
+			tamper:  func(d *attestertest.Document) { d.Tagged = true },
+			wantErr: "COSE",
+		},
+		{
+			name: "expired leaf certificate",
+			tamper: func(d *attestertest.Document) {
+				reissue(t, d, nsm.CA, time.Now().Add(-4*time.Hour), time.Now().Add(-time.Hour))
+			},
+			wantErr: "certificate chain",
+		},
+		{
+			name: "leaf certificate not yet valid",
+			tamper: func(d *attestertest.Document) {
+				reissue(t, d, nsm.CA, time.Now().Add(time.Hour), time.Now().Add(4*time.Hour))
+			},
+			wantErr: "certificate chain",
+		},
+		{
+			name: "expired intermediate certificate",
+			tamper: func(d *attestertest.Document) {
+				ca := *nsm.CA
+				ca.Intermediate = expiredIntermediate(t, nsm.CA)
+				reissue(t, d, &ca, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+				d.CABundle = ca.CABundle()
+			},
+			wantErr: "certificate chain",
+		},
+		{
+			name: "swapped cabundle order",
+			tamper: func(d *attestertest.Document) {
+				d.CABundle[0], d.CABundle[1] = d.CABundle[1], d.CABundle[0]
+			},
+			wantErr: "cabundle[0] is not the trusted root",
+		},
+		{
+			name: "cabundle headed by a root with another key",
+			tamper: func(d *attestertest.Document) {
+				d.CABundle[0] = selfSign(t, nsm.CA.Root, otherCA.RootKey).Raw
+			},
+			wantErr: "cabundle[0] is not the trusted root",
+		},
+		{
+			name:    "cabundle without intermediate",
+			tamper:  func(d *attestertest.Document) { d.CABundle = d.CABundle[:1] },
+			wantErr: "certificate chain",
+		},
+		{
+			name:    "cabundle without root",
+			tamper:  func(d *attestertest.Document) { d.CABundle = d.CABundle[1:] },
+			wantErr: "cabundle[0] is not the trusted root",
+		},
+		{
+			name: "cabundle with foreign intermediate appended",
+			tamper: func(d *attestertest.Document) {
+				d.CABundle = append(d.CABundle, otherCA.Intermediate.Raw)
+			},
+			wantErr: "not issued by cabundle[1]",
+		},
+		{
+			name:    "garbage cabundle entry",
+			tamper:  func(d *attestertest.Document) { d.CABundle[1] = []byte("not a certificate") },
+			wantErr: "failed to parse cabundle[1]",
+		},
+		{
+			name:    "garbage certificate",
+			tamper:  func(d *attestertest.Document) { d.Certificate = []byte("not a certificate") },
+			wantErr: "failed to parse target certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := nsm.NewDocument([]byte("nonce"), []byte("user data"), nil)
+			if err != nil {
+				t.Fatalf("NewDocument: %v", err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(doc)
+			}
+			raw, err := doc.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			opts := attestation.VerifyOptions{Roots: nsm.CA.Roots()}
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+			_, err = attestation.Verify(raw, opts)
+			if err == nil {
+				t.Fatal("Verify succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// reissue replaces the signing certificate and key of d with a leaf of ca
+// valid from notBefore to notAfter.
+func reissue(t *testing.T, d *attestertest.Document, ca *attestertest.CA, notBefore, notAfter time.Time) {
+	t.Helper()
+	leaf, key, err := ca.IssueLeaf(notBefore, notAfter)
+	if err != nil {
+		t.Fatalf("IssueLeaf: %v", err)
+	}
+	d.Certificate, d.Key = leaf.Raw, key
+}
+
+// selfSign returns a copy of root, with a new serial number, self-signed with
+// key in place of the key of root.
+func selfSign(t *testing.T, root *x509.Certificate, key *ecdsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+	template := *root
+	template.SerialNumber = new(big.Int).Add(root.SerialNumber, big.NewInt(1))
+	template.PublicKey = &key.PublicKey
+	der, err := x509.CreateCertificate(nil, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert
+}
+
+// expiredIntermediate returns a copy of the intermediate of ca, with the same
+// key, that expired an hour ago.
+func expiredIntermediate(t *testing.T, ca *attestertest.CA) *x509.Certificate {
+	t.Helper()
+	template := *ca.Intermediate
+	template.NotBefore = time.Now().Add(-48 * time.Hour)
+	template.NotAfter = time.Now().Add(-time.Hour)
+	der, err := x509.CreateCertificate(nil, &template, ca.Root, &ca.IntermediateKey.PublicKey, ca.RootKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert
+}
+
+// TestVerifyMalformed checks that malformed COSE envelopes are rejected.
+func TestVerifyMalformed(t *testing.T) {
+	nsm := newNSM(t)
+	raw, err := nsm.Attest(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+	doc, err := nsm.NewDocument(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewDocument: %v", err)
+	}
+	notCBOR, err := attestertest.Sign([]byte("not CBOR"), cose.AlgorithmES384, doc.Key, false)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	emptyPayload, err := attestertest.Sign([]byte{}, cose.AlgorithmES384, doc.Key, false)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"one byte", raw[:1]},
+		{"truncated header", raw[:8]},
+		{"truncated payload", raw[:len(raw)/2]},
+		{"missing last byte", raw[:len(raw)-1]},
+		{"trailing byte", append(append([]byte(nil), raw...), 0x00)},
+		{"COSE_Mac0 tag", append([]byte{0xd1}, raw...)},
+		{"COSE_Sign tag", append([]byte{0xd8, 0x62}, raw...)},
+		{"CBOR map", []byte{0xa0}},
+		{"array of three", []byte{0x83, 0x40, 0xa0, 0x40}},
+		{"payload is not CBOR", notCBOR},
+		{"empty payload", emptyPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := attestation.Verify(tt.data, attestation.VerifyOptions{Roots: nsm.CA.Roots()}); err == nil {
+				t.Fatal("Verify succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestDebugMode(t *testing.T) {
+	tests := []struct {
+		name string
+		pcrs map[int][]byte
+		want bool
+	}{
+		{"debug", map[int][]byte{0: make([]byte, 48), 1: make([]byte, 48), 2: make([]byte, 48), 3: make([]byte, 48)}, true},
+		{"production", attestertest.TestPCRs(), false},
+		{"measured image", map[int][]byte{0: bytes.Repeat([]byte{0xab}, 48)}, false},
+		{"missing PCRs", map[int][]byte{0: make([]byte, 48)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &attestation.AttestationDocument{PCRs: tt.pcrs}
+			if got := doc.DebugMode(); got != tt.want {
+				t.Errorf("DebugMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
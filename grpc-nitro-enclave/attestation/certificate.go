@@ -0,0 +1,107 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ParseCertificate parses a PEM or DER encoded certificate.
+func ParseCertificate(certBytes []byte) (*x509.Certificate, error) {
+	// Attempt to parse as PEM
+	block, _ := pem.Decode(certBytes)
+	if block != nil && block.Type == "CERTIFICATE" {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	// Attempt to parse as DER
+	return x509.ParseCertificate(certBytes)
+}
+
+// buildCertificateChain builds and validates the certificate chain from the
+// target certificate through the CA bundle to one of roots, and checks the
+// order of the CA bundle. The first element of the returned chain is the
+// target certificate.
+func buildCertificateChain(targetCertBytes []byte, caBundleBytes [][]byte, roots *x509.CertPool, currentTime time.Time) ([]*x509.Certificate, error) {
+	// Parse target certificate
+	targetCert, err := ParseCertificate(targetCertBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse target certificate: %w", err)
+	}
+
+	// Parse CA bundle certificates into the intermediates pool
+	intermediates := x509.NewCertPool()
+	bundle := make([]*x509.Certificate, 0, len(caBundleBytes))
+	for i, caCertBytes := range caBundleBytes {
+		cert, err := ParseCertificate(caCertBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cabundle[%d]: %w", i, err)
+		}
+		intermediates.AddCert(cert)
+		bundle = append(bundle, cert)
+	}
+
+	if currentTime.IsZero() {
+		currentTime = time.Now()
+	}
+
+	// Set up verification options
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   currentTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	// Verify the certificate chain
+	chains, err := targetCert.Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("certificate verification failed: %w", err)
+	}
+
+	// Keep the chain ending at the root heading the CA bundle
+	chain, err := rootChain(bundle, chains)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBundleOrder(targetCert, bundle); err != nil {
+		return nil, err
+	}
+
+	return chain, nil
+}
+
+// rootChain returns the chain of chains ending at the trusted root that heads
+// the CA bundle, as produced by the NSM. The root is matched by subject and
+// public key rather than byte for byte, so that a trusted root re-issued with
+// the same key, and thus a different signature, is still recognized.
+func rootChain(bundle []*x509.Certificate, chains [][]*x509.Certificate) ([]*x509.Certificate, error) {
+	if len(bundle) == 0 {
+		return nil, errors.New("cabundle is empty")
+	}
+	for _, chain := range chains {
+		root := chain[len(chain)-1]
+		if bytes.Equal(bundle[0].RawSubject, root.RawSubject) &&
+			bytes.Equal(bundle[0].RawSubjectPublicKeyInfo, root.RawSubjectPublicKeyInfo) {
+			return chain, nil
+		}
+	}
+	return nil, errors.New("cabundle[0] is not the trusted root certificate")
+}
+
+// checkBundleOrder checks that the rest of the CA bundle is ordered as produced
+// by the NSM: each intermediate issued by its predecessor, and the target
+// certificate issued by the last entry.
+func checkBundleOrder(target *x509.Certificate, bundle []*x509.Certificate) error {
+	for i := 1; i < len(bundle); i++ {
+		if err := bundle[i].CheckSignatureFrom(bundle[i-1]); err != nil {
+			return fmt.Errorf("cabundle[%d] is not issued by cabundle[%d]: %w", i, i-1, err)
+		}
+	}
+	if err := target.CheckSignatureFrom(bundle[len(bundle)-1]); err != nil {
+		return fmt.Errorf("certificate is not issued by the last cabundle entry: %w", err)
+	}
+	return nil
+}
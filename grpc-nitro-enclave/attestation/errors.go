@@ -0,0 +1,34 @@
+package attestation
+
+import "errors"
+
+// Sentinel errors classifying verification failures. Every error returned by
+// Verify is an *Error that matches exactly one of them with errors.Is.
+var (
+	ErrMalformed        = errors.New("attestation: malformed document")
+	ErrChain            = errors.New("attestation: certificate chain validation failed")
+	ErrAlgorithm        = errors.New("attestation: signature algorithm rejected")
+	ErrSignature        = errors.New("attestation: signature verification failed")
+	ErrStale            = errors.New("attestation: document is stale")
+	ErrNonceMismatch    = errors.New("attestation: nonce mismatch")
+	ErrUserDataMismatch = errors.New("attestation: user data mismatch")
+	ErrOnDemand         = errors.New("attestation: document was issued on demand")
+	ErrPCRMismatch      = errors.New("attestation: PCR mismatch")
+)
+
+// Error is the error returned by Verify. It records the check that failed, the
+// class of the failure and its cause. Typed causes such as *PCRMismatchError,
+// *StaleDocumentError or *AlgorithmNotAllowedError can be retrieved with errors.As.
+type Error struct {
+	Check Check // the check that failed
+	Kind  error // one of the Err* sentinels
+	Err   error // the underlying cause
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
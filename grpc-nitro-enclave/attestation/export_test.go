@@ -0,0 +1,3 @@
+package attestation
+
+var RootChain = rootChain
@@ -0,0 +1,39 @@
+package attestation
+
+import (
+	"fmt"
+	"time"
+)
+
+// Time returns the timestamp of the document, which the NSM sets in
+// milliseconds since the Unix epoch.
+func (d *AttestationDocument) Time() time.Time {
+	return time.UnixMilli(int64(d.Timestamp))
+}
+
+// StaleDocumentError is returned when the document timestamp is older than
+// VerifyOptions.MaxAge, or further in the future than VerifyOptions.ClockSkew.
+type StaleDocumentError struct {
+	Timestamp time.Time
+	Now       time.Time
+	MaxAge    time.Duration
+	ClockSkew time.Duration
+}
+
+func (e *StaleDocumentError) Error() string {
+	age := e.Now.Sub(e.Timestamp)
+	if age < 0 {
+		return fmt.Sprintf("attestation document timestamp %s is %v in the future (clock skew tolerance %v)",
+			e.Timestamp.UTC().Format(time.RFC3339Nano), -age, e.ClockSkew)
+	}
+	return fmt.Sprintf("attestation document timestamp %s is %v old (maximum age %v, clock skew tolerance %v)",
+		e.Timestamp.UTC().Format(time.RFC3339Nano), age, e.MaxAge, e.ClockSkew)
+}
+
+// checkFreshness checks that timestamp lies within [now-maxAge-skew, now+skew].
+func checkFreshness(timestamp, now time.Time, maxAge, skew time.Duration) error {
+	if timestamp.Before(now.Add(-maxAge-skew)) || timestamp.After(now.Add(skew)) {
+		return &StaleDocumentError{Timestamp: timestamp, Now: now, MaxAge: maxAge, ClockSkew: skew}
+	}
+	return nil
+}
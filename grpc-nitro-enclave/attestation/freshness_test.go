@@ -0,0 +1,88 @@
+package attestation_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+)
+
+func TestVerifyFreshness(t *testing.T) {
+	nsm := newNSM(t)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		age       time.Duration // negative for documents timestamped in the future
+		maxAge    time.Duration
+		clockSkew time.Duration
+		wantStale bool
+	}{
+		{name: "no maximum age", age: 2 * time.Hour},
+		{name: "fresh", age: 10 * time.Second, maxAge: time.Minute},
+		{name: "too old", age: 2 * time.Minute, maxAge: time.Minute, wantStale: true},
+		{name: "old within skew", age: 70 * time.Second, maxAge: time.Minute, clockSkew: 30 * time.Second},
+		{name: "future", age: -10 * time.Second, maxAge: time.Minute, wantStale: true},
+		{name: "future within skew", age: -10 * time.Second, maxAge: time.Minute, clockSkew: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsm.Now = func() time.Time { return now.Add(-tt.age) }
+			raw, err := nsm.Attest(nil, nil, nil)
+			if err != nil {
+				t.Fatalf("Attest: %v", err)
+			}
+
+			_, err = attestation.Verify(raw, attestation.VerifyOptions{
+				Roots:       nsm.CA.Roots(),
+				CurrentTime: now,
+				MaxAge:      tt.maxAge,
+				ClockSkew:   tt.clockSkew,
+			})
+			var stale *attestation.StaleDocumentError
+			if gotStale := errors.As(err, &stale); gotStale != tt.wantStale {
+				t.Fatalf("Verify error = %v, want stale %v", err, tt.wantStale)
+			}
+			if !tt.wantStale && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAuditMode(t *testing.T) {
+	// A document produced a month ago by a CA that has been valid since then;
+	// its three hour leaf certificate has long expired.
+	issued := time.Now().AddDate(0, -1, 0)
+	ca, err := attestertest.NewCAWithValidity(issued.Add(-time.Hour), issued.AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatalf("NewCAWithValidity: %v", err)
+	}
+	nsm := &attestertest.NSM{CA: ca, ModuleID: attestertest.ModuleID, PCRs: attestertest.TestPCRs(), Now: func() time.Time { return issued }}
+	raw, err := nsm.Attest(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+
+	if _, err := attestation.Verify(raw, attestation.VerifyOptions{Roots: ca.Roots()}); err == nil {
+		t.Fatal("Verify succeeded outside audit mode, want expired certificate error")
+	}
+
+	doc, err := attestation.Verify(raw, attestation.VerifyOptions{Roots: ca.Roots(), AuditMode: true})
+	if err != nil {
+		t.Fatalf("Verify in audit mode: %v", err)
+	}
+	if got := doc.Time(); got.UnixMilli() != issued.UnixMilli() {
+		t.Errorf("Time() = %v, want %v", got, issued)
+	}
+
+	// Audit mode does not lift an explicit maximum age.
+	_, err = attestation.Verify(raw, attestation.VerifyOptions{Roots: ca.Roots(), AuditMode: true, MaxAge: 24 * time.Hour})
+	var stale *attestation.StaleDocumentError
+	if !errors.As(err, &stale) {
+		t.Fatalf("Verify error = %v, want StaleDocumentError", err)
+	}
+}
@@ -0,0 +1,138 @@
+package attestation_test
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/veraison/go-cose"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+)
+
+var updateCorpus = flag.Bool("update-corpus", false, "regenerate the FuzzVerify seed corpus in testdata")
+
+const (
+	fuzzRootFile  = "testdata/fuzz-root.pem"
+	fuzzCorpusDir = "testdata/fuzz/FuzzVerify"
+)
+
+// fuzzOptions returns the verification options matching the seed corpus. The
+// seeds were generated an hour after the root certificate was issued, so
+// certificates are validated at that time.
+func fuzzOptions(t testing.TB) attestation.VerifyOptions {
+	t.Helper()
+	rootPEM, err := os.ReadFile(fuzzRootFile)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	roots, err := attestation.ParseRoots(rootPEM)
+	if err != nil {
+		t.Fatalf("ParseRoots: %v", err)
+	}
+	root, err := attestation.ParseCertificate(rootPEM)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return attestation.VerifyOptions{Roots: roots, CurrentTime: root.NotBefore.Add(time.Hour)}
+}
+
+func FuzzVerify(f *testing.F) {
+	opts := fuzzOptions(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		doc, err := attestation.Verify(data, opts)
+		if err == nil && doc == nil {
+			t.Fatal("Verify returned neither a document nor an error")
+		}
+	})
+}
+
+// TestFuzzCorpus checks that the valid seeds of the corpus still verify, so
+// that the corpus keeps exercising the code past the signature check.
+func TestFuzzCorpus(t *testing.T) {
+	opts := fuzzOptions(t)
+	for _, name := range []string{"valid", "valid-with-fields"} {
+		data := readSeed(t, filepath.Join(fuzzCorpusDir, name))
+		if _, err := attestation.Verify(data, opts); err != nil {
+			t.Errorf("seed %s: %v", name, err)
+		}
+	}
+}
+
+func readSeed(t *testing.T, path string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var data []byte
+	if _, err := fmt.Sscanf(string(raw), "go test fuzz v1\n[]byte(%q)\n", &data); err != nil {
+		t.Fatalf("failed to parse seed %s: %v", path, err)
+	}
+	return data
+}
+
+// TestGenerateFuzzCorpus rewrites the seed corpus when run with -update-corpus.
+func TestGenerateFuzzCorpus(t *testing.T) {
+	if !*updateCorpus {
+		t.Skip("run with -update-corpus to regenerate the seed corpus")
+	}
+
+	nsm := newNSM(t)
+	seeds := map[string][]byte{}
+	add := func(name string, tamper func(*attestertest.Document)) []byte {
+		doc, err := nsm.NewDocument(nil, nil, nil)
+		if err != nil {
+			t.Fatalf("NewDocument: %v", err)
+		}
+		if tamper != nil {
+			tamper(doc)
+		}
+		raw, err := doc.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		seeds[name] = raw
+		return raw
+	}
+
+	valid := add("valid", nil)
+	add("valid-with-fields", func(d *attestertest.Document) {
+		d.Nonce, d.UserData, d.PublicKey = []byte("nonce"), []byte("user data"), []byte("public key")
+	})
+	add("tagged", func(d *attestertest.Document) { d.Tagged = true })
+	add("alg-es256", func(d *attestertest.Document) { d.Algorithm = cose.AlgorithmES256 })
+	add("alg-ps384", func(d *attestertest.Document) { d.Algorithm = cose.AlgorithmPS384 })
+	add("swapped-cabundle", func(d *attestertest.Document) {
+		d.CABundle[0], d.CABundle[1] = d.CABundle[1], d.CABundle[0]
+	})
+	add("expired-leaf", func(d *attestertest.Document) {
+		reissue(t, d, nsm.CA, time.Now().Add(-4*time.Hour), time.Now().Add(-2*time.Hour))
+	})
+	add("oversized-nonce", func(d *attestertest.Document) { d.Nonce = make([]byte, 513) })
+	add("oversized-cabundle-entry", func(d *attestertest.Document) { d.CABundle = append(d.CABundle, make([]byte, 1025)) })
+	add("bad-pcr-length", func(d *attestertest.Document) { d.PCRs[0] = make([]byte, 47) })
+	add("bad-pcr-index", func(d *attestertest.Document) { d.PCRs[32] = make([]byte, 48) })
+	add("bad-digest", func(d *attestertest.Document) { d.Digest = "SHA256" })
+	seeds["truncated-half"] = valid[:len(valid)/2]
+	seeds["truncated-last-byte"] = valid[:len(valid)-1]
+	seeds["tag-cose-mac0"] = append([]byte{0xd1}, valid...)
+	seeds["empty"] = []byte{}
+
+	if err := os.MkdirAll(fuzzCorpusDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fuzzRootFile, nsm.CA.RootPEM(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range seeds {
+		content := fmt.Sprintf("go test fuzz v1\n[]byte(%q)\n", data)
+		if err := os.WriteFile(filepath.Join(fuzzCorpusDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// OnDemandPrefix starts the user_data field of the documents that
+// AttestationService hands out on demand. Their nonce, user data and public
+// key are chosen by the caller, so they must not be accepted as proof that
+// the enclave holds the key they bind: Verify rejects them unless
+// VerifyOptions.AllowOnDemand is set.
+const OnDemandPrefix = "nitro-example/GetAttestation\x00"
+
+// OnDemandUserData returns the user_data field of an on-demand document
+// requested with userData: OnDemandPrefix followed by the SHA-256 hash of
+// userData.
+func OnDemandUserData(userData []byte) []byte {
+	sum := sha256.Sum256(userData)
+	return append([]byte(OnDemandPrefix), sum[:]...)
+}
+
+// OnDemand reports whether the document was handed out on demand by
+// AttestationService.
+func (d *AttestationDocument) OnDemand() bool {
+	return bytes.HasPrefix(d.UserData, []byte(OnDemandPrefix))
+}
@@ -0,0 +1,175 @@
+package attestation
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// policyPCRs are the PCR indexes that can be pinned by a PCRPolicy:
+// 0 (enclave image), 1 (kernel and bootstrap), 2 (application), 3 (parent
+// instance IAM role), 4 (parent instance ID) and 8 (enclave image signing certificate).
+var policyPCRs = map[int]bool{0: true, 1: true, 2: true, 3: true, 4: true, 8: true}
+
+// Measurements maps PCR indexes to their expected values.
+type Measurements map[int][]byte
+
+// PCRPolicy is an allow-list of acceptable enclave measurements. A document
+// satisfies the policy if its PCRs match every value of at least one entry,
+// which allows several image versions to be accepted during a rolling upgrade.
+type PCRPolicy struct {
+	Allowed []Measurements
+}
+
+// PCRMismatchError reports a PCR whose value differs from the policy.
+type PCRMismatchError struct {
+	Index    int
+	Expected []byte
+	Actual   []byte // nil if the PCR is missing from the document
+}
+
+func (e *PCRMismatchError) Error() string {
+	if e.Actual == nil {
+		return fmt.Sprintf("PCR%d missing from attestation document", e.Index)
+	}
+	return fmt.Sprintf("PCR%d mismatch: expected %x, got %x", e.Index, e.Expected, e.Actual)
+}
+
+// Check returns nil if pcrs match all values of m, or a *PCRMismatchError for
+// the lowest mismatching index.
+func (m Measurements) Check(pcrs map[int][]byte) error {
+	indexes := make([]int, 0, len(m))
+	for idx := range m {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	for _, idx := range indexes {
+		actual, ok := pcrs[idx]
+		if !ok {
+			return &PCRMismatchError{Index: idx, Expected: m[idx]}
+		}
+		if !bytes.Equal(actual, m[idx]) {
+			return &PCRMismatchError{Index: idx, Expected: m[idx], Actual: actual}
+		}
+	}
+	return nil
+}
+
+// Check returns nil if pcrs satisfy at least one entry of the policy. Otherwise
+// the returned error joins the mismatch of every entry.
+func (p *PCRPolicy) Check(pcrs map[int][]byte) error {
+	if len(p.Allowed) == 0 {
+		return errors.New("PCR policy has no allowed measurements")
+	}
+
+	var errs []error
+	for i, m := range p.Allowed {
+		err := m.Check(pcrs)
+		if err == nil {
+			return nil
+		}
+		if len(p.Allowed) > 1 {
+			err = fmt.Errorf("allowed measurement %d: %w", i, err)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// ParseMeasurements parses expected PCR values from the JSON printed by
+// `nitro-cli build-enclave` or `nitro-cli describe-eif`:
+//
+//	{"Measurements": {"HashAlgorithm": "Sha384 { ... }", "PCR0": "…", "PCR1": "…", "PCR2": "…"}}
+//
+// The inner "Measurements" object on its own is accepted too. Keys other than
+// PCR0, PCR1, PCR2, PCR3, PCR4 and PCR8 are ignored.
+func ParseMeasurements(data []byte) (Measurements, error) {
+	var wrapper struct {
+		Measurements map[string]json.RawMessage `json:"Measurements"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return nil, fmt.Errorf("failed to parse measurements: %w", err)
+	}
+	fields := wrapper.Measurements
+	if fields == nil {
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("failed to parse measurements: %w", err)
+		}
+	}
+
+	m := Measurements{}
+	for key, raw := range fields {
+		if !strings.HasPrefix(key, "PCR") {
+			continue
+		}
+		idx, err := strconv.Atoi(strings.TrimPrefix(key, "PCR"))
+		if err != nil || !policyPCRs[idx] {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		pcr, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex value for %s: %w", key, err)
+		}
+		if len(pcr) != 32 && len(pcr) != 48 && len(pcr) != 64 {
+			return nil, fmt.Errorf("invalid length for %s: %d", key, len(pcr))
+		}
+		m[idx] = pcr
+	}
+
+	if len(m) == 0 {
+		return nil, errors.New("no PCR values found in measurements")
+	}
+	return m, nil
+}
+
+// ParsePCRPolicy parses a policy from either a single nitro-cli measurements
+// object (see ParseMeasurements) or a JSON array of them, one per acceptable image.
+func ParsePCRPolicy(data []byte) (*PCRPolicy, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		entries = []json.RawMessage{data}
+	}
+
+	policy := &PCRPolicy{}
+	for i, entry := range entries {
+		m, err := ParseMeasurements(entry)
+		if err != nil {
+			return nil, fmt.Errorf("policy entry %d: %w", i, err)
+		}
+		policy.Allowed = append(policy.Allowed, m)
+	}
+
+	if len(policy.Allowed) == 0 {
+		return nil, errors.New("PCR policy has no allowed measurements")
+	}
+	return policy, nil
+}
+
+// LoadPCRPolicy reads policy files with ParsePCRPolicy and merges their
+// entries into a single allow-list.
+func LoadPCRPolicy(paths ...string) (*PCRPolicy, error) {
+	policy := &PCRPolicy{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PCR policy: %w", err)
+		}
+		p, err := ParsePCRPolicy(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		policy.Allowed = append(policy.Allowed, p.Allowed...)
+	}
+	return policy, nil
+}
@@ -0,0 +1,152 @@
+package attestation
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+
+	"github.com/veraison/go-cose"
+)
+
+// Check names a step of the verification.
+type Check string
+
+// Checks performed by Verify, in order.
+const (
+	CheckCOSE      Check = "cose"      // the document is a COSE_Sign1 message
+	CheckPayload   Check = "payload"   // the payload decodes as an AttestationDocument
+	CheckFields    Check = "fields"    // the payload fields are well-formed
+	CheckChain     Check = "chain"     // the certificate chain leads to a trusted root
+	CheckAlgorithm Check = "algorithm" // the signature algorithm is allowed and matches the key
+	CheckSignature Check = "signature" // the COSE signature is valid
+	CheckFreshness Check = "freshness" // the timestamp is within VerifyOptions.MaxAge
+	CheckNonce     Check = "nonce"     // the nonce equals VerifyOptions.Nonce
+	CheckUserData  Check = "user_data" // the user data equals VerifyOptions.UserData, and is not on demand
+	CheckPCRs      Check = "pcrs"      // the PCRs satisfy VerifyOptions.Policy
+)
+
+// allChecks lists the checks in the order in which Verify performs them.
+var allChecks = []Check{
+	CheckCOSE, CheckPayload, CheckFields, CheckChain, CheckAlgorithm,
+	CheckSignature, CheckFreshness, CheckNonce, CheckUserData, CheckPCRs,
+}
+
+// Outcome is the result of a check.
+type Outcome string
+
+const (
+	OutcomePassed  Outcome = "passed"
+	OutcomeFailed  Outcome = "failed"
+	OutcomeSkipped Outcome = "skipped" // not configured, or not reached after a failure
+)
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	Check   Check   `json:"check"`
+	Outcome Outcome `json:"outcome"`
+	Detail  string  `json:"detail,omitempty"`
+}
+
+// CertificateInfo summarizes a certificate of the validated chain.
+type CertificateInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	Serial    string    `json:"serial"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	SHA256    string    `json:"sha256"` // hex fingerprint of the DER encoding
+}
+
+// NewCertificateInfo summarizes cert.
+func NewCertificateInfo(cert *x509.Certificate) CertificateInfo {
+	sum := sha256.Sum256(cert.Raw)
+	return CertificateInfo{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		Serial:    cert.SerialNumber.Text(16),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		SHA256:    hex.EncodeToString(sum[:]),
+	}
+}
+
+// VerificationReport lists every check performed by Verify, its outcome and
+// the parsed fields of the document, for logging and alerting.
+type VerificationReport struct {
+	Checks []CheckResult `json:"checks"`
+
+	// Document is the parsed payload. It is nil if the payload could not be
+	// decoded, and must not be trusted unless the report is OK.
+	Document *AttestationDocument `json:"document,omitempty"`
+
+	// Algorithm is the signature algorithm of the protected header, if known.
+	Algorithm cose.Algorithm `json:"algorithm,omitempty"`
+
+	// Chain is the validated certificate chain, from the attestation
+	// certificate to the root.
+	Chain []*x509.Certificate `json:"-"`
+
+	// Certificates summarizes Chain.
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+
+	// Err is the first failure, or nil.
+	Err error `json:"-"`
+}
+
+// OK reports whether all performed checks passed.
+func (r *VerificationReport) OK() bool {
+	return r.Err == nil
+}
+
+// Result returns the result of check c.
+func (r *VerificationReport) Result(c Check) CheckResult {
+	for _, res := range r.Checks {
+		if res.Check == c {
+			return res
+		}
+	}
+	return CheckResult{Check: c, Outcome: OutcomeSkipped}
+}
+
+// Expiry returns the earliest expiry of the validated certificate chain, after
+// which the document no longer verifies, or the zero time if no chain was
+// validated.
+func (r *VerificationReport) Expiry() time.Time {
+	var expiry time.Time
+	for _, cert := range r.Chain {
+		if expiry.IsZero() || cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	return expiry
+}
+
+func (r *VerificationReport) pass(c Check, detail string) {
+	r.Checks = append(r.Checks, CheckResult{Check: c, Outcome: OutcomePassed, Detail: detail})
+}
+
+func (r *VerificationReport) skip(c Check, detail string) {
+	r.Checks = append(r.Checks, CheckResult{Check: c, Outcome: OutcomeSkipped, Detail: detail})
+}
+
+// fail records the failure of check c and marks the remaining checks as skipped.
+func (r *VerificationReport) fail(c Check, kind, err error) *VerificationReport {
+	r.Err = &Error{Check: c, Kind: kind, Err: err}
+	r.Checks = append(r.Checks, CheckResult{Check: c, Outcome: OutcomeFailed, Detail: err.Error()})
+	reached := false
+	for _, next := range allChecks {
+		if reached {
+			r.skip(next, "not reached")
+		}
+		reached = reached || next == c
+	}
+	return r
+}
+
+func (r *VerificationReport) setChain(chain []*x509.Certificate) {
+	r.Chain = chain
+	for _, cert := range chain {
+		r.Certificates = append(r.Certificates, NewCertificateInfo(cert))
+	}
+}
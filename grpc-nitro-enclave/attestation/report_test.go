@@ -0,0 +1,224 @@
+package attestation_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/veraison/go-cose"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+)
+
+func TestVerifyErrorKinds(t *testing.T) {
+	nsm := newNSM(t)
+	otherCA, err := attestertest.NewCA()
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		tamper    func(*attestertest.Document)
+		opts      func(*attestation.VerifyOptions)
+		raw       []byte // used instead of an attested document if set
+		wantKind  error
+		wantCheck attestation.Check
+	}{
+		{
+			name:      "not CBOR",
+			raw:       []byte("not an attestation document"),
+			wantKind:  attestation.ErrMalformed,
+			wantCheck: attestation.CheckCOSE,
+		},
+		{
+			name:      "missing module_id",
+			tamper:    func(d *attestertest.Document) { d.ModuleID = "" },
+			wantKind:  attestation.ErrMalformed,
+			wantCheck: attestation.CheckFields,
+		},
+		{
+			name:      "untrusted root",
+			opts:      func(o *attestation.VerifyOptions) { o.Roots = otherCA.Roots() },
+			wantKind:  attestation.ErrChain,
+			wantCheck: attestation.CheckChain,
+		},
+		{
+			name:      "ES256 algorithm header",
+			tamper:    func(d *attestertest.Document) { d.Algorithm = cose.AlgorithmES256 },
+			wantKind:  attestation.ErrAlgorithm,
+			wantCheck: attestation.CheckAlgorithm,
+		},
+		{
+			name: "signed by another key",
+			tamper: func(d *attestertest.Document) {
+				_, key, err := otherCA.IssueLeaf(time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+				if err != nil {
+					t.Fatalf("IssueLeaf: %v", err)
+				}
+				d.Key = key
+			},
+			wantKind:  attestation.ErrSignature,
+			wantCheck: attestation.CheckSignature,
+		},
+		{
+			name:      "stale",
+			opts:      func(o *attestation.VerifyOptions) { o.MaxAge, o.CurrentTime = time.Minute, time.Now().Add(time.Hour) },
+			wantKind:  attestation.ErrStale,
+			wantCheck: attestation.CheckFreshness,
+		},
+		{
+			name:      "nonce mismatch",
+			opts:      func(o *attestation.VerifyOptions) { o.Nonce = []byte("other nonce") },
+			wantKind:  attestation.ErrNonceMismatch,
+			wantCheck: attestation.CheckNonce,
+		},
+		{
+			name:      "user data mismatch",
+			opts:      func(o *attestation.VerifyOptions) { o.UserData = []byte("other user data") },
+			wantKind:  attestation.ErrUserDataMismatch,
+			wantCheck: attestation.CheckUserData,
+		},
+		{
+			name: "PCR mismatch",
+			opts: func(o *attestation.VerifyOptions) {
+				o.Policy = &attestation.PCRPolicy{Allowed: []attestation.Measurements{{2: bytes.Repeat([]byte{0xff}, 48)}}}
+			},
+			wantKind:  attestation.ErrPCRMismatch,
+			wantCheck: attestation.CheckPCRs,
+		},
+	}
+
+	kinds := []error{
+		attestation.ErrMalformed, attestation.ErrChain, attestation.ErrAlgorithm, attestation.ErrSignature,
+		attestation.ErrStale, attestation.ErrNonceMismatch, attestation.ErrUserDataMismatch, attestation.ErrPCRMismatch,
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := tt.raw
+			if raw == nil {
+				d, err := nsm.NewDocument(nil, nil, nil)
+				if err != nil {
+					t.Fatalf("NewDocument: %v", err)
+				}
+				if tt.tamper != nil {
+					tt.tamper(d)
+				}
+				if raw, err = d.Marshal(); err != nil {
+					t.Fatalf("Marshal: %v", err)
+				}
+			}
+			opts := attestation.VerifyOptions{Roots: nsm.CA.Roots()}
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+
+			_, err := attestation.Verify(raw, opts)
+			var verr *attestation.Error
+			if !errors.As(err, &verr) {
+				t.Fatalf("Verify error = %v, want *attestation.Error", err)
+			}
+			if verr.Check != tt.wantCheck {
+				t.Errorf("Check = %q, want %q", verr.Check, tt.wantCheck)
+			}
+			for _, kind := range kinds {
+				if got, want := errors.Is(err, kind), kind == tt.wantKind; got != want {
+					t.Errorf("errors.Is(err, %v) = %v, want %v", kind, got, want)
+				}
+			}
+
+			report := attestation.VerifyReport(raw, opts)
+			if report.OK() {
+				t.Fatal("VerifyReport OK, want failure")
+			}
+			if got := report.Result(tt.wantCheck).Outcome; got != attestation.OutcomeFailed {
+				t.Errorf("%s outcome = %q, want %q", tt.wantCheck, got, attestation.OutcomeFailed)
+			}
+			if last := report.Checks[len(report.Checks)-1]; last.Check != attestation.CheckPCRs {
+				t.Errorf("last reported check = %q, want every check reported", last.Check)
+			}
+		})
+	}
+}
+
+func TestVerifyErrorCauses(t *testing.T) {
+	nsm := newNSM(t)
+	raw, err := nsm.Attest(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+
+	_, err = attestation.Verify(raw, attestation.VerifyOptions{
+		Roots:  nsm.CA.Roots(),
+		Policy: &attestation.PCRPolicy{Allowed: []attestation.Measurements{{4: bytes.Repeat([]byte{0xff}, 48)}}},
+	})
+	var mismatch *attestation.PCRMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Index != 4 {
+		t.Errorf("Verify error = %v, want PCR4 mismatch", err)
+	}
+
+	_, err = attestation.Verify(raw, attestation.VerifyOptions{
+		Roots:      nsm.CA.Roots(),
+		Algorithms: []cose.Algorithm{cose.AlgorithmES256},
+	})
+	var notAllowed *attestation.AlgorithmNotAllowedError
+	if !errors.As(err, &notAllowed) {
+		t.Errorf("Verify error = %v, want *AlgorithmNotAllowedError", err)
+	}
+}
+
+func TestVerifyReport(t *testing.T) {
+	nsm := newNSM(t)
+	nonce := []byte("nonce")
+	raw, err := nsm.Attest(nonce, nil, nil)
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+
+	report := attestation.VerifyReport(raw, attestation.VerifyOptions{
+		Roots:  nsm.CA.Roots(),
+		Nonce:  nonce,
+		MaxAge: time.Minute,
+	})
+	if !report.OK() {
+		t.Fatalf("VerifyReport: %v", report.Err)
+	}
+
+	want := map[attestation.Check]attestation.Outcome{
+		attestation.CheckCOSE:      attestation.OutcomePassed,
+		attestation.CheckPayload:   attestation.OutcomePassed,
+		attestation.CheckFields:    attestation.OutcomePassed,
+		attestation.CheckChain:     attestation.OutcomePassed,
+		attestation.CheckAlgorithm: attestation.OutcomePassed,
+		attestation.CheckSignature: attestation.OutcomePassed,
+		attestation.CheckFreshness: attestation.OutcomePassed,
+		attestation.CheckNonce:     attestation.OutcomePassed,
+		attestation.CheckUserData:  attestation.OutcomeSkipped,
+		attestation.CheckPCRs:      attestation.OutcomeSkipped,
+	}
+	if len(report.Checks) != len(want) {
+		t.Errorf("got %d checks, want %d", len(report.Checks), len(want))
+	}
+	for check, outcome := range want {
+		if got := report.Result(check).Outcome; got != outcome {
+			t.Errorf("%s outcome = %q, want %q", check, got, outcome)
+		}
+	}
+
+	if report.Algorithm != cose.AlgorithmES384 {
+		t.Errorf("Algorithm = %v, want ES384", report.Algorithm)
+	}
+	if report.Document == nil || report.Document.ModuleID != attestertest.ModuleID {
+		t.Errorf("Document = %+v, want module %q", report.Document, attestertest.ModuleID)
+	}
+	// leaf, intermediate, root
+	if len(report.Certificates) != 3 {
+		t.Fatalf("got %d certificates, want 3", len(report.Certificates))
+	}
+	if got, want := report.Certificates[2].Subject, nsm.CA.Root.Subject.String(); got != want {
+		t.Errorf("root subject = %q, want %q", got, want)
+	}
+}
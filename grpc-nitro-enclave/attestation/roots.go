@@ -0,0 +1,65 @@
+package attestation
+
+import (
+	"crypto/x509"
+	_ "embed"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// awsNitroRootPEM is the AWS Nitro Enclaves root certificate (AWS_NitroEnclaves_Root-G1),
+// extracted from https://aws-nitro-enclaves.amazonaws.com/AWS_NitroEnclaves_Root-G1.zip.
+//
+//go:embed root.pem
+var awsNitroRootPEM []byte
+
+// AWSNitroRootPEM returns the embedded AWS Nitro Enclaves root certificate in PEM format.
+func AWSNitroRootPEM() []byte {
+	return append([]byte(nil), awsNitroRootPEM...)
+}
+
+// AWSNitroRoots returns a pool holding the embedded AWS Nitro Enclaves root certificate.
+func AWSNitroRoots() *x509.CertPool {
+	roots, err := ParseRoots(awsNitroRootPEM)
+	if err != nil {
+		panic("attestation: invalid embedded root certificate: " + err.Error())
+	}
+	return roots
+}
+
+// ParseRoots parses one or more PEM encoded certificates into a pool.
+func ParseRoots(pemData []byte) (*x509.CertPool, error) {
+	roots := x509.NewCertPool()
+	n := 0
+	for {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse root certificate %d: %w", n, err)
+		}
+		roots.AddCert(cert)
+		n++
+	}
+	if n == 0 {
+		return nil, errors.New("no certificates found in PEM data")
+	}
+	return roots, nil
+}
+
+// LoadRoots reads a PEM file with one or more trusted root certificates.
+func LoadRoots(path string) (*x509.CertPool, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read root certificates: %w", err)
+	}
+	return ParseRoots(pemData)
+}
@@ -0,0 +1,77 @@
+package attestation_test
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+)
+
+// awsNitroRootSHA256 is the published SHA-256 fingerprint of the AWS Nitro
+// Enclaves Root-G1 certificate.
+const awsNitroRootSHA256 = "641a0321a3e244efe456463195d606317ed7cdcc3c1756e09893f3c68f79bb5b"
+
+func TestAWSNitroRoot(t *testing.T) {
+	block, rest := pem.Decode(attestation.AWSNitroRootPEM())
+	if block == nil || block.Type != "CERTIFICATE" || len(rest) != 0 {
+		t.Fatal("embedded root is not a single PEM certificate")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	if got := hex.EncodeToString(sum[:]); got != awsNitroRootSHA256 {
+		t.Errorf("embedded root fingerprint = %s, want %s", got, awsNitroRootSHA256)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if err := cert.CheckSignatureFrom(cert); err != nil {
+		t.Errorf("embedded root is not validly self-signed: %v", err)
+	}
+	if cert.Subject.CommonName != "aws.nitro-enclaves" {
+		t.Errorf("embedded root subject = %v, want CN=aws.nitro-enclaves", cert.Subject)
+	}
+}
+
+// TestAWSNitroRootHeadsBundle checks that the CA bundle of a genuine document,
+// headed by the AWS root, is matched to AWSNitroRoots, also when the root in
+// the bundle differs only by its signature, and that another root is not.
+func TestAWSNitroRootHeadsBundle(t *testing.T) {
+	root, err := attestation.ParseCertificate(attestation.AWSNitroRootPEM())
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	chains, err := root.Verify(x509.VerifyOptions{Roots: attestation.AWSNitroRoots()})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	for _, tt := range []struct {
+		file    string
+		wantErr bool
+	}{
+		{"root.pem", false},
+		{"testdata/aws-root-badsig.pem", false},
+		{"testdata/fuzz-root.pem", true},
+	} {
+		b, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		head, err := attestation.ParseCertificate(b)
+		if err != nil {
+			t.Fatalf("ParseCertificate(%s): %v", tt.file, err)
+		}
+		chain, err := attestation.RootChain([]*x509.Certificate{head}, chains)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("cabundle headed by %s: error = %v, want error %v", tt.file, err, tt.wantErr)
+		}
+		if err == nil && !chain[len(chain)-1].Equal(root) {
+			t.Errorf("cabundle headed by %s: chain does not end at the AWS root", tt.file)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package attestation
+
+import (
+	"errors"
+	"fmt"
+)
+
+// validateFields performs syntactic validation of the attestation document.
+func validateFields(doc *AttestationDocument) error {
+	// Check mandatory fields are non-empty
+	if doc.ModuleID == "" {
+		return errors.New("module_id is missing or empty")
+	}
+	if doc.Digest == "" {
+		return errors.New("digest is missing or empty")
+	}
+	if doc.Timestamp == 0 {
+		return errors.New("timestamp is missing or zero")
+	}
+	if len(doc.PCRs) == 0 {
+		return errors.New("pcrs is missing or empty")
+	}
+	if len(doc.Certificate) == 0 {
+		return errors.New("certificate is missing or empty")
+	}
+	if len(doc.CABundle) == 0 {
+		return errors.New("cabundle is missing or empty")
+	}
+
+	// Validate 'digest' field
+	if doc.Digest != "SHA384" {
+		return fmt.Errorf("invalid digest value: %s", doc.Digest)
+	}
+
+	// Validate 'pcrs' field
+	if len(doc.PCRs) < 1 || len(doc.PCRs) > 32 {
+		return fmt.Errorf("pcrs size out of bounds: %d", len(doc.PCRs))
+	}
+	for idx, pcr := range doc.PCRs {
+		if idx < 0 || idx >= 32 {
+			return fmt.Errorf("invalid PCR index: %d", idx)
+		}
+		if len(pcr) != 32 && len(pcr) != 48 && len(pcr) != 64 {
+			return fmt.Errorf("invalid PCR length for index %d: %d", idx, len(pcr))
+		}
+	}
+
+	// Validate 'cabundle' field
+	for i, cert := range doc.CABundle {
+		if len(cert) < 1 || len(cert) > 1024 {
+			return fmt.Errorf("invalid cabundle[%d] length: %d", i, len(cert))
+		}
+	}
+
+	// Validate optional fields
+	if len(doc.PublicKey) > 1024 {
+		return fmt.Errorf("public_key length exceeds limit: %d", len(doc.PublicKey))
+	}
+	if len(doc.UserData) > 512 {
+		return fmt.Errorf("user_data length exceeds limit: %d", len(doc.UserData))
+	}
+	if len(doc.Nonce) > 512 {
+		return fmt.Errorf("nonce length exceeds limit: %d", len(doc.Nonce))
+	}
+
+	return nil
+}
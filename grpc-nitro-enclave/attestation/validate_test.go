@@ -0,0 +1,85 @@
+package attestation_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+)
+
+// TestVerifyFieldRules checks the syntactic rules of the attestation document
+// payload. Every case starts from a valid document and changes one field.
+func TestVerifyFieldRules(t *testing.T) {
+	nsm := newNSM(t)
+
+	tests := []struct {
+		name    string
+		tamper  func(*attestertest.Document)
+		wantErr string // empty if the document must verify
+	}{
+		{"empty module_id", func(d *attestertest.Document) { d.ModuleID = "" }, "module_id is missing"},
+		{"empty digest", func(d *attestertest.Document) { d.Digest = "" }, "digest is missing"},
+		{"SHA256 digest", func(d *attestertest.Document) { d.Digest = "SHA256" }, "invalid digest value"},
+		{"lowercase digest", func(d *attestertest.Document) { d.Digest = "sha384" }, "invalid digest value"},
+		{"zero timestamp", func(d *attestertest.Document) { d.Timestamp = 0 }, "timestamp is missing"},
+		{"no pcrs", func(d *attestertest.Document) { d.PCRs = nil }, "pcrs is missing"},
+		{"empty pcrs", func(d *attestertest.Document) { d.PCRs = map[int][]byte{} }, "pcrs is missing"},
+		{"32 pcrs", func(d *attestertest.Document) { d.PCRs = pcrs(32, 48) }, ""},
+		{"33 pcrs", func(d *attestertest.Document) { d.PCRs = pcrs(33, 48) }, "pcrs size out of bounds: 33"},
+		{"pcr index 31", func(d *attestertest.Document) { d.PCRs[31] = make([]byte, 48) }, ""},
+		{"pcr index 32", func(d *attestertest.Document) { d.PCRs[32] = make([]byte, 48) }, "invalid PCR index: 32"},
+		{"negative pcr index", func(d *attestertest.Document) { d.PCRs[-1] = make([]byte, 48) }, "invalid PCR index: -1"},
+		{"32 byte pcr", func(d *attestertest.Document) { d.PCRs[3] = make([]byte, 32) }, ""},
+		{"64 byte pcr", func(d *attestertest.Document) { d.PCRs[3] = make([]byte, 64) }, ""},
+		{"empty pcr", func(d *attestertest.Document) { d.PCRs[3] = []byte{} }, "invalid PCR length for index 3: 0"},
+		{"31 byte pcr", func(d *attestertest.Document) { d.PCRs[3] = make([]byte, 31) }, "invalid PCR length for index 3: 31"},
+		{"47 byte pcr", func(d *attestertest.Document) { d.PCRs[3] = make([]byte, 47) }, "invalid PCR length for index 3: 47"},
+		{"49 byte pcr", func(d *attestertest.Document) { d.PCRs[3] = make([]byte, 49) }, "invalid PCR length for index 3: 49"},
+		{"65 byte pcr", func(d *attestertest.Document) { d.PCRs[3] = make([]byte, 65) }, "invalid PCR length for index 3: 65"},
+		{"no certificate", func(d *attestertest.Document) { d.Certificate = nil }, "certificate is missing"},
+		{"no cabundle", func(d *attestertest.Document) { d.CABundle = nil }, "cabundle is missing"},
+		{"empty cabundle entry", func(d *attestertest.Document) { d.CABundle = append(d.CABundle, []byte{}) }, "invalid cabundle[2] length: 0"},
+		{"oversized cabundle entry", func(d *attestertest.Document) { d.CABundle = append(d.CABundle, make([]byte, 1025)) }, "invalid cabundle[2] length: 1025"},
+		{"1024 byte public_key", func(d *attestertest.Document) { d.PublicKey = make([]byte, 1024) }, ""},
+		{"oversized public_key", func(d *attestertest.Document) { d.PublicKey = make([]byte, 1025) }, "public_key length exceeds limit: 1025"},
+		{"512 byte user_data", func(d *attestertest.Document) { d.UserData = make([]byte, 512) }, ""},
+		{"oversized user_data", func(d *attestertest.Document) { d.UserData = make([]byte, 513) }, "user_data length exceeds limit: 513"},
+		{"512 byte nonce", func(d *attestertest.Document) { d.Nonce = make([]byte, 512) }, ""},
+		{"oversized nonce", func(d *attestertest.Document) { d.Nonce = make([]byte, 513) }, "nonce length exceeds limit: 513"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := nsm.NewDocument(nil, nil, nil)
+			if err != nil {
+				t.Fatalf("NewDocument: %v", err)
+			}
+			tt.tamper(doc)
+			raw, err := doc.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			_, err = attestation.Verify(raw, attestation.VerifyOptions{Roots: nsm.CA.Roots()})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Verify: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("Verify succeeded, want error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("Verify error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// pcrs returns n PCRs of the given size.
+func pcrs(n, size int) map[int][]byte {
+	m := make(map[int][]byte, n)
+	for i := 0; i < n; i++ {
+		m[i] = bytes.Repeat([]byte{byte(i)}, size)
+	}
+	return m
+}
@@ -0,0 +1,64 @@
+// Package attester obtains attestation documents, either from the Nitro Secure
+// Module (NSM) of an enclave or, for development outside an enclave, from a
+// local stand-in that signs documents with a self-generated certificate authority.
+package attester
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/tracing"
+)
+
+// Attester obtains attestation documents binding the given nonce, user data
+// and public key. All arguments are optional.
+type Attester interface {
+	Attest(nonce, userData, publicKey []byte) ([]byte, error)
+}
+
+// ContextAttester is implemented by attesters wrapping another one, such as
+// the instrumented attester of package metrics, to pass the context of the
+// request on to it.
+type ContextAttester interface {
+	AttestContext(ctx context.Context, nonce, userData, publicKey []byte) ([]byte, error)
+}
+
+// AttestContext calls att.AttestContext if att is a ContextAttester. Otherwise
+// it calls att.Attest within an "nsm.attest" span, a child of the span of ctx
+// if any.
+func AttestContext(ctx context.Context, att Attester, nonce, userData, publicKey []byte) ([]byte, error) {
+	if c, ok := att.(ContextAttester); ok {
+		return c.AttestContext(ctx, nonce, userData, publicKey)
+	}
+	_, span := tracing.Start(ctx, "nsm.attest", trace.WithAttributes(
+		attribute.Int("nsm.nonce_size", len(nonce)),
+		attribute.Int("nsm.user_data_size", len(userData)),
+		attribute.Int("nsm.public_key_size", len(publicKey)),
+	))
+	doc, err := att.Attest(nonce, userData, publicKey)
+	span.SetAttributes(attribute.Int("nsm.document_size", len(doc)))
+	tracing.RecordError(span, err)
+	span.End()
+	return doc, err
+}
+
+// Kinds of attesters accepted by New.
+const (
+	KindNSM   = "nsm"
+	KindLocal = "local"
+)
+
+// New returns the attester of the given kind.
+func New(kind string) (Attester, error) {
+	switch kind {
+	case KindNSM:
+		return OpenNSM()
+	case KindLocal:
+		return NewLocal()
+	default:
+		return nil, fmt.Errorf("unknown attester %q, expected %q or %q", kind, KindNSM, KindLocal)
+	}
+}
@@ -0,0 +1,339 @@
+// Package attestertest fabricates AWS Nitro Enclaves attestation documents for
+// tests. Documents use the exact Nitro CBOR layout and are signed with ES384 by
+// a leaf certificate issued by a generated test root and intermediate, so that
+// verification code and servers can be exercised in-process. Document exposes
+// every field and signing parameter for negative tests.
+package attestertest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+)
+
+// ModuleID is the default module_id of fabricated documents.
+const ModuleID = "i-0123456789abcdef0-enc0123456789abcdef"
+
+// CA is a test certificate hierarchy mirroring the Nitro one: a root, an
+// intermediate and short-lived leaf certificates that sign documents.
+type CA struct {
+	Root            *x509.Certificate
+	RootKey         *ecdsa.PrivateKey
+	Intermediate    *x509.Certificate
+	IntermediateKey *ecdsa.PrivateKey
+}
+
+// NewCA generates a root and an intermediate certificate valid from an hour
+// ago for a year.
+func NewCA() (*CA, error) {
+	now := time.Now()
+	return NewCAWithValidity(now.Add(-time.Hour), now.AddDate(1, 0, 0))
+}
+
+// NewCAWithValidity generates a root and an intermediate certificate valid
+// from notBefore to notAfter, e.g. to fabricate historical documents.
+func NewCAWithValidity(notBefore, notAfter time.Time) (*CA, error) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	root, err := createCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test.nitro-enclaves"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}, nil, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	intermediate, err := createCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "intermediate.test.nitro-enclaves"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}, root, &intermediateKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{Root: root, RootKey: rootKey, Intermediate: intermediate, IntermediateKey: intermediateKey}, nil
+}
+
+// Roots returns a pool holding the root certificate, for attestation.VerifyOptions.
+func (ca *CA) Roots() *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root)
+	return roots
+}
+
+// RootPEM returns the root certificate in PEM format.
+func (ca *CA) RootPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+}
+
+// CABundle returns the cabundle field of documents: the root followed by the
+// intermediate, in the order used by the NSM.
+func (ca *CA) CABundle() [][]byte {
+	return [][]byte{ca.Root.Raw, ca.Intermediate.Raw}
+}
+
+// IssueLeaf issues a document signing certificate with the given validity and
+// an ECDSA P-384 key.
+func (ca *CA) IssueLeaf(notBefore, notAfter time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaf, err := createCertificate(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: ModuleID + ".test.nitro-enclaves"},
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}, ca.Intermediate, &key.PublicKey, ca.IntermediateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return leaf, key, nil
+}
+
+func createCertificate(template, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.Signer) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate %q: %w", template.Subject.CommonName, err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Document describes an attestation document to fabricate: the payload fields
+// in Nitro order and the parameters of its COSE_Sign1 envelope.
+type Document struct {
+	ModuleID    string
+	Digest      string
+	Timestamp   uint64 // milliseconds since the Unix epoch
+	PCRs        map[int][]byte
+	Certificate []byte
+	CABundle    [][]byte
+	PublicKey   []byte
+	UserData    []byte
+	Nonce       []byte
+
+	// Algorithm is the alg value of the protected header. The signature is
+	// always computed with ES384, so any other value yields a document whose
+	// header disagrees with its signature.
+	Algorithm cose.Algorithm
+
+	// Key signs the document. It is normally the key of Certificate.
+	Key *ecdsa.PrivateKey
+
+	// Tagged wraps the message in the COSE_Sign1 CBOR tag (18). The NSM emits
+	// untagged messages.
+	Tagged bool
+}
+
+// nitroPayload is the CBOR layout of the NSM: fields in this order, optional
+// fields present as null when empty, and PCRs sorted by index.
+type nitroPayload struct {
+	ModuleID    string          `cbor:"module_id"`
+	Digest      string          `cbor:"digest"`
+	Timestamp   uint64          `cbor:"timestamp"`
+	PCRs        cbor.RawMessage `cbor:"pcrs"`
+	Certificate []byte          `cbor:"certificate"`
+	CABundle    [][]byte        `cbor:"cabundle"`
+	PublicKey   []byte          `cbor:"public_key"`
+	UserData    []byte          `cbor:"user_data"`
+	Nonce       []byte          `cbor:"nonce"`
+}
+
+var sortedEncMode, _ = cbor.CoreDetEncOptions().EncMode()
+
+// Payload returns the CBOR encoded payload of d.
+func (d *Document) Payload() ([]byte, error) {
+	pcrs, err := sortedEncMode.Marshal(d.PCRs)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(nitroPayload{
+		ModuleID:    d.ModuleID,
+		Digest:      d.Digest,
+		Timestamp:   d.Timestamp,
+		PCRs:        pcrs,
+		Certificate: d.Certificate,
+		CABundle:    d.CABundle,
+		PublicKey:   d.PublicKey,
+		UserData:    d.UserData,
+		Nonce:       d.Nonce,
+	})
+}
+
+// Marshal encodes and signs d as a COSE_Sign1 message.
+func (d *Document) Marshal() ([]byte, error) {
+	payload, err := d.Payload()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	return Sign(payload, d.Algorithm, d.Key, d.Tagged)
+}
+
+// Sign wraps payload in a COSE_Sign1 message whose protected header names alg
+// and whose signature is computed with ES384 by key.
+func Sign(payload []byte, alg cose.Algorithm, key *ecdsa.PrivateKey, tagged bool) ([]byte, error) {
+	es384, err := cose.NewSigner(cose.AlgorithmES384, key)
+	if err != nil {
+		return nil, err
+	}
+	msg := cose.Sign1Message{
+		Headers: cose.Headers{
+			Protected: cose.ProtectedHeader{cose.HeaderLabelAlgorithm: alg},
+		},
+		Payload: payload,
+	}
+	if err := msg.Sign(rand.Reader, nil, &algSigner{alg: alg, signer: es384}); err != nil {
+		return nil, fmt.Errorf("failed to sign document: %w", err)
+	}
+	if tagged {
+		return msg.MarshalCBOR()
+	}
+	untagged := cose.UntaggedSign1Message(msg)
+	return untagged.MarshalCBOR()
+}
+
+// algSigner reports alg to go-cose while signing with ES384.
+type algSigner struct {
+	alg    cose.Algorithm
+	signer cose.Signer
+}
+
+func (s *algSigner) Algorithm() cose.Algorithm { return s.alg }
+
+func (s *algSigner) Sign(rand io.Reader, content []byte) ([]byte, error) {
+	return s.signer.Sign(rand, content)
+}
+
+// NSM is an attester.Attester that signs documents with a test CA, standing in
+// for the Nitro Secure Module.
+type NSM struct {
+	CA       *CA
+	ModuleID string
+	PCRs     map[int][]byte
+
+	// Now returns the document timestamp and the leaf validity start. It
+	// defaults to time.Now.
+	Now func() time.Time
+
+	// Tamper, if set, is called on every document before it is signed.
+	Tamper func(*Document)
+
+	mu      sync.Mutex
+	leaf    *x509.Certificate
+	leafKey *ecdsa.PrivateKey
+}
+
+var _ attester.Attester = (*NSM)(nil)
+
+// NewNSM returns an NSM with a new CA and the PCRs of TestPCRs.
+func NewNSM() (*NSM, error) {
+	ca, err := NewCA()
+	if err != nil {
+		return nil, err
+	}
+	return &NSM{CA: ca, ModuleID: ModuleID, PCRs: TestPCRs()}, nil
+}
+
+// TestPCRs returns 16 SHA-384 sized PCRs where PCR i is filled with byte i.
+func TestPCRs() map[int][]byte {
+	pcrs := make(map[int][]byte, 16)
+	for i := 0; i < 16; i++ {
+		pcr := make([]byte, 48)
+		for j := range pcr {
+			pcr[j] = byte(i)
+		}
+		pcrs[i] = pcr
+	}
+	return pcrs
+}
+
+func (n *NSM) now() time.Time {
+	if n.Now != nil {
+		return n.Now()
+	}
+	return time.Now()
+}
+
+// NewDocument returns a well-formed document for the given request fields,
+// signed by a leaf certificate valid for three hours from now.
+func (n *NSM) NewDocument(nonce, userData, publicKey []byte) (*Document, error) {
+	now := n.now()
+
+	n.mu.Lock()
+	if n.leaf == nil || now.Before(n.leaf.NotBefore) || now.After(n.leaf.NotAfter) {
+		leaf, key, err := n.CA.IssueLeaf(now.Add(-time.Minute), now.Add(3*time.Hour))
+		if err != nil {
+			n.mu.Unlock()
+			return nil, err
+		}
+		n.leaf, n.leafKey = leaf, key
+	}
+	leaf, key := n.leaf, n.leafKey
+	n.mu.Unlock()
+
+	pcrs := make(map[int][]byte, len(n.PCRs))
+	for i, pcr := range n.PCRs {
+		pcrs[i] = append([]byte(nil), pcr...)
+	}
+	return &Document{
+		ModuleID:    n.ModuleID,
+		Digest:      "SHA384",
+		Timestamp:   uint64(now.UnixMilli()),
+		PCRs:        pcrs,
+		Certificate: leaf.Raw,
+		CABundle:    n.CA.CABundle(),
+		PublicKey:   publicKey,
+		UserData:    userData,
+		Nonce:       nonce,
+		Algorithm:   cose.AlgorithmES384,
+		Key:         key,
+	}, nil
+}
+
+// Attest returns a signed attestation document, applying Tamper if set.
+func (n *NSM) Attest(nonce, userData, publicKey []byte) ([]byte, error) {
+	doc, err := n.NewDocument(nonce, userData, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if n.Tamper != nil {
+		n.Tamper(doc)
+	}
+	return doc.Marshal()
+}
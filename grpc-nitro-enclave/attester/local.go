@@ -0,0 +1,153 @@
+package attester
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+)
+
+// LocalModuleID is the module_id of documents produced by Local.
+const LocalModuleID = "i-00000000000000000-enc0000000000000000"
+
+// localCertLifetime is the validity of the signing certificates of Local. NSM
+// certificates are similarly short-lived, so Local renews them on demand.
+const localCertLifetime = 3 * time.Hour
+
+// Local produces attestation documents in the Nitro layout for development
+// outside an enclave. Documents are signed with ES384 by a certificate issued
+// by a root generated at startup; clients must trust RootPEM to verify them.
+// Like an enclave started in debug mode, all PCRs are zero.
+type Local struct {
+	root    *x509.Certificate
+	rootKey *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	leaf     *x509.Certificate
+	leafSign cose.Signer
+}
+
+// NewLocal creates a local attester with a fresh root certificate.
+func NewLocal() (*Local, error) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate root key: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "local.nitro-enclaves"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create root certificate: %w", err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{root: root, rootKey: rootKey}, nil
+}
+
+// RootPEM returns the root certificate that signs the documents of l.
+func (l *Local) RootPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: l.root.Raw})
+}
+
+// signer returns the current signing certificate, issuing a new one when the
+// previous one is about to expire.
+func (l *Local) signer() (*x509.Certificate, cose.Signer, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.leaf != nil && time.Until(l.leaf.NotAfter) > localCertLifetime/2 {
+		return l.leaf, l.leafSign, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: LocalModuleID + ".local.nitro-enclaves"},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(localCertLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, l.root, &key.PublicKey, l.rootKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create signing certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, err := cose.NewSigner(cose.AlgorithmES384, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l.leaf, l.leafSign = leaf, signer
+	return leaf, signer, nil
+}
+
+// Attest returns a signed attestation document in the Nitro layout.
+func (l *Local) Attest(nonce, userData, publicKey []byte) ([]byte, error) {
+	leaf, signer, err := l.signer()
+	if err != nil {
+		return nil, err
+	}
+
+	pcrs := make(map[int][]byte, 16)
+	for i := 0; i < 16; i++ {
+		pcrs[i] = make([]byte, 48)
+	}
+	payload, err := cbor.Marshal(attestation.AttestationDocument{
+		ModuleID:    LocalModuleID,
+		Timestamp:   uint64(time.Now().UnixMilli()),
+		Digest:      "SHA384",
+		PCRs:        pcrs,
+		Certificate: leaf.Raw,
+		CABundle:    [][]byte{l.root.Raw},
+		PublicKey:   publicKey,
+		UserData:    userData,
+		Nonce:       nonce,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attestation document: %w", err)
+	}
+
+	msg := cose.Sign1Message{
+		Headers: cose.Headers{
+			Protected: cose.ProtectedHeader{cose.HeaderLabelAlgorithm: cose.AlgorithmES384},
+		},
+		Payload: payload,
+	}
+	if err := msg.Sign(rand.Reader, nil, signer); err != nil {
+		return nil, fmt.Errorf("failed to sign attestation document: %w", err)
+	}
+	untagged := cose.UntaggedSign1Message(msg)
+	return untagged.MarshalCBOR()
+}
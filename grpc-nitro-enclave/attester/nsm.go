@@ -0,0 +1,50 @@
+package attester
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hf/nsm"
+	"github.com/hf/nsm/request"
+)
+
+// NSM obtains attestation documents from the Nitro Secure Module through /dev/nsm.
+type NSM struct {
+	sess *nsm.Session
+}
+
+// OpenNSM opens a session with the Nitro Secure Module. It fails outside an enclave.
+func OpenNSM() (*NSM, error) {
+	sess, err := nsm.OpenDefaultSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open NSM session: %w", err)
+	}
+	return &NSM{sess: sess}, nil
+}
+
+// Attest uses AWS NSM to obtain an attestation document.
+func (n *NSM) Attest(nonce, userData, publicKey []byte) ([]byte, error) {
+	res, err := n.sess.Send(&request.Attestation{
+		Nonce:     nonce,
+		UserData:  userData,
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Error != "" {
+		return nil, fmt.Errorf("NSM error: %s", res.Error)
+	}
+
+	if res.Attestation == nil || res.Attestation.Document == nil {
+		return nil, errors.New("NSM device did not return an attestation")
+	}
+
+	return res.Attestation.Document, nil
+}
+
+// Close closes the NSM session.
+func (n *NSM) Close() error {
+	return n.sess.Close()
+}
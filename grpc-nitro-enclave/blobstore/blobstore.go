@@ -0,0 +1,104 @@
+// Package blobstore implements BlobStore on the parent instance, keeping each
+// blob in a file of a directory. Blobs are sealed by the enclave, so the
+// store only needs to keep them, not to protect them.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/blobstore"
+)
+
+// MaxBlobSize is the largest accepted blob, below the default gRPC message size limit.
+const MaxBlobSize = 3 << 20
+
+// validName matches the accepted blob names, which are used as file names.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Server implements BlobStore.
+type Server struct {
+	pb.UnimplementedBlobStoreServer
+	dir string
+}
+
+// NewServer returns a BlobStore keeping blobs in dir, which is created if needed.
+func NewServer(dir string) (*Server, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &Server{dir: dir}, nil
+}
+
+func (s *Server) path(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", status.Errorf(codes.InvalidArgument, "invalid blob name %q", name)
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+func (s *Server) Put(ctx context.Context, in *pb.PutRequest) (*pb.PutResponse, error) {
+	path, err := s.path(in.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if len(in.GetData()) > MaxBlobSize {
+		return nil, status.Errorf(codes.InvalidArgument, "blob is %d bytes, the limit is %d", len(in.GetData()), MaxBlobSize)
+	}
+
+	// Write to a temporary file and rename it, so that a crash never leaves a partial blob
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to store blob: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(in.GetData()); err != nil {
+		tmp.Close()
+		return nil, status.Errorf(codes.Internal, "failed to store blob: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, status.Errorf(codes.Internal, "failed to store blob: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to store blob: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to store blob: %v", err)
+	}
+	return &pb.PutResponse{}, nil
+}
+
+func (s *Server) Get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, error) {
+	path, err := s.path(in.GetName())
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, status.Errorf(codes.NotFound, "no blob %q", in.GetName())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read blob: %v", err)
+	}
+	return &pb.GetResponse{Data: data}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, in *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	path, err := s.path(in.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, status.Errorf(codes.Internal, "failed to delete blob: %v", err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
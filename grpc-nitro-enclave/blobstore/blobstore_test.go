@@ -0,0 +1,48 @@
+package blobstore_test
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/blobstore"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/blobstore"
+)
+
+func TestServer(t *testing.T) {
+	s, err := blobstore.NewServer(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, &pb.GetRequest{Name: "state"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Get of a missing blob error = %v, want NotFound", err)
+	}
+	for _, data := range []string{"first", "second"} {
+		if _, err := s.Put(ctx, &pb.PutRequest{Name: "state", Data: []byte(data)}); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		r, err := s.Get(ctx, &pb.GetRequest{Name: "state"})
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if string(r.GetData()) != data {
+			t.Errorf("Get = %q, want %q", r.GetData(), data)
+		}
+	}
+	if _, err := s.Delete(ctx, &pb.DeleteRequest{Name: "state"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Delete(ctx, &pb.DeleteRequest{Name: "state"}); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+
+	for _, name := range []string{"", ".", "..", "../state", "a/b", ".tmp-1", string(make([]byte, 200))} {
+		if _, err := s.Put(ctx, &pb.PutRequest{Name: name, Data: []byte("x")}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Put(%q) error = %v, want InvalidArgument", name, err)
+		}
+	}
+}
@@ -1,12 +1,18 @@
+//go:build ignore
+
+// The client is a standalone program: build it with `go build client.go`.
+// The ignore build tag keeps it out of `go build ./...`, as server.go
+// is a separate program in the same directory.
 package main
 
 import (
     "archive/zip"
+    "bytes"
     "context"
     "crypto/sha256"
-    "crypto/x509"
-    "encoding/pem"
+    "encoding/base64"
     "errors"
+    "flag"
     "fmt"
     "io"
     "log"
@@ -14,90 +20,283 @@ import (
     "os"
     "time"
 
-    "github.com/fxamacker/cbor/v2"
-    "github.com/veraison/go-cose"
+    "github.com/prometheus/client_golang/prometheus"
+    "go.opentelemetry.io/otel/attribute"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/trace"
+    "go.opentelemetry.io/otel/trace/noop"
     "google.golang.org/grpc"
-    pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/config"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/echoclient"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/metrics"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/tracing"
 )
 
-const (
-    address        = "localhost:50051"
-    defaultMessage = "Hello from client!"
+const defaultMessage = "Hello from client!"
+
+// registry holds the verification metrics, written to metricsFile on exit if set.
+var (
+    registry    = prometheus.NewRegistry()
+    metricsFile string
 )
 
-// AttestationDocument represents the structure of the attestation payload.
-type AttestationDocument struct {
-	ModuleID    string         `cbor:"module_id"`
-	Timestamp   uint64         `cbor:"timestamp"`
-	Digest      string         `cbor:"digest"`
-	PCRs        map[int][]byte `cbor:"pcrs"`
-	Certificate []byte         `cbor:"certificate"`
-	CABundle    [][]byte       `cbor:"cabundle"`
-	PublicKey   []byte         `cbor:"public_key,omitempty"`
-	UserData    []byte         `cbor:"user_data,omitempty"`
-	Nonce       []byte         `cbor:"nonce,omitempty"`
+// writeMetrics writes the verification metrics to metricsFile, if set.
+func writeMetrics() {
+    if metricsFile == "" {
+        return
+    }
+    if err := prometheus.WriteToTextfile(metricsFile, registry); err != nil {
+        log.Printf("Failed to write metrics: %v", err)
+    }
 }
 
-func main() {
-    // Set up a connection to the server.
-    conn, err := grpc.Dial(address, grpc.WithInsecure())
+// provider exports the spans of the client if tracing is enabled, and runSpan
+// is the root span of the run.
+var (
+    provider *sdktrace.TracerProvider
+    runSpan  = trace.SpanFromContext(context.Background())
+)
+
+// newTracerProvider returns the tracer provider configured by cfg, or nil if
+// tracing is disabled.
+func newTracerProvider(ctx context.Context, cfg config.ClientTracing) (*sdktrace.TracerProvider, error) {
+    var exp sdktrace.SpanExporter
+    var err error
+    switch {
+    case cfg.File != "":
+        exp, err = tracing.OpenFileExporter(cfg.File)
+    case cfg.Endpoint != "":
+        exp, err = tracing.NewOTLPExporter(ctx, cfg.Endpoint, nil)
+    default:
+        return nil, nil
+    }
     if err != nil {
-        log.Fatalf("did not connect: %v", err)
+        return nil, err
     }
-    defer conn.Close()
-    c := pb.NewEchoServiceClient(conn)
+    return tracing.NewProvider(cfg.ServiceName, exp), nil
+}
 
-    // Prepare the message.
-    message := defaultMessage
-    if len(os.Args) > 1 {
-        message = os.Args[1]
+// shutdownTracing ends the root span with err and exports the remaining spans.
+func shutdownTracing(err error) {
+    tracing.RecordError(runSpan, err)
+    runSpan.End()
+    if provider == nil {
+        return
     }
-
-    // Record the start time.
-    startTime := time.Now()
-
-    // Create a context with timeout.
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
+    if err := provider.Shutdown(ctx); err != nil {
+        log.Printf("Failed to export spans: %v", err)
+    }
+}
+
+// fatalf writes the metrics and exports the spans, so that failed
+// verifications are recorded, and exits like log.Fatalf.
+func fatalf(format string, v ...any) {
+    writeMetrics()
+    shutdownTracing(fmt.Errorf(format, v...))
+    log.Fatalf(format, v...)
+}
 
-    // Make the gRPC call.
-    r, err := c.Echo(ctx, &pb.EchoRequest{Message: message})
+func main() {
+    cfg := config.DefaultClient()
+    args, err := config.Load("client", os.Args[1:], cfg)
     if err != nil {
-        log.Fatalf("could not echo: %v", err)
+        if errors.Is(err, flag.ErrHelp) {
+            return
+        }
+        log.Fatalf("%v", err)
     }
 
-    // Record the end time.
-    endTime := time.Now()
-
-    // Calculate the elapsed time.
-    elapsed := endTime.Sub(startTime)
+    // Refresh the root certificate on explicit request only.
+    if cfg.RefreshRoot != "" {
+        rootCertPEM, err := downloadAndVerifyRootCert(cfg.RootCertURL, cfg.RootCertHash)
+        if err != nil {
+            log.Fatalf("Failed to obtain root certificate: %v", err)
+        }
+        if err := os.WriteFile(cfg.RefreshRoot, rootCertPEM, 0644); err != nil {
+            log.Fatalf("Failed to write root certificate: %v", err)
+        }
+        log.Printf("Root certificate written to %s", cfg.RefreshRoot)
+        return
+    }
 
-    // Verify the attestation document received from the server
-    attestationDoc := r.GetAttestationDocument()
-    if len(attestationDoc) == 0 {
-        log.Fatalf("No attestation document received from server")
+    // Trace the run. The trace context is propagated to the server in the
+    // metadata of every call.
+    provider, err = newTracerProvider(context.Background(), cfg.Tracing)
+    if err != nil {
+        log.Fatalf("Failed to set up tracing: %v", err)
+    }
+    var tp trace.TracerProvider = noop.NewTracerProvider()
+    if provider != nil {
+        tp = provider
     }
+    var runCtx context.Context
+    runCtx, runSpan = tp.Tracer(tracing.ScopeName).Start(context.Background(), "client")
+    defer shutdownTracing(nil)
 
-    // Download and verify the AWS Nitro Enclaves root certificate
-    rootCertPEM, err := downloadAndVerifyRootCert(
-        "https://aws-nitro-enclaves.amazonaws.com/AWS_NitroEnclaves_Root-G1.zip",
-        "8cf60e2b2efca96c6a9e71e851d00c1b6991cc09eadbe64a6a1d1b1eb9faff7c",
-    )
+    // Load the trusted root certificates. Without a file, the embedded AWS root is used.
+    _, span := tracing.Start(runCtx, "load_roots", trace.WithAttributes(attribute.String("root_cert.file", cfg.RootCert)))
+    roots := attestation.AWSNitroRoots()
+    if cfg.RootCert != "" {
+        roots, err = attestation.LoadRoots(cfg.RootCert)
+        tracing.RecordError(span, err)
+    }
+    span.End()
     if err != nil {
-        log.Fatalf("Failed to obtain root certificate: %v", err)
+        fatalf("Failed to load root certificate: %v", err)
     }
 
-    // Call the verification function
-    err = verifyAttestationDocument(attestationDoc, rootCertPEM)
+    // Load the expected enclave measurements, if configured.
+    var pcrPolicy *attestation.PCRPolicy
+    if cfg.PCRPolicy != "" {
+        pcrPolicy, err = attestation.LoadPCRPolicy(cfg.PCRPolicy)
+        if err != nil {
+            fatalf("Failed to load PCR policy: %v", err)
+        }
+    }
+
+    // Record the verifications, written in Prometheus text format on exit
+    metricsFile = cfg.MetricsFile
+    clientMetrics := metrics.NewClient(registry)
+    defer writeMetrics()
+
+    // Set up a connection to the server. The TLS certificate is only accepted
+    // if it is bound to a verified attestation document, which is verified
+    // once per server key, also across reconnections.
+    dialCtx, span := tracing.Start(runCtx, "dial", trace.WithAttributes(attribute.String("server.address", cfg.Address)))
+    c, err := echoclient.Dial(cfg.Address, attestation.VerifyOptions{
+        Roots:  roots,
+        Policy: pcrPolicy,
+    }, clientMetrics, grpc.WithStatsHandler(tracing.ClientHandler(tp)))
     if err != nil {
-        log.Fatalf("Attestation document verification failed: %v", err)
+        tracing.RecordError(span, err)
+        span.End()
+        fatalf("did not connect: %v", err)
     }
+    defer c.Close()
 
-    log.Println("Attestation document verified successfully")
+    // Connect before the first call, so that its round-trip time does not
+    // include the TLS handshake. If connecting fails, the first call reports why.
+    ctx, cancel := context.WithTimeout(dialCtx, cfg.Timeout)
+    tracing.RecordError(span, c.Connect(ctx))
+    cancel()
+    span.End()
 
-    // Log the response and the elapsed time.
-    log.Printf("Server response: %s", r.GetMessage())
-    log.Printf("Round-trip time: %v", elapsed)
+    // Prepare the message.
+    message := defaultMessage
+    if len(args) > 0 {
+        message = args[0]
+    }
+
+    if cfg.GetAttestation {
+        ctx, cancel := context.WithTimeout(runCtx, cfg.Timeout)
+        defer cancel()
+        raw, _, err := c.Attest(ctx, nil, nil)
+        if err != nil {
+            fatalf("could not get attestation document: %v", err)
+        }
+        fmt.Println(base64.StdEncoding.EncodeToString(raw))
+        return
+    }
+
+    if cfg.Stream != "" {
+        echoStream(runCtx, c, cfg.Stream, message, cfg.Count, cfg.StreamTimeout)
+        return
+    }
+
+    for i := 0; i < cfg.Count; i++ {
+        // Record the start time.
+        startTime := time.Now()
+
+        // Create a context with timeout, traced as one span per call.
+        ctx, span := tracing.Start(runCtx, "echo", trace.WithAttributes(attribute.Int("echo.call", i), attribute.Bool("echo.signed", cfg.Signed)))
+        ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+
+        // Make the gRPC call. Each call sends a fresh nonce, and the response
+        // is either signed with the attested signing key or carries an
+        // attestation document binding the nonce and a hash of the response message.
+        var r string
+        if cfg.Signed {
+            r, err = c.Echo(ctx, message)
+        } else {
+            r, err = c.EchoAttested(ctx, message)
+        }
+        cancel()
+        tracing.RecordError(span, err)
+        span.End()
+        if err != nil {
+            fatalf("could not echo: %v", err)
+        }
+
+        if cfg.Signed {
+            log.Println("Response signature verified successfully")
+        } else {
+            log.Println("Attestation document verified successfully")
+        }
+
+        // Log the response and the elapsed time.
+        log.Printf("Server response: %s", r)
+        log.Printf("Round-trip time: %v", time.Since(startTime))
+    }
+}
+
+// echoStream sends count messages on one stream of the given kind. The stream
+// is attested once at its start, and every response is verified against that
+// attestation.
+func echoStream(ctx context.Context, c *echoclient.Client, kind, message string, count int, timeout time.Duration) {
+    ctx, span := tracing.Start(ctx, "stream", trace.WithAttributes(attribute.String("stream.kind", kind), attribute.Int("stream.count", count)))
+    defer span.End()
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    startTime := time.Now()
+    var responses int
+    switch kind {
+    case "server":
+        err := c.EchoServerStream(ctx, message, uint32(count), func(string) error {
+            responses++
+            return nil
+        })
+        if err != nil {
+            fatalf("server stream failed: %v", err)
+        }
+    case "client":
+        messages := make([]string, count)
+        for i := range messages {
+            messages[i] = message
+        }
+        if _, err := c.EchoClientStream(ctx, messages); err != nil {
+            fatalf("client stream failed: %v", err)
+        }
+        responses = 1
+    case "bidi":
+        s, err := c.EchoStream(ctx)
+        if err != nil {
+            fatalf("could not open stream: %v", err)
+        }
+        defer s.Close()
+        go func() {
+            for i := 0; i < count; i++ {
+                if err := s.Send(message); err != nil {
+                    return
+                }
+            }
+            s.CloseSend()
+        }()
+        for ; responses < count; responses++ {
+            if _, err := s.Recv(); err != nil {
+                fatalf("bidi stream failed: %v", err)
+            }
+        }
+    default:
+        fatalf("Unknown stream kind %q, expected server, client or bidi", kind)
+    }
+
+    elapsed := time.Since(startTime)
+    log.Printf("Stream attested once, %d signed responses verified", responses)
+    log.Printf("Sent %d messages in %v (%.0f messages/s)", count, elapsed, float64(count)/elapsed.Seconds())
 }
 
 // Function to download and verify the root certificate
@@ -127,37 +326,26 @@ func downloadAndVerifyRootCert(url, expectedHash string) ([]byte, error) {
         return nil, fmt.Errorf("root certificate hash mismatch: expected %s, got %s", expectedHash, hashString)
     }
 
-    // Get the current working directory
-    cwd, err := os.Getwd()
+    // Unzip the archive in memory and extract the PEM file
+    pemData, err := extractPEMFromZip(zipData)
     if err != nil {
-        return nil, fmt.Errorf("failed to get current working directory: %v", err)
-    }
-
-    // Construct the file path
-    zipFilePath := fmt.Sprintf("%s/AWS_NitroEnclaves_Root-G1.zip", cwd)
-
-    // Save zip file temporarily
-    err = os.WriteFile(zipFilePath, zipData, 0644)
-    if err != nil {
-        return nil, fmt.Errorf("failed to save zip file: %v", err)
+        return nil, fmt.Errorf("failed to extract PEM file: %v", err)
     }
-    defer os.Remove(zipFilePath)
 
-    // Unzip the file and extract the PEM file
-    pemData, err := extractPEMFromZip(zipFilePath)
-    if err != nil {
-        return nil, fmt.Errorf("failed to extract PEM file: %v", err)
+    // Make sure the archive contained a usable certificate
+    if _, err := attestation.ParseRoots(pemData); err != nil {
+        return nil, fmt.Errorf("invalid root certificate: %v", err)
     }
 
     return pemData, nil
 }
-func extractPEMFromZip(zipFilePath string) ([]byte, error) {
-    // Open the zip file
-    zipReader, err := zip.OpenReader(zipFilePath)
+
+func extractPEMFromZip(zipData []byte) ([]byte, error) {
+    // Open the zip archive
+    zipReader, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
     if err != nil {
         return nil, fmt.Errorf("failed to open zip file: %v", err)
     }
-    defer zipReader.Close()
 
     // Look for the .pem file
     for _, file := range zipReader.File {
@@ -178,196 +366,3 @@ func extractPEMFromZip(zipFilePath string) ([]byte, error) {
 
     return nil, errors.New("PEM file not found in zip archive")
 }
-// Function to verify the attestation document
-func verifyAttestationDocument(attestationDoc []byte, rootCertPEM []byte) error {
-    
-    // Parse the COSE message
-	attestationMap := cose.UntaggedSign1Message{}
-	err := attestationMap.UnmarshalCBOR(attestationDoc)
-	if err != nil {
-		log.Fatalf("failed to unmarshal COSE message: %v", err)
-	}
-
-    // Unmarshal the Payload into AttestationDocument
-    if len(attestationMap.Payload) == 0 {
-        return errors.New("Payload is empty in the attestation document")
-    }
-
-    var attestationDocStruct AttestationDocument
-    err = cbor.Unmarshal(attestationMap.Payload, &attestationDocStruct)
-    if err != nil {
-        return fmt.Errorf("FAILED to unmarshal Payload as AttestationDocument: %v", err)
-    }
-
-    // Syntactic Validation
-    err = validateAttestationDocumentFields(attestationDocStruct)
-    if err != nil {
-        return fmt.Errorf("Syntactic validation failed: %v", err)
-    }
-
-    // Parse Root Certificate
-    rootCert, err := parseCertificate(rootCertPEM)
-    if err != nil {
-        return fmt.Errorf("Failed to parse root certificate: %v", err)
-    }
-
-    // Parse and Validate Certificate Chain
-    _, err = buildCertificateChain(attestationDocStruct.Certificate, attestationDocStruct.CABundle, rootCert)
-    if err != nil {
-        return fmt.Errorf("Certificate chain validation failed: %v", err)
-    }
-
-    // Step 7: Verify COSE Signature 
-    // Parse the attestation certificate to get the public key
-    attestationCert, err := parseCertificate(attestationDocStruct.Certificate)
-    if err != nil {
-        return fmt.Errorf("Failed to parse attestation certificate: %v", err)
-    }
-
-    publicKey := attestationCert.PublicKey
-
-    // Assume the algorithm is always ECDSA with SHA-384
-    alg := cose.AlgorithmES384
-
-    // Create a verifier using the algorithm and public key
-    verifier, err := cose.NewVerifier(alg, publicKey)
-    if err != nil {
-        return fmt.Errorf("Failed to create COSE verifier: %v", err)
-    }
-
-    // Verify the COSE_Sign1 signature
-    err = attestationMap.Verify(nil, verifier)
-    if err != nil {
-        return fmt.Errorf("COSE signature verification failed: %v", err)
-    }
-
-    log.Println("COSE signature verified successfully!")
-
-    return nil
-}
-
-// parseCertificate parses a PEM or DER encoded certificate.
-func parseCertificate(certBytes []byte) (*x509.Certificate, error) {
-    // Attempt to parse as PEM
-    block, _ := pem.Decode(certBytes)
-    if block != nil && block.Type == "CERTIFICATE" {
-        return x509.ParseCertificate(block.Bytes)
-    }
-    // Attempt to parse as DER
-    return x509.ParseCertificate(certBytes)
-}
-
-// buildCertificateChain builds and validates the certificate chain.
-func buildCertificateChain(targetCertBytes []byte, caBundleBytes [][]byte, rootCert *x509.Certificate) ([]*x509.Certificate, error) {
-    // Parse target certificate
-    targetCert, err := parseCertificate(targetCertBytes)
-    if err != nil {
-        return nil, fmt.Errorf("failed to parse target certificate: %v", err)
-    }
-
-    // Parse CA bundle certificates
-    var intermediateCerts []*x509.Certificate
-    for i, caCertBytes := range caBundleBytes {
-        cert, err := parseCertificate(caCertBytes)
-        if err != nil {
-            return nil, fmt.Errorf("failed to parse cabundle[%d]: %v", i, err)
-        }
-        intermediateCerts = append(intermediateCerts, cert)
-    }
-
-    // Create certificate pool for intermediates
-    intermediatesPool := x509.NewCertPool()
-    for _, cert := range intermediateCerts {
-        intermediatesPool.AddCert(cert)
-    }
-
-    // Create certificate pool for root
-    roots := x509.NewCertPool()
-    roots.AddCert(rootCert)
-
-    // Set up verification options
-    opts := x509.VerifyOptions{
-        Roots:         roots,
-        Intermediates: intermediatesPool,
-        CurrentTime:   time.Now(),
-        KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
-    }
-
-    // Verify the certificate chain
-    chains, err := targetCert.Verify(opts)
-    if err != nil {
-        return nil, fmt.Errorf("certificate verification failed: %v", err)
-    }
-
-    // For further semantic validation, you might need to traverse the chain
-    // Here, we simply return the first valid chain
-    if len(chains) == 0 {
-        return nil, errors.New("no valid certificate chains found")
-    }
-
-    return chains[0], nil
-}
-
-// validateAttestationDocumentFields performs syntactic validation of the attestation document.
-func validateAttestationDocumentFields(doc AttestationDocument) error {
-    // Check mandatory fields are non-empty
-    if doc.ModuleID == "" {
-        return errors.New("module_id is missing or empty")
-    }
-    if doc.Digest == "" {
-        return errors.New("digest is missing or empty")
-    }
-    if doc.Timestamp == 0 {
-        return errors.New("timestamp is missing or zero")
-    }
-    if len(doc.PCRs) == 0 {
-        return errors.New("pcrs is missing or empty")
-    }
-    if len(doc.Certificate) == 0 {
-        return errors.New("certificate is missing or empty")
-    }
-    if len(doc.CABundle) == 0 {
-        return errors.New("cabundle is missing or empty")
-    }
-
-    // Validate 'digest' field
-    if doc.Digest != "SHA384" {
-        return fmt.Errorf("invalid digest value: %s", doc.Digest)
-    }
-
-    // Validate 'pcrs' field
-    if len(doc.PCRs) < 1 || len(doc.PCRs) > 32 {
-        return fmt.Errorf("pcrs size out of bounds: %d", len(doc.PCRs))
-    }
-    for idx, pcr := range doc.PCRs {
-        if idx < 0 || idx >= 32 {
-            return fmt.Errorf("invalid PCR index: %d", idx)
-        }
-        if len(pcr) != 32 && len(pcr) != 48 && len(pcr) != 64 {
-            return fmt.Errorf("invalid PCR length for index %d: %d", idx, len(pcr))
-        }
-    }
-
-    // Validate 'cabundle' field
-    for i, cert := range doc.CABundle {
-        if len(cert) < 1 || len(cert) > 1024 {
-            return fmt.Errorf("invalid cabundle[%d] length: %d", i, len(cert))
-        }
-    }
-
-    // Validate optional fields
-    if len(doc.PublicKey) > 0 && len(doc.PublicKey) > 1024 {
-        return fmt.Errorf("public_key length exceeds limit: %d", len(doc.PublicKey))
-    }
-    if len(doc.UserData) > 512 {
-        return fmt.Errorf("user_data length exceeds limit: %d", len(doc.UserData))
-    }
-    if len(doc.Nonce) > 512 {
-        return fmt.Errorf("nonce length exceeds limit: %d", len(doc.Nonce))
-    }
-
-    log.Println("Attestation document fields validated")
-
-    return nil
-}
-
@@ -0,0 +1,52 @@
+// Command blob-store serves BlobStore on the parent instance, so that an
+// enclave can persist its sealed state across restarts.
+//
+//	blob-store -listen 5001 -dir /var/lib/enclave-blobs
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"google.golang.org/grpc"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/blobstore"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/blobstore"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/transport"
+)
+
+func main() {
+	transportName := flag.String("transport", transport.VSock, "listener transport: vsock, tcp or unix")
+	listenAddr := flag.String("listen", "5001", "vsock port, TCP host:port or unix socket path")
+	dir := flag.String("dir", "enclave-blobs", "directory holding the blobs")
+	flag.Parse()
+
+	srv, err := blobstore.NewServer(*dir)
+	if err != nil {
+		log.Fatalf("Failed to create blob store: %v", err)
+	}
+	listener, err := transport.Listen(*transportName, *listenAddr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	// Blobs are sealed by the enclave, so the channel itself needs no TLS
+	s := grpc.NewServer()
+	pb.RegisterBlobStoreServer(s, srv)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		s.GracefulStop()
+	}()
+
+	log.Printf("Storing blobs in %s, serving on %s %s", *dir, *transportName, *listenAddr)
+	if err := s.Serve(listener); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// Command fake-kms serves a local stand-in for the AWS KMS JSON API, so that
+// enclave code using KMS with attestation can be run without AWS.
+//
+//	fake-kms -listen localhost:8000 -key app=measurements.json -master-key $(openssl rand -hex 32)
+//
+// Keys given as id=policy.json only release plaintext to enclaves whose
+// attestation document matches the PCR policy; keys given as a bare id have no
+// attestation condition. Key material is derived from the master key, so
+// ciphertexts remain valid across restarts with the same master key.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/kms/fakekms"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/transport"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func main() {
+	transportName := flag.String("transport", transport.TCP, "listener transport: vsock, tcp or unix")
+	listenAddr := flag.String("listen", "localhost:8000", "vsock port, TCP host:port or unix socket path")
+	var keyFlags stringList
+	flag.Var(&keyFlags, "key", "key to create, as id or id=policy.json with the accepted PCR values (repeatable)")
+	masterKeyHex := flag.String("master-key", os.Getenv("FAKE_KMS_MASTER_KEY"), "hex master key from which key material is derived (env FAKE_KMS_MASTER_KEY, default random)")
+	rootCertFile := flag.String("root-cert", "", "PEM file with the trusted root certificates (default: embedded AWS Nitro Enclaves root)")
+	maxAge := flag.Duration("max-age", fakekms.MaxAttestationAge, "maximum age of recipient attestation documents")
+	flag.Parse()
+
+	if len(keyFlags) == 0 {
+		log.Fatalf("at least one -key is required")
+	}
+	masterKey, err := hex.DecodeString(*masterKeyHex)
+	if err != nil {
+		log.Fatalf("invalid -master-key: %v", err)
+	}
+	if len(masterKey) == 0 {
+		masterKey = make([]byte, 32)
+		if _, err := rand.Read(masterKey); err != nil {
+			log.Fatalf("Failed to generate master key: %v", err)
+		}
+		log.Printf("Using a random master key; ciphertexts will not survive a restart")
+	}
+
+	verify := attestation.VerifyOptions{MaxAge: *maxAge}
+	if *rootCertFile != "" {
+		if verify.Roots, err = attestation.LoadRoots(*rootCertFile); err != nil {
+			log.Fatalf("Failed to load root certificates: %v", err)
+		}
+	}
+
+	var keys []*fakekms.Key
+	for _, f := range keyFlags {
+		id, policyFile, _ := strings.Cut(f, "=")
+		key := &fakekms.Key{ID: id, Material: deriveKey(masterKey, id)}
+		if policyFile != "" {
+			if key.Policy, err = attestation.LoadPCRPolicy(policyFile); err != nil {
+				log.Fatalf("Failed to load PCR policy of key %q: %v", id, err)
+			}
+			log.Printf("Key %q requires attestation matching %s", id, policyFile)
+		} else {
+			log.Printf("Key %q has no attestation condition", id)
+		}
+		keys = append(keys, key)
+	}
+	srv, err := fakekms.NewServer(verify, keys...)
+	if err != nil {
+		log.Fatalf("Failed to create fake KMS: %v", err)
+	}
+
+	listener, err := transport.Listen(*transportName, *listenAddr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	log.Printf("Fake KMS listening on %s %s", *transportName, *listenAddr)
+	hs := &http.Server{Handler: srv, ReadHeaderTimeout: 10 * time.Second}
+	if err := hs.Serve(listener); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// deriveKey derives the material of key id from the master key.
+func deriveKey(masterKey []byte, id string) []byte {
+	h := hmac.New(sha256.New, masterKey)
+	h.Write([]byte("fake-kms key " + id))
+	return h.Sum(nil)
+}
@@ -0,0 +1,148 @@
+// Command key-release serves KeyReleaseService: it holds secrets and releases
+// them only to enclaves that present a fresh attestation document matching a
+// PCR policy, encrypted to the public key in that document.
+//
+//	key-release -listen 5000 -pcr-policy measurements.json -secret db-password=./db-password.txt
+//
+// A secret can have its own policy with -secret-policy, for example a sealing
+// key whose policy lists both the current and the next enclave image.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/keyrelease"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/keyrelease"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/transport"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func main() {
+	transportName := flag.String("transport", transport.VSock, "listener transport: vsock, tcp or unix")
+	listenAddr := flag.String("listen", "5000", "vsock port, TCP host:port or unix socket path")
+	var policyFiles, secretFlags, secretPolicyFlags stringList
+	flag.Var(&policyFiles, "pcr-policy", "JSON file with the accepted PCR values, as printed by nitro-cli build-enclave (repeatable)")
+	flag.Var(&secretFlags, "secret", "secret to serve, as id=file (repeatable)")
+	flag.Var(&secretPolicyFlags, "secret-policy", "PCR policy of one secret instead of -pcr-policy, as id=policy.json (repeatable)")
+	rootCertFile := flag.String("root-cert", "", "PEM file with the trusted root certificates (default: embedded AWS Nitro Enclaves root)")
+	challengeTTL := flag.Duration("challenge-ttl", keyrelease.DefaultChallengeTTL, "validity of challenge nonces and maximum age of attestation documents")
+	flag.Parse()
+
+	var policy *attestation.PCRPolicy
+	var err error
+	if len(policyFiles) > 0 {
+		if policy, err = attestation.LoadPCRPolicy(policyFiles...); err != nil {
+			log.Fatalf("Failed to load PCR policy: %v", err)
+		}
+	}
+	policies, err := loadSecretPolicies(secretPolicyFlags)
+	if err != nil {
+		log.Fatalf("Failed to load PCR policy: %v", err)
+	}
+	roots := attestation.AWSNitroRoots()
+	if *rootCertFile != "" {
+		if roots, err = attestation.LoadRoots(*rootCertFile); err != nil {
+			log.Fatalf("Failed to load root certificates: %v", err)
+		}
+	}
+	secrets, err := loadSecrets(secretFlags)
+	if err != nil {
+		log.Fatalf("Failed to load secrets: %v", err)
+	}
+
+	srv, err := keyrelease.NewServer(keyrelease.Options{
+		Secrets:      secrets,
+		Verify:       attestation.VerifyOptions{Roots: roots, Policy: policy},
+		Policies:     policies,
+		ChallengeTTL: *challengeTTL,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create key release service: %v", err)
+	}
+
+	listener, err := transport.Listen(*transportName, *listenAddr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	// Secrets are encrypted to the enclave key, so the channel itself needs no TLS
+	s := grpc.NewServer()
+	pb.RegisterKeyReleaseServiceServer(s, srv)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		timer := time.AfterFunc(10*time.Second, s.Stop)
+		defer timer.Stop()
+		s.GracefulStop()
+	}()
+
+	log.Printf("Serving %d secrets on %s %s", len(secrets), *transportName, *listenAddr)
+	if err := s.Serve(listener); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// loadSecrets reads the secrets given as id=file.
+func loadSecrets(flags []string) (map[string][]byte, error) {
+	secrets := make(map[string][]byte, len(flags))
+	for _, f := range flags {
+		id, path, ok := strings.Cut(f, "=")
+		if !ok || id == "" || path == "" {
+			return nil, fmt.Errorf("invalid secret %q, expected id=file", f)
+		}
+		if _, dup := secrets[id]; dup {
+			return nil, fmt.Errorf("duplicate secret %q", id)
+		}
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		secrets[id] = value
+	}
+	return secrets, nil
+}
+
+// loadSecretPolicies reads the PCR policies given as id=file. Policies given
+// for the same secret are combined.
+func loadSecretPolicies(flags []string) (map[string]*attestation.PCRPolicy, error) {
+	files := make(map[string][]string)
+	for _, f := range flags {
+		id, path, ok := strings.Cut(f, "=")
+		if !ok || id == "" || path == "" {
+			return nil, fmt.Errorf("invalid secret policy %q, expected id=file", f)
+		}
+		files[id] = append(files[id], path)
+	}
+	policies := make(map[string]*attestation.PCRPolicy, len(files))
+	for id, paths := range files {
+		policy, err := attestation.LoadPCRPolicy(paths...)
+		if err != nil {
+			return nil, err
+		}
+		policies[id] = policy
+	}
+	return policies, nil
+}
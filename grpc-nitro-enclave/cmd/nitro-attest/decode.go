@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+)
+
+// documentView is the JSON form of an attestation document: binary fields in
+// hex and certificates summarized.
+type documentView struct {
+	ModuleID    string            `json:"module_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Digest      string            `json:"digest"`
+	PCRs        []pcrView         `json:"pcrs"`
+	Certificate certificateView   `json:"certificate"`
+	CABundle    []certificateView `json:"cabundle"`
+	PublicKey   string            `json:"public_key,omitempty"`
+	UserData    string            `json:"user_data,omitempty"`
+	Nonce       string            `json:"nonce,omitempty"`
+	Algorithm   string            `json:"algorithm"`
+	Signature   string            `json:"signature"`
+}
+
+type pcrView struct {
+	Index int    `json:"index"`
+	Value string `json:"value"`
+}
+
+type certificateView struct {
+	attestation.CertificateInfo
+	Error string `json:"error,omitempty"`
+}
+
+// decodeDocument parses the COSE_Sign1 message and its payload with
+// attestation.ParseMessage, without verifying them.
+func decodeDocument(raw []byte) (*attestation.AttestationDocument, *documentView, error) {
+	msg, doc, err := attestation.ParseMessage(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	view := &documentView{
+		ModuleID:    doc.ModuleID,
+		Timestamp:   doc.Time().UTC(),
+		Digest:      doc.Digest,
+		PCRs:        pcrViews(doc.PCRs),
+		Certificate: viewCertificate(doc.Certificate),
+		PublicKey:   hex.EncodeToString(doc.PublicKey),
+		UserData:    hex.EncodeToString(doc.UserData),
+		Nonce:       hex.EncodeToString(doc.Nonce),
+		Signature:   hex.EncodeToString(msg.Signature),
+	}
+	for _, der := range doc.CABundle {
+		view.CABundle = append(view.CABundle, viewCertificate(der))
+	}
+	if alg, err := msg.Headers.Protected.Algorithm(); err == nil {
+		view.Algorithm = alg.String()
+	}
+	return doc, view, nil
+}
+
+func pcrViews(pcrs map[int][]byte) []pcrView {
+	views := make([]pcrView, 0, len(pcrs))
+	for index, value := range pcrs {
+		views = append(views, pcrView{Index: index, Value: hex.EncodeToString(value)})
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Index < views[j].Index })
+	return views
+}
+
+func viewCertificate(der []byte) certificateView {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return certificateView{Error: err.Error()}
+	}
+	return certificateView{CertificateInfo: attestation.NewCertificateInfo(cert)}
+}
+
+func (c command) decode(args []string) int {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(c.stderr, "usage: nitro-attest decode [document]")
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	raw, err := readDocument(fs.Arg(0), c.stdin)
+	if err != nil {
+		return c.fail(exitInvalid, err)
+	}
+	_, view, err := decodeDocument(raw)
+	if err != nil {
+		return c.fail(exitInvalid, err)
+	}
+	if err := c.print(view); err != nil {
+		return c.fail(exitInvalid, err)
+	}
+	return exitOK
+}
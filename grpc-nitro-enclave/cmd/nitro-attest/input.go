@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// minInlineLength is the minimum length of a document given inline in base64.
+// Attestation documents are several kilobytes long.
+const minInlineLength = 256
+
+// readDocument reads an attestation document from the file name, from name
+// itself if it is not a file but valid base64, or from stdin if name is empty or "-".
+func readDocument(name string, stdin io.Reader) ([]byte, error) {
+	if name == "" || name == "-" {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read standard input: %w", err)
+		}
+		return decodeInput(data)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		// Not a readable file: try the argument itself. Short names are
+		// reported as missing files rather than decoded.
+		if doc, ok := decodeBase64(name); ok && len(name) >= minInlineLength {
+			return doc, nil
+		}
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	doc, err := decodeInput(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return doc, nil
+}
+
+// decodeInput returns the document held in data, which is either raw CBOR or
+// base64 text, possibly preceded by other text on the same line as in the
+// server log. Raw documents are recognized by the COSE_Sign1 tag or array
+// header they start with, before trying base64.
+func decodeInput(data []byte) ([]byte, error) {
+	if isCOSESign1(data) {
+		return data, nil
+	}
+	fields := bytes.Fields(data)
+	if len(fields) == 0 {
+		return nil, errors.New("empty input")
+	}
+	if doc, ok := decodeBase64(string(fields[len(fields)-1])); ok {
+		return doc, nil
+	}
+	return nil, errors.New("input is neither a COSE_Sign1 document nor base64")
+}
+
+// isCOSESign1 reports whether data starts like a COSE_Sign1 message: the CBOR
+// tag 18 (0xD2) or the header of an array of four items (0x84).
+func isCOSESign1(data []byte) bool {
+	return len(data) > 0 && (data[0] == 0xD2 || data[0] == 0x84)
+}
+
+// decodeBase64 decodes s in standard or URL-safe base64, padded or not.
+func decodeBase64(s string) ([]byte, bool) {
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding,
+		base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		if doc, err := enc.DecodeString(s); err == nil && len(doc) > 0 {
+			return doc, true
+		}
+	}
+	return nil, false
+}
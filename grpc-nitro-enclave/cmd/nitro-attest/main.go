@@ -0,0 +1,82 @@
+// Command nitro-attest inspects and verifies Nitro Enclaves attestation documents.
+//
+//	nitro-attest decode [document]
+//	nitro-attest verify [-pcr-policy measurements.json] [-root-cert root.pem] [document]
+//	nitro-attest pcrs document-a document-b
+//
+// A document is read from a file, given inline in base64 or, if omitted or "-",
+// read from standard input. Base64 input may be a pasted log line such as the
+// one printed by the enclave server; raw CBOR is accepted as well. Results are
+// written to standard output as JSON.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Exit codes
+const (
+	exitOK      = 0
+	exitFailed  = 1 // verification failed or PCRs differ
+	exitUsage   = 2
+	exitInvalid = 3 // the input could not be read or decoded
+)
+
+const usage = `usage: nitro-attest <command> [flags] [document...]
+
+commands:
+  decode   print the fields of an attestation document without verifying it
+  verify   verify an attestation document and print a verification report
+  pcrs     compare the PCRs of two attestation documents
+
+A document is a file, a base64 string, or "-" for standard input (the default).
+Run "nitro-attest <command> -h" for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	cmd := command{stdin: stdin, stdout: stdout, stderr: stderr}
+	switch args[0] {
+	case "decode":
+		return cmd.decode(args[1:])
+	case "verify":
+		return cmd.verify(args[1:])
+	case "pcrs":
+		return cmd.pcrs(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "nitro-attest: unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+}
+
+// command holds the standard streams shared by the subcommands.
+type command struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+// fail reports err on standard error and returns code.
+func (c command) fail(code int, err error) int {
+	fmt.Fprintf(c.stderr, "nitro-attest: %v\n", err)
+	return code
+}
+
+// print writes v to standard output as indented JSON.
+func (c command) print(v any) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
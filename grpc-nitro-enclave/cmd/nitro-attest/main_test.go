@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	if stderr.Len() > 0 {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return code, stdout.String()
+}
+
+func newDocument(t *testing.T, nsm *attestertest.NSM) string {
+	t.Helper()
+	raw, err := nsm.Attest([]byte{0x01, 0x02}, nil, nil)
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestDecode(t *testing.T) {
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	doc := newDocument(t, nsm)
+
+	// A line copied from the server log
+	code, out := runCommand(t, "2024/10/01 12:00:00 Attestation Document (base64): "+doc+"\n", "decode")
+	if code != exitOK {
+		t.Fatalf("decode exited with %d", code)
+	}
+	var view documentView
+	if err := json.Unmarshal([]byte(out), &view); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out)
+	}
+	if view.ModuleID != attestertest.ModuleID {
+		t.Errorf("module_id = %q, want %q", view.ModuleID, attestertest.ModuleID)
+	}
+	if view.Nonce != "0102" {
+		t.Errorf("nonce = %q, want 0102", view.Nonce)
+	}
+	if view.Algorithm != "ES384" {
+		t.Errorf("algorithm = %q, want ES384", view.Algorithm)
+	}
+	if len(view.PCRs) != len(nsm.PCRs) || view.PCRs[1].Index != 1 || view.PCRs[1].Value != strings.Repeat("01", 48) {
+		t.Errorf("pcrs = %+v", view.PCRs)
+	}
+	if len(view.CABundle) != 2 || view.CABundle[0].Subject != nsm.CA.Root.Subject.String() {
+		t.Errorf("cabundle = %+v", view.CABundle)
+	}
+
+	// The same document given inline
+	if code, _ := runCommand(t, "", "decode", doc); code != exitOK {
+		t.Errorf("decode of inline base64 exited with %d", code)
+	}
+	// The same document in raw CBOR
+	raw, err := base64.StdEncoding.DecodeString(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := runCommand(t, string(raw), "decode"); code != exitOK {
+		t.Errorf("decode of raw CBOR exited with %d", code)
+	}
+	if code, _ := runCommand(t, "not a document!", "decode"); code != exitInvalid {
+		t.Errorf("decode of invalid input exited with %d, want %d", code, exitInvalid)
+	}
+	if code, _ := runCommand(t, "", "decode", filepath.Join(t.TempDir(), "missing")); code != exitInvalid {
+		t.Errorf("decode of a missing file exited with %d, want %d", code, exitInvalid)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	dir := t.TempDir()
+	rootFile := filepath.Join(dir, "root.pem")
+	if err := os.WriteFile(rootFile, nsm.CA.RootPEM(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	docFile := filepath.Join(dir, "doc.b64")
+	if err := os.WriteFile(docFile, []byte(newDocument(t, nsm)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policyFile := filepath.Join(dir, "measurements.json")
+	policy := `{"Measurements": {"PCR0": "` + strings.Repeat("00", 48) + `", "PCR2": "` + strings.Repeat("02", 48) + `"}}`
+	if err := os.WriteFile(policyFile, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	otherPolicyFile := filepath.Join(dir, "other.json")
+	if err := os.WriteFile(otherPolicyFile, []byte(`{"PCR2": "`+strings.Repeat("ff", 48)+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantCode  int
+		wantCheck string // the failed check
+	}{
+		{name: "valid", args: []string{"-root-cert", rootFile, "-pcr-policy", policyFile, "-nonce", "0102", docFile}, wantCode: exitOK},
+		{name: "AWS root", args: []string{docFile}, wantCode: exitFailed, wantCheck: "chain"},
+		{name: "PCR mismatch", args: []string{"-root-cert", rootFile, "-pcr-policy", otherPolicyFile, docFile}, wantCode: exitFailed, wantCheck: "pcrs"},
+		{name: "nonce mismatch", args: []string{"-root-cert", rootFile, "-nonce", "0103", docFile}, wantCode: exitFailed, wantCheck: "nonce"},
+		{name: "invalid nonce", args: []string{"-nonce", "xyz", docFile}, wantCode: exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, out := runCommand(t, "", append([]string{"verify"}, tt.args...)...)
+			if code != tt.wantCode {
+				t.Fatalf("verify exited with %d, want %d\n%s", code, tt.wantCode, out)
+			}
+			if tt.wantCode == exitUsage {
+				return
+			}
+			var view reportView
+			if err := json.Unmarshal([]byte(out), &view); err != nil {
+				t.Fatalf("invalid JSON output: %v\n%s", err, out)
+			}
+			if view.OK != (tt.wantCode == exitOK) {
+				t.Errorf("ok = %v, error %q", view.OK, view.Error)
+			}
+			for _, check := range view.Checks {
+				if check.Outcome == "failed" && string(check.Check) != tt.wantCheck {
+					t.Errorf("check %q failed, want %q", check.Check, tt.wantCheck)
+				}
+			}
+			if view.Document == nil || view.Document.ModuleID != attestertest.ModuleID {
+				t.Errorf("document = %+v", view.Document)
+			}
+		})
+	}
+}
+
+func TestPCRs(t *testing.T) {
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	a := newDocument(t, nsm)
+	nsm.PCRs[2] = bytes.Repeat([]byte{0xff}, 48)
+	b := newDocument(t, nsm)
+
+	code, out := runCommand(t, a, "pcrs", "-", b)
+	if code != exitFailed {
+		t.Fatalf("pcrs exited with %d, want %d", code, exitFailed)
+	}
+	var diff pcrDiff
+	if err := json.Unmarshal([]byte(out), &diff); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out)
+	}
+	if diff.Equal || len(diff.PCRs) != 1 || diff.PCRs[0].Index != 2 || diff.PCRs[0].B != strings.Repeat("ff", 48) {
+		t.Errorf("diff = %+v, want PCR2 only", diff)
+	}
+
+	if code, _ := runCommand(t, "", "pcrs", a, a); code != exitOK {
+		t.Errorf("pcrs of identical documents exited with %d", code)
+	}
+}
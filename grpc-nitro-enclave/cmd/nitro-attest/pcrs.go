@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+)
+
+// pcrDiff is the JSON form of a PCR comparison.
+type pcrDiff struct {
+	Equal bool         `json:"equal"`
+	PCRs  []pcrCompare `json:"pcrs"`
+}
+
+type pcrCompare struct {
+	Index int    `json:"index"`
+	Equal bool   `json:"equal"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+}
+
+// diffPCRs compares the PCRs of two documents. PCRs that are present in only
+// one of them are reported with an empty value for the other.
+func diffPCRs(a, b map[int][]byte, all bool) pcrDiff {
+	indices := make([]int, 0, len(a))
+	for index := range a {
+		indices = append(indices, index)
+	}
+	for index := range b {
+		if _, ok := a[index]; !ok {
+			indices = append(indices, index)
+		}
+	}
+	sort.Ints(indices)
+
+	diff := pcrDiff{Equal: true, PCRs: []pcrCompare{}}
+	for _, index := range indices {
+		va, oka := a[index]
+		vb, okb := b[index]
+		equal := oka == okb && bytes.Equal(va, vb)
+		if !equal {
+			diff.Equal = false
+		}
+		if equal && !all {
+			continue
+		}
+		diff.PCRs = append(diff.PCRs, pcrCompare{
+			Index: index,
+			Equal: equal,
+			A:     hex.EncodeToString(va),
+			B:     hex.EncodeToString(vb),
+		})
+	}
+	return diff
+}
+
+func (c command) pcrs(args []string) int {
+	fs := flag.NewFlagSet("pcrs", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	all := fs.Bool("all", false, "list equal PCRs too")
+	fs.Usage = func() {
+		fmt.Fprintln(c.stderr, "usage: nitro-attest pcrs [-all] document-a document-b")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	if fs.Arg(0) == "-" && fs.Arg(1) == "-" {
+		return c.fail(exitUsage, errors.New("only one document can be read from standard input"))
+	}
+
+	var pcrs [2]map[int][]byte
+	for i := range pcrs {
+		raw, err := readDocument(fs.Arg(i), c.stdin)
+		if err != nil {
+			return c.fail(exitInvalid, err)
+		}
+		doc, _, err := decodeDocument(raw)
+		if err != nil {
+			return c.fail(exitInvalid, fmt.Errorf("%s: %w", fs.Arg(i), err))
+		}
+		pcrs[i] = doc.PCRs
+	}
+
+	diff := diffPCRs(pcrs[0], pcrs[1], *all)
+	if err := c.print(diff); err != nil {
+		return c.fail(exitInvalid, err)
+	}
+	if !diff.Equal {
+		return exitFailed
+	}
+	return exitOK
+}
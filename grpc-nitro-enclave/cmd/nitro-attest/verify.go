@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+)
+
+// reportView is the JSON form of a verification report.
+type reportView struct {
+	OK       bool                          `json:"ok"`
+	Error    string                        `json:"error,omitempty"`
+	Checks   []attestation.CheckResult     `json:"checks"`
+	Chain    []attestation.CertificateInfo `json:"chain,omitempty"` // the validated chain, leaf first
+	Document *documentView                 `json:"document,omitempty"`
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func (c command) verify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	var policyFiles stringList
+	fs.Var(&policyFiles, "pcr-policy", "JSON file with the expected PCR values, as printed by nitro-cli build-enclave (repeatable)")
+	rootCertFile := fs.String("root-cert", "", "PEM file with the trusted root certificates (default: embedded AWS Nitro Enclaves root)")
+	nonceHex := fs.String("nonce", "", "expected nonce, in hex")
+	userDataHex := fs.String("user-data", "", "expected user data, in hex")
+	maxAge := fs.Duration("max-age", 0, "reject documents older than this (0 for any age)")
+	clockSkew := fs.Duration("clock-skew", 0, "tolerated clock difference with the enclave")
+	onDemand := fs.Bool("allow-on-demand", false, "accept documents handed out by AttestationService")
+	audit := fs.Bool("audit", false, "validate the certificate chain at the document timestamp, for historical documents")
+	at := fs.String("time", "", "verify at this RFC 3339 time instead of now")
+	fs.Usage = func() {
+		fmt.Fprintln(c.stderr, "usage: nitro-attest verify [flags] [document]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	opts := attestation.VerifyOptions{
+		MaxAge:    *maxAge,
+		ClockSkew: *clockSkew,
+		AuditMode: *audit,
+
+		AllowOnDemand: *onDemand,
+	}
+	var err error
+	if *rootCertFile != "" {
+		if opts.Roots, err = attestation.LoadRoots(*rootCertFile); err != nil {
+			return c.fail(exitUsage, err)
+		}
+	}
+	if len(policyFiles) > 0 {
+		if opts.Policy, err = attestation.LoadPCRPolicy(policyFiles...); err != nil {
+			return c.fail(exitUsage, err)
+		}
+	}
+	if *nonceHex != "" {
+		if opts.Nonce, err = hex.DecodeString(*nonceHex); err != nil {
+			return c.fail(exitUsage, fmt.Errorf("invalid -nonce: %w", err))
+		}
+	}
+	if *userDataHex != "" {
+		if opts.UserData, err = hex.DecodeString(*userDataHex); err != nil {
+			return c.fail(exitUsage, fmt.Errorf("invalid -user-data: %w", err))
+		}
+	}
+	if *at != "" {
+		if opts.CurrentTime, err = time.Parse(time.RFC3339, *at); err != nil {
+			return c.fail(exitUsage, fmt.Errorf("invalid -time: %w", err))
+		}
+	}
+
+	raw, err := readDocument(fs.Arg(0), c.stdin)
+	if err != nil {
+		return c.fail(exitInvalid, err)
+	}
+
+	report := attestation.VerifyReport(raw, opts)
+	view := reportView{
+		OK:     report.OK(),
+		Checks: report.Checks,
+		Chain:  report.Certificates,
+	}
+	if report.Err != nil {
+		view.Error = report.Err.Error()
+	}
+	if _, doc, err := decodeDocument(raw); err == nil {
+		view.Document = doc
+	}
+	if err := c.print(view); err != nil {
+		return c.fail(exitInvalid, err)
+	}
+	if !report.OK() {
+		return exitFailed
+	}
+	return exitOK
+}
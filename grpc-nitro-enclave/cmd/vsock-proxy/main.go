@@ -0,0 +1,92 @@
+// Command vsock-proxy listens on TCP on the parent instance and forwards every
+// connection to a vsock port inside an enclave.
+//
+//	vsock-proxy -listen :50051 -cid 16 -port 50051
+//
+// With -to-tcp, it forwards the other way: it listens on a vsock port of the
+// parent instance and forwards the connections of the enclave to a fixed TCP
+// address, such as the KMS endpoint.
+//
+//	vsock-proxy -port 8000 -to-tcp kms.us-east-1.amazonaws.com:443
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mdlayher/vsock"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/proxy"
+)
+
+func main() {
+	listenAddr := flag.String("listen", ":50051", "TCP address to listen on")
+	cid := flag.Uint("cid", 16, "vsock context ID of the enclave")
+	port := flag.Uint("port", 50051, "vsock port of the enclave server")
+	maxConns := flag.Int("max-conns", 256, "maximum number of concurrent connections (0 for no limit)")
+	idleTimeout := flag.Duration("idle-timeout", 5*time.Minute, "close connections idle for this long (0 to disable)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "time to wait for active connections on shutdown")
+	toTCP := flag.String("to-tcp", "", "listen on vsock -port instead and forward to this TCP host:port")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var listener net.Listener
+	var dial func() (net.Conn, error)
+	var target string
+	var err error
+	if *toTCP != "" {
+		listener, err = vsock.Listen(uint32(*port), nil)
+		dial = func() (net.Conn, error) {
+			return net.DialTimeout("tcp", *toTCP, 10*time.Second)
+		}
+		target = "tcp " + *toTCP
+	} else {
+		listener, err = net.Listen("tcp", *listenAddr)
+		dial = func() (net.Conn, error) {
+			return vsock.Dial(uint32(*cid), uint32(*port), nil)
+		}
+		target = fmt.Sprintf("vsock %d:%d", *cid, *port)
+	}
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	p := &proxy.Proxy{
+		Dial:        dial,
+		MaxConns:    *maxConns,
+		IdleTimeout: *idleTimeout,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.Serve(listener)
+	}()
+	log.Printf("Forwarding %s to %s", listener.Addr(), target)
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, proxy.ErrProxyClosed) {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	case <-ctx.Done():
+		log.Printf("Shutting down, waiting up to %v for active connections", *shutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := p.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Closed remaining connections: %v", err)
+		}
+	}
+
+	stats := p.Stats()
+	log.Printf("Proxy stopped: %d connections accepted, %d rejected, %d failed, %d bytes in, %d bytes out",
+		stats.Accepted, stats.Rejected, stats.Failed, stats.BytesIn, stats.BytesOut)
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Defaults of the client.
+const (
+	DefaultAddress = "localhost:" + DefaultPort
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultRootCertURL and DefaultRootCertSHA256 locate the AWS Nitro
+	// Enclaves root certificate downloaded by -refresh-root, and the SHA-256
+	// hash of the archive published by AWS.
+	DefaultRootCertURL    = "https://aws-nitro-enclaves.amazonaws.com/AWS_NitroEnclaves_Root-G1.zip"
+	DefaultRootCertSHA256 = "8cf60e2b2efca96c6a9e71e851d00c1b6991cc09eadbe64a6a1d1b1eb9faff7c"
+)
+
+// Client configures the example client.
+type Client struct {
+	File string `yaml:"-" flag:"config" env:"ENCLAVE_CLIENT_CONFIG" usage:"YAML configuration file"`
+
+	Address       string        `yaml:"address" flag:"address" env:"ENCLAVE_ADDRESS" usage:"server address, e.g. host:port or unix:///path/to/socket"`
+	Timeout       time.Duration `yaml:"timeout" flag:"timeout" env:"ENCLAVE_TIMEOUT" usage:"timeout of a call"`
+	StreamTimeout time.Duration `yaml:"stream_timeout" flag:"stream-timeout" env:"ENCLAVE_STREAM_TIMEOUT" usage:"timeout of a stream"`
+	PCRPolicy     string        `yaml:"pcr_policy" flag:"pcr-policy" env:"ENCLAVE_PCR_POLICY" usage:"JSON file with the expected PCR values, as printed by nitro-cli build-enclave"`
+	RootCert      string        `yaml:"root_cert" flag:"root-cert" env:"ENCLAVE_ROOT_CERT" usage:"PEM file with the trusted root certificates (default: embedded AWS Nitro Enclaves root)"`
+	RootCertURL   string        `yaml:"root_cert_url" flag:"root-cert-url" env:"ENCLAVE_ROOT_CERT_URL" usage:"URL of the zip archive with the AWS Nitro Enclaves root certificate, for -refresh-root"`
+	RootCertHash  string        `yaml:"root_cert_sha256" flag:"root-cert-sha256" env:"ENCLAVE_ROOT_CERT_SHA256" usage:"hex SHA-256 hash of the root certificate archive, for -refresh-root"`
+
+	Signed bool   `yaml:"signed" flag:"signed" env:"ENCLAVE_SIGNED" usage:"attest the enclave signing key once and verify the signatures of the responses instead of an attestation document per call"`
+	Count  int    `yaml:"count" flag:"count" usage:"number of calls to make, or of messages per stream"`
+	Stream string `yaml:"stream" flag:"stream" usage:"send the messages on one attested stream: server, client or bidi"`
+
+	MetricsFile string        `yaml:"metrics_file" flag:"metrics-file" env:"ENCLAVE_METRICS_FILE" usage:"write the verification metrics in Prometheus text format to this file on exit"`
+	Tracing     ClientTracing `yaml:"tracing"`
+
+	GetAttestation bool   `yaml:"-" flag:"get-attestation" usage:"request a fresh attestation document from AttestationService, verify it and print it in base64"`
+	RefreshRoot    string `yaml:"-" flag:"refresh-root" usage:"download the AWS Nitro Enclaves root certificate, write it to this PEM file and exit"`
+}
+
+// ClientTracing configures the export of the spans of the client.
+type ClientTracing struct {
+	Endpoint    string `yaml:"endpoint" flag:"trace-endpoint" env:"ENCLAVE_TRACE_ENDPOINT" usage:"OTLP/HTTP endpoint of the OpenTelemetry collector, e.g. http://localhost:4318"`
+	File        string `yaml:"file" flag:"trace-file" env:"ENCLAVE_TRACE_FILE" usage:"append the spans as OTLP/JSON lines to this file, - for the standard output"`
+	ServiceName string `yaml:"service_name" flag:"trace-service" env:"OTEL_SERVICE_NAME" usage:"service.name of the exported spans"`
+}
+
+// Enabled reports whether spans are exported.
+func (t ClientTracing) Enabled() bool {
+	return t.Endpoint != "" || t.File != ""
+}
+
+// DefaultClient returns the default configuration of the client.
+func DefaultClient() *Client {
+	return &Client{
+		Address:       DefaultAddress,
+		Timeout:       DefaultTimeout,
+		StreamTimeout: time.Minute,
+		RootCertURL:   DefaultRootCertURL,
+		RootCertHash:  DefaultRootCertSHA256,
+		Count:         1,
+		Tracing:       ClientTracing{ServiceName: "enclave-client"},
+	}
+}
+
+// Validate checks the settings of the client.
+func (c *Client) Validate() error {
+	var errs []error
+	if c.Address == "" {
+		errs = append(errs, errors.New("address must not be empty"))
+	}
+	if c.Timeout <= 0 || c.StreamTimeout <= 0 {
+		errs = append(errs, errors.New("timeout and stream_timeout must be positive"))
+	}
+	if u, err := url.Parse(c.RootCertURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("root_cert_url must be an https URL, got %q", c.RootCertURL))
+	}
+	if b, err := hex.DecodeString(c.RootCertHash); err != nil || len(b) != 32 {
+		errs = append(errs, fmt.Errorf("root_cert_sha256 must be 64 hex digits, got %q", c.RootCertHash))
+	}
+	if c.Count < 1 {
+		errs = append(errs, errors.New("count must be at least 1"))
+	}
+	switch c.Stream {
+	case "", "server", "client", "bidi":
+	default:
+		errs = append(errs, fmt.Errorf("unknown stream kind %q, expected server, client or bidi", c.Stream))
+	}
+	errs = append(errs, checkTracing(c.Tracing.Endpoint, c.Tracing.File, c.Tracing.ServiceName)...)
+	return errors.Join(errs...)
+}
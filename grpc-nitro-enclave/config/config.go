@@ -0,0 +1,281 @@
+// Package config loads the configuration of the enclave server and the client
+// from a YAML file, environment variables and command-line flags.
+//
+// A configuration is a struct whose fields carry their YAML key, flag name,
+// environment variable and usage in struct tags:
+//
+//	Listen string `yaml:"listen" flag:"listen" env:"ENCLAVE_LISTEN" usage:"..."`
+//
+// Nested structs group settings in the YAML file; their fields still have
+// flat flag names. Strings, booleans, integers, floats, durations and string
+// lists are supported; lists are comma-separated in environment variables and
+// repeated on the command line. The field with the flag name "config" holds the
+// path of the YAML file.
+//
+// Settings are applied in increasing order of precedence: defaults, YAML file,
+// environment variables, flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileFlag is the name of the flag holding the path of the YAML file.
+const fileFlag = "config"
+
+// validator is implemented by configurations that check their settings.
+type validator interface {
+	Validate() error
+}
+
+// setting is a configuration field bound to a flag and an environment variable.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value *fieldValue
+}
+
+// fieldValue is a flag.Value setting a struct field.
+type fieldValue struct {
+	v   reflect.Value
+	set bool // whether Set was called, so that lists from the file are replaced
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (f *fieldValue) String() string {
+	if f == nil || !f.v.IsValid() || f.v.IsZero() {
+		return ""
+	}
+	if f.v.Kind() == reflect.Slice {
+		return strings.Join(f.v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(f.v.Interface())
+}
+
+// typeName returns the name of the argument of the flag in the usage.
+func (f *fieldValue) typeName() string {
+	switch {
+	case f.v.Type() == durationType:
+		return "duration"
+	case f.v.Kind() == reflect.Bool:
+		return ""
+	case f.v.Kind() == reflect.Int:
+		return "int"
+	case f.v.Kind() == reflect.Float64:
+		return "float"
+	case f.v.Kind() == reflect.Slice:
+		return "value"
+	}
+	return "string"
+}
+
+func (f *fieldValue) IsBoolFlag() bool {
+	return f.v.Kind() == reflect.Bool
+}
+
+func (f *fieldValue) Set(s string) error {
+	switch {
+	case f.v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.New("invalid duration")
+		}
+		f.v.SetInt(int64(d))
+	case f.v.Kind() == reflect.String:
+		f.v.SetString(s)
+	case f.v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("invalid boolean")
+		}
+		f.v.SetBool(b)
+	case f.v.Kind() == reflect.Int:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return errors.New("invalid integer")
+		}
+		f.v.SetInt(int64(i))
+	case f.v.Kind() == reflect.Float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.New("invalid number")
+		}
+		f.v.SetFloat(x)
+	case f.v.Kind() == reflect.Slice && f.v.Type().Elem().Kind() == reflect.String:
+		if !f.set {
+			f.v.Set(reflect.Zero(f.v.Type()))
+		}
+		f.v.Set(reflect.Append(f.v, reflect.ValueOf(s)))
+	default:
+		return fmt.Errorf("unsupported type %v", f.v.Type())
+	}
+	f.set = true
+	return nil
+}
+
+// setEnv sets the field from the value of an environment variable.
+func (f *fieldValue) setEnv(s string) error {
+	if f.v.Kind() != reflect.Slice {
+		return f.Set(s)
+	}
+	f.v.Set(reflect.Zero(f.v.Type()))
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			f.v.Set(reflect.Append(f.v, reflect.ValueOf(item)))
+		}
+	}
+	return nil
+}
+
+// settings returns the settings of the struct v, including nested structs.
+func settings(v reflect.Value) []setting {
+	var out []setting
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			out = append(out, settings(v.Field(i))...)
+			continue
+		}
+		name := field.Tag.Get("flag")
+		if name == "" {
+			continue
+		}
+		out = append(out, setting{
+			flag:  name,
+			env:   field.Tag.Get("env"),
+			usage: field.Tag.Get("usage"),
+			value: &fieldValue{v: v.Field(i)},
+		})
+	}
+	return out
+}
+
+// newFlagSet returns a flag set bound to the settings.
+func newFlagSet(name string, settings []setting, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	for _, s := range settings {
+		usage := s.usage
+		if s.env != "" {
+			usage += " (env " + s.env + ")"
+		}
+		fs.Var(s.value, s.flag, usage)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", name)
+		fs.VisitAll(func(f *flag.Flag) {
+			line := "  -" + f.Name
+			if t := f.Value.(*fieldValue).typeName(); t != "" {
+				line += " " + t
+			}
+			line += "\n    \t" + f.Usage
+			if f.DefValue != "" {
+				line += fmt.Sprintf(" (default %s)", f.DefValue)
+			}
+			fmt.Fprintln(fs.Output(), line)
+		})
+	}
+	return fs
+}
+
+// applyEnv sets the settings whose environment variable is set.
+func applyEnv(settings []setting) error {
+	var errs []error
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.value.setEnv(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// filePath returns the value of the config file setting, if any.
+func filePath(settings []setting) string {
+	for _, s := range settings {
+		if s.flag == fileFlag {
+			return s.value.String()
+		}
+	}
+	return ""
+}
+
+// LoadFile decodes the YAML file at path into cfg. Unknown keys are errors.
+func LoadFile(path string, cfg any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Load fills cfg, a pointer to a configuration struct holding the defaults,
+// from the YAML file, the environment and the command-line arguments args, and
+// validates it. It returns the remaining positional arguments. With -h, it
+// prints the usage and returns flag.ErrHelp.
+func Load(name string, args []string, cfg any) ([]string, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: %T is not a pointer to a struct", cfg)
+	}
+
+	// Find the configuration file, which may be given by a flag or in the
+	// environment, without touching cfg.
+	scratch := reflect.New(v.Elem().Type())
+	scratch.Elem().Set(v.Elem())
+	first := settings(scratch.Elem())
+	if err := applyEnv(first); err != nil {
+		return nil, err
+	}
+	if err := newFlagSet(name, first, os.Stderr).Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Apply the file, the environment and the flags in order.
+	if path := filePath(first); path != "" {
+		if err := LoadFile(path, cfg); err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+	}
+	all := settings(v.Elem())
+	if err := applyEnv(all); err != nil {
+		return nil, err
+	}
+	fs := newFlagSet(name, all, io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if c, ok := cfg.(validator); ok {
+		if err := c.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+	return fs.Args(), nil
+}
@@ -0,0 +1,221 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/config"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+transport: tcp
+listen: 127.0.0.1:6000
+health:
+  interval: 5s
+attestation:
+  rate: 2
+`)
+	t.Setenv("ENCLAVE_LISTEN", "127.0.0.1:7000")
+	t.Setenv("ENCLAVE_ATTESTATION_RATE", "4")
+
+	cfg := config.DefaultServer()
+	args, err := config.Load("server", []string{"-config", path, "-attestation-rate", "3", "extra"}, cfg)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Transport != "tcp" {
+		t.Errorf("Transport = %q, want tcp from the file", cfg.Transport)
+	}
+	if cfg.Listen != "127.0.0.1:7000" {
+		t.Errorf("Listen = %q, want the environment to override the file", cfg.Listen)
+	}
+	if cfg.Health.Interval != 5*time.Second {
+		t.Errorf("Health.Interval = %v, want 5s from the file", cfg.Health.Interval)
+	}
+	if cfg.Attestation.Rate != 3 {
+		t.Errorf("Attestation.Rate = %v, want the flag to override the environment", cfg.Attestation.Rate)
+	}
+	if want := config.DefaultServer().Attestation.Burst; cfg.Attestation.Burst != want {
+		t.Errorf("Attestation.Burst = %d, want the default %d", cfg.Attestation.Burst, want)
+	}
+	if !reflect.DeepEqual(args, []string{"extra"}) {
+		t.Errorf("args = %q, want [extra]", args)
+	}
+}
+
+func TestLoadFileFromEnv(t *testing.T) {
+	t.Setenv("ENCLAVE_CLIENT_CONFIG", writeFile(t, "address: enclave:6000\ntimeout: 2s\n"))
+	cfg := config.DefaultClient()
+	if _, err := config.Load("client", nil, cfg); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Address != "enclave:6000" || cfg.Timeout != 2*time.Second {
+		t.Errorf("got address %q and timeout %v from the file", cfg.Address, cfg.Timeout)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "unknown key", file: "listen: 6000\nlisten_port: 6000\n", want: "listen_port"},
+		{name: "wrong type", file: "health:\n  interval: often\n", want: "often"},
+		{name: "missing file", args: []string{"-config", "/nonexistent/config.yaml"}, want: "no such file"},
+		{name: "invalid env", env: map[string]string{"ENCLAVE_ATTESTATION_BURST": "many"}, want: "ENCLAVE_ATTESTATION_BURST"},
+		{name: "invalid flag", args: []string{"-drain-timeout", "soon"}, want: "drain-timeout"},
+		{name: "invalid setting", args: []string{"-listen", "port"}, want: "invalid vsock port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file)}, args...)
+			}
+			_, err := config.Load("server", args, config.DefaultServer())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	if _, err := config.Load("client", []string{"-h"}, config.DefaultClient()); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Load -h error = %v, want flag.ErrHelp", err)
+	}
+}
+
+type listConfig struct {
+	Peers []string `yaml:"peers" flag:"peer" env:"TEST_PEERS"`
+}
+
+func TestLoadList(t *testing.T) {
+	path := writeFile(t, "peers: [a, b]\n")
+	tests := []struct {
+		name string
+		env  string
+		args []string
+		want []string
+	}{
+		{name: "file", want: []string{"a", "b"}},
+		{name: "env replaces file", env: "c, d", want: []string{"c", "d"}},
+		{name: "flags replace file", args: []string{"-peer", "e", "-peer", "f"}, want: []string{"e", "f"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("TEST_PEERS", tt.env)
+			}
+			cfg := &listConfig{Peers: []string{"default"}}
+			if err := config.LoadFile(path, cfg); err != nil {
+				t.Fatalf("LoadFile: %v", err)
+			}
+			if _, err := config.Load("test", tt.args, cfg); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !reflect.DeepEqual(cfg.Peers, tt.want) {
+				t.Errorf("Peers = %q, want %q", cfg.Peers, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*config.Server)
+		want   string
+	}{
+		{name: "default", modify: func(*config.Server) {}},
+		{name: "tcp", modify: func(c *config.Server) { c.Transport, c.Listen = "tcp", "127.0.0.1:50051" }},
+		{name: "unknown transport", modify: func(c *config.Server) { c.Transport = "udp" }, want: "unknown transport"},
+		{name: "tcp without port", modify: func(c *config.Server) { c.Transport, c.Listen = "tcp", "localhost" }, want: "invalid TCP address"},
+		{name: "unknown attester", modify: func(c *config.Server) { c.Attester = "tpm" }, want: "unknown attester"},
+		{name: "local root with nsm", modify: func(c *config.Server) { c.LocalRootOut = "root.pem" }, want: "local_root_out"},
+		{name: "ciphertext without region", modify: func(c *config.Server) { c.KMS.Ciphertext = "AAAA" }, want: "region"},
+		{name: "invalid tunnel", modify: func(c *config.Server) { c.KMS.Tunnel = "parent:8000" }, want: "tunnel"},
+		{name: "half sealed storage", modify: func(c *config.Server) { c.Sealed.KeyRelease = "3:5000" }, want: "set together"},
+		{name: "sealed storage", modify: func(c *config.Server) { c.Sealed.KeyRelease, c.Sealed.BlobStore = "3:5000", "5001" }},
+		{name: "negative rate", modify: func(c *config.Server) { c.Attestation.Rate = -1 }, want: "rate"},
+		{name: "no burst", modify: func(c *config.Server) { c.Attestation.Burst = 0 }, want: "burst"},
+		{name: "no burst without limit", modify: func(c *config.Server) { c.Attestation.Rate, c.Attestation.Burst = 0, 0 }},
+		{name: "zero health interval", modify: func(c *config.Server) { c.Health.Interval = 0 }, want: "interval"},
+		{name: "metrics port", modify: func(c *config.Server) { c.Metrics.Listen = "9090" }},
+		{name: "metrics on server port", modify: func(c *config.Server) { c.Metrics.Listen = c.Listen }, want: "metrics"},
+		{name: "trace tunnel", modify: func(c *config.Server) { c.Tracing.Endpoint, c.Tracing.Tunnel = "http://localhost:4318", "3:4318" }},
+		{name: "trace tunnel without endpoint", modify: func(c *config.Server) { c.Tracing.Tunnel = "3:4318" }, want: "tunnel requires"},
+		{name: "trace endpoint and file", modify: func(c *config.Server) { c.Tracing.Endpoint, c.Tracing.File = "http://localhost:4318", "-" }, want: "mutually exclusive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultServer()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateClient(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*config.Client)
+		want   string
+	}{
+		{name: "default", modify: func(*config.Client) {}},
+		{name: "zero count", modify: func(c *config.Client) { c.Count = 0 }, want: "count"},
+		{name: "unknown stream", modify: func(c *config.Client) { c.Stream = "both" }, want: "stream"},
+		{name: "plain http root URL", modify: func(c *config.Client) { c.RootCertURL = "http://example.com/root.zip" }, want: "https"},
+		{name: "short hash", modify: func(c *config.Client) { c.RootCertHash = "8cf60e2b" }, want: "root_cert_sha256"},
+		{name: "zero timeout", modify: func(c *config.Client) { c.Timeout = 0 }, want: "timeout"},
+		{name: "trace file", modify: func(c *config.Client) { c.Tracing.File = "-" }},
+		{name: "trace endpoint without scheme", modify: func(c *config.Client) { c.Tracing.Endpoint = "localhost:4318" }, want: "endpoint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultClient()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
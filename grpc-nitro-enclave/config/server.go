@@ -0,0 +1,252 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/transport"
+)
+
+// DefaultPort is the default vsock port of the enclave server.
+const DefaultPort = "50051"
+
+// Server configures the enclave server.
+type Server struct {
+	File string `yaml:"-" flag:"config" env:"ENCLAVE_CONFIG" usage:"YAML configuration file"`
+
+	Transport      string        `yaml:"transport" flag:"transport" env:"ENCLAVE_TRANSPORT" usage:"listener transport: vsock, tcp or unix"`
+	Listen         string        `yaml:"listen" flag:"listen" env:"ENCLAVE_LISTEN" usage:"vsock port, TCP host:port or unix socket path"`
+	Attester       string        `yaml:"attester" flag:"attester" env:"ENCLAVE_ATTESTER" usage:"attestation provider: nsm or local"`
+	LocalRootOut   string        `yaml:"local_root_out" flag:"local-root-out" env:"ENCLAVE_LOCAL_ROOT_OUT" usage:"with -attester local, write the development root certificate to this PEM file"`
+	StartupTimeout time.Duration `yaml:"startup_timeout" flag:"startup-timeout" env:"ENCLAVE_STARTUP_TIMEOUT" usage:"timeout of the calls to KMS and sealed storage at startup"`
+	Reflection     bool          `yaml:"reflection" flag:"reflection" env:"ENCLAVE_REFLECTION" usage:"register gRPC server reflection; only allowed in debug-mode enclaves"`
+
+	KMS         KMS                `yaml:"kms"`
+	Sealed      Sealed             `yaml:"sealed"`
+	Attestation AttestationService `yaml:"attestation"`
+	Health      Health             `yaml:"health"`
+	Shutdown    Shutdown           `yaml:"shutdown"`
+	Metrics     Metrics            `yaml:"metrics"`
+	Tracing     Tracing            `yaml:"tracing"`
+}
+
+// KMS configures the self-test decrypting a data key with KMS at startup.
+type KMS struct {
+	Endpoint   string `yaml:"endpoint" flag:"kms-endpoint" env:"ENCLAVE_KMS_ENDPOINT" usage:"KMS endpoint URL (default https://kms.<region>.amazonaws.com)"`
+	Region     string `yaml:"region" flag:"kms-region" env:"AWS_REGION" usage:"AWS region of the KMS key"`
+	Tunnel     string `yaml:"tunnel" flag:"kms-tunnel" env:"ENCLAVE_KMS_TUNNEL" usage:"vsock cid:port of the proxy to KMS on the parent instance, empty to connect directly"`
+	Ciphertext string `yaml:"ciphertext" flag:"kms-ciphertext" env:"ENCLAVE_KMS_CIPHERTEXT" usage:"base64 KMS ciphertext of a data key to decrypt, as a self-test, and discard at startup"`
+}
+
+// Sealed configures sealed storage on the parent instance.
+type Sealed struct {
+	KeyRelease string `yaml:"key_release" flag:"key-release" env:"ENCLAVE_KEY_RELEASE" usage:"address of the key release service holding the sealing key, on the parent for vsock"`
+	BlobStore  string `yaml:"blob_store" flag:"blob-store" env:"ENCLAVE_BLOB_STORE" usage:"address of the blob store for sealed state, on the parent for vsock"`
+	Key        string `yaml:"key" flag:"sealing-key" env:"ENCLAVE_SEALING_KEY" usage:"identifier of the sealing key in the key release service"`
+}
+
+// Enabled reports whether sealed storage is configured.
+func (s Sealed) Enabled() bool {
+	return s.KeyRelease != "" && s.BlobStore != ""
+}
+
+// AttestationService configures GetAttestation.
+type AttestationService struct {
+	Rate           float64 `yaml:"rate" flag:"attestation-rate" env:"ENCLAVE_ATTESTATION_RATE" usage:"maximum rate of GetAttestation calls per second, 0 for no limit"`
+	Burst          int     `yaml:"burst" flag:"attestation-burst" env:"ENCLAVE_ATTESTATION_BURST" usage:"maximum burst of GetAttestation calls"`
+	AllowPublicKey bool    `yaml:"allow_public_key" flag:"attestation-allow-public-key" env:"ENCLAVE_ATTESTATION_ALLOW_PUBLIC_KEY" usage:"let GetAttestation callers bind a public key; UNSAFE if KMS or another service releases secrets to the public key of a document"`
+}
+
+// Health configures the health service.
+type Health struct {
+	Interval time.Duration `yaml:"interval" flag:"health-interval" env:"ENCLAVE_HEALTH_INTERVAL" usage:"interval between two NSM probes of the health service"`
+}
+
+// Shutdown configures the graceful shutdown on SIGTERM or SIGINT.
+type Shutdown struct {
+	Delay        time.Duration `yaml:"delay" flag:"shutdown-delay" env:"ENCLAVE_SHUTDOWN_DELAY" usage:"on SIGTERM or SIGINT, time to keep serving while reporting NOT_SERVING, so that load balancers stop sending new calls"`
+	DrainTimeout time.Duration `yaml:"drain_timeout" flag:"drain-timeout" env:"ENCLAVE_DRAIN_TIMEOUT" usage:"on shutdown, time to wait for in-flight calls before closing the remaining connections"`
+}
+
+// Metrics configures the Prometheus metrics endpoint.
+type Metrics struct {
+	Listen string `yaml:"listen" flag:"metrics-listen" env:"ENCLAVE_METRICS_LISTEN" usage:"vsock port, TCP host:port or unix socket path serving the metrics over HTTP at /metrics, on the transport of the server; empty to disable"`
+}
+
+// Tracing configures the export of the spans of the server.
+type Tracing struct {
+	Endpoint    string `yaml:"endpoint" flag:"trace-endpoint" env:"ENCLAVE_TRACE_ENDPOINT" usage:"OTLP/HTTP endpoint of the OpenTelemetry collector, e.g. http://collector:4318"`
+	Tunnel      string `yaml:"tunnel" flag:"trace-tunnel" env:"ENCLAVE_TRACE_TUNNEL" usage:"vsock cid:port of the proxy to the collector on the parent instance, empty to connect directly"`
+	File        string `yaml:"file" flag:"trace-file" env:"ENCLAVE_TRACE_FILE" usage:"append the spans as OTLP/JSON lines to this file, - for the standard output"`
+	ServiceName string `yaml:"service_name" flag:"trace-service" env:"OTEL_SERVICE_NAME" usage:"service.name of the exported spans"`
+}
+
+// Enabled reports whether spans are exported.
+func (t Tracing) Enabled() bool {
+	return t.Endpoint != "" || t.File != ""
+}
+
+// checkTracing checks the tracing settings shared by the server and the client.
+func checkTracing(endpoint, file, serviceName string) []error {
+	var errs []error
+	if endpoint != "" && file != "" {
+		errs = append(errs, errors.New("tracing: endpoint and file are mutually exclusive"))
+	}
+	if endpoint != "" {
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("tracing: invalid endpoint URL %q", endpoint))
+		}
+	}
+	if (endpoint != "" || file != "") && serviceName == "" {
+		errs = append(errs, errors.New("tracing: service_name must not be empty"))
+	}
+	return errs
+}
+
+// DefaultServer returns the default configuration of the enclave server.
+func DefaultServer() *Server {
+	return &Server{
+		Transport:      transport.VSock,
+		Listen:         DefaultPort,
+		Attester:       attester.KindNSM,
+		StartupTimeout: 30 * time.Second,
+		Sealed:         Sealed{Key: "sealing-key"},
+		Attestation:    AttestationService{Rate: service.DefaultAttestationRate, Burst: service.DefaultAttestationBurst},
+		Health:         Health{Interval: service.DefaultHealthInterval},
+		Shutdown:       Shutdown{DrainTimeout: 30 * time.Second},
+		Tracing:        Tracing{ServiceName: "enclave-server"},
+	}
+}
+
+// Validate checks the settings of the server.
+func (c *Server) Validate() error {
+	var errs []error
+	if err := checkListen(c.Transport, c.Listen); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.Attester {
+	case attester.KindNSM:
+		if c.LocalRootOut != "" {
+			errs = append(errs, errors.New("local_root_out requires the local attester"))
+		}
+	case attester.KindLocal:
+	default:
+		errs = append(errs, fmt.Errorf("unknown attester %q, expected %q or %q", c.Attester, attester.KindNSM, attester.KindLocal))
+	}
+	if c.StartupTimeout <= 0 {
+		errs = append(errs, errors.New("startup_timeout must be positive"))
+	}
+
+	if c.KMS.Ciphertext != "" && c.KMS.Endpoint == "" && c.KMS.Region == "" {
+		errs = append(errs, errors.New("kms: a region or an endpoint is required to decrypt the ciphertext"))
+	}
+	if c.KMS.Endpoint != "" {
+		if u, err := url.Parse(c.KMS.Endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("kms: invalid endpoint URL %q", c.KMS.Endpoint))
+		}
+	}
+	if c.KMS.Tunnel != "" {
+		if err := checkVSockAddress(c.KMS.Tunnel); err != nil {
+			errs = append(errs, fmt.Errorf("kms: tunnel: %w", err))
+		}
+	}
+
+	if (c.Sealed.KeyRelease == "") != (c.Sealed.BlobStore == "") {
+		errs = append(errs, errors.New("sealed: key_release and blob_store must be set together"))
+	}
+	if c.Sealed.Enabled() {
+		for name, address := range map[string]string{"key_release": c.Sealed.KeyRelease, "blob_store": c.Sealed.BlobStore} {
+			if err := checkDial(c.Transport, address); err != nil {
+				errs = append(errs, fmt.Errorf("sealed: %s: %w", name, err))
+			}
+		}
+		if c.Sealed.Key == "" {
+			errs = append(errs, errors.New("sealed: key must not be empty"))
+		}
+	}
+
+	if c.Attestation.Rate < 0 {
+		errs = append(errs, errors.New("attestation: rate must not be negative"))
+	}
+	if c.Attestation.Rate > 0 && c.Attestation.Burst < 1 {
+		errs = append(errs, errors.New("attestation: burst must be at least 1"))
+	}
+	if c.Health.Interval <= 0 {
+		errs = append(errs, errors.New("health: interval must be positive"))
+	}
+	if c.Metrics.Listen != "" {
+		if err := checkListen(c.Transport, c.Metrics.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("metrics: %w", err))
+		} else if c.Metrics.Listen == c.Listen {
+			errs = append(errs, errors.New("metrics: listen address must differ from the server address"))
+		}
+	}
+	if c.Shutdown.Delay < 0 || c.Shutdown.DrainTimeout < 0 {
+		errs = append(errs, errors.New("shutdown: delay and drain_timeout must not be negative"))
+	}
+	errs = append(errs, checkTracing(c.Tracing.Endpoint, c.Tracing.File, c.Tracing.ServiceName)...)
+	if c.Tracing.Tunnel != "" {
+		if c.Tracing.Endpoint == "" {
+			errs = append(errs, errors.New("tracing: tunnel requires an endpoint"))
+		} else if err := checkVSockAddress(c.Tracing.Tunnel); err != nil {
+			errs = append(errs, fmt.Errorf("tracing: tunnel: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkListen checks a listen address for transport.Listen.
+func checkListen(transportName, address string) error {
+	if address == "" {
+		return errors.New("listen address must not be empty")
+	}
+	switch transportName {
+	case transport.VSock:
+		if _, err := strconv.ParseUint(address, 10, 32); err != nil {
+			return fmt.Errorf("invalid vsock port %q", address)
+		}
+	case transport.TCP:
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("invalid TCP address %q: %w", address, err)
+		}
+	case transport.Unix:
+	default:
+		return fmt.Errorf("unknown transport %q, expected %q, %q or %q", transportName, transport.VSock, transport.TCP, transport.Unix)
+	}
+	return nil
+}
+
+// checkDial checks an address for transport.Dial.
+func checkDial(transportName, address string) error {
+	switch transportName {
+	case transport.VSock:
+		return checkVSockAddress(address)
+	case transport.TCP:
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("invalid TCP address %q: %w", address, err)
+		}
+	}
+	return nil
+}
+
+// checkVSockAddress checks a vsock address given as "cid:port" or "port".
+func checkVSockAddress(address string) error {
+	port := address
+	if c, p, ok := strings.Cut(address, ":"); ok {
+		if _, err := strconv.ParseUint(c, 10, 32); err != nil {
+			return fmt.Errorf("invalid vsock context ID in %q", address)
+		}
+		port = p
+	}
+	if _, err := strconv.ParseUint(port, 10, 32); err != nil {
+		return fmt.Errorf("invalid vsock port in %q", address)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+// Package echoclient calls EchoService and verifies that responses come from
+// an attested enclave.
+//
+// A Client is meant to be long-lived and shared. Connections created by Dial
+// use attestation-bound TLS with a ratls.Cache, so the attestation document of
+// a server certificate is verified on the first handshake and reused when the
+// client reconnects to the same server key, until the certificate chain
+// expires. The attestation of the enclave signing key is cached the same way:
+// it is verified once per server key and attested again when the server key
+// changes or the certificate chain of its document expires. Responses are then
+// verified with their signature only, without a new attestation document per call.
+package echoclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/metrics"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+	attpb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/ratls"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/signing"
+)
+
+// NonceSize is the size of the nonces generated by the client.
+const NonceSize = 32
+
+// Client is an EchoService client verifying the responses of the enclave. It
+// is safe for concurrent use.
+type Client struct {
+	// Now returns the current time, against which cached attestations expire.
+	// It defaults to time.Now.
+	Now func() time.Time
+
+	// Metrics records the attestation and signature verifications, if set.
+	// It must be set before the first call; Dial sets it.
+	Metrics *metrics.Client
+
+	echo  pb.EchoServiceClient
+	att   attpb.AttestationServiceClient
+	opts  attestation.VerifyOptions
+	conn  *grpc.ClientConn
+	cache *ratls.Cache
+
+	fetches singleflight.Group // signing key attestations, by server key
+
+	mu       sync.Mutex
+	verifier *signing.Verifier
+	peerKey  []byte // server key the signing key was attested through
+}
+
+// New returns a Client calling EchoService on conn. Attestation documents are
+// verified with opts; the client sets their Nonce and UserData.
+func New(conn grpc.ClientConnInterface, opts attestation.VerifyOptions) *Client {
+	return &Client{echo: pb.NewEchoServiceClient(conn), att: attpb.NewAttestationServiceClient(conn), opts: opts}
+}
+
+// Dial connects to the server at target over attestation-bound TLS, verifying
+// the server certificates with opts through a ratls.Cache, and returns a
+// Client using the connection. The verifications, including those of the TLS
+// handshakes, are recorded in m, if not nil. The client must be closed after use.
+func Dial(target string, opts attestation.VerifyOptions, m *metrics.Client, dialOpts ...grpc.DialOption) (*Client, error) {
+	cache := ratls.NewCache(opts, m)
+	conn, err := grpc.NewClient(target, append([]grpc.DialOption{grpc.WithTransportCredentials(cache.Credentials())}, dialOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+	c := New(conn, opts)
+	c.Metrics, c.conn, c.cache = m, conn, cache
+	return c, nil
+}
+
+// Connect starts connecting a client created by Dial and waits until the
+// connection is ready, so that the TLS handshake and the verification of the
+// server certificate happen before the first call. If the connection fails,
+// the error of the next call describes the cause. It does nothing for clients
+// created with New.
+func (c *Client) Connect(ctx context.Context) error {
+	if c.conn == nil {
+		return nil
+	}
+	c.conn.Connect()
+	for {
+		switch state := c.conn.GetState(); state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return fmt.Errorf("failed to connect: connection is %v", state)
+		default:
+			if !c.conn.WaitForStateChange(ctx, state) {
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// Close closes the connection created by Dial. It does nothing for clients
+// created with New.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Cache returns the cache of verified server certificates of a client created
+// by Dial, or nil.
+func (c *Client) Cache() *ratls.Cache {
+	return c.cache
+}
+
+func (c *Client) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// peerKey returns the hash of the TLS public key of the server p, or nil if
+// the connection does not use TLS.
+func peerKey(p *peer.Peer) []byte {
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil
+	}
+	h := sha256.Sum256(info.State.PeerCertificates[0].RawSubjectPublicKeyInfo)
+	return h[:]
+}
+
+// SigningKey returns the verifier of the enclave signing key, fetching and
+// verifying its attestation document if none is cached or the cached one has
+// expired.
+func (c *Client) SigningKey(ctx context.Context) (*signing.Verifier, error) {
+	return c.signingKey(ctx, nil)
+}
+
+// signingKey is SigningKey, also attesting the signing key again if it was
+// attested through another server key than the one given, if any. Concurrent
+// calls share a single attestation, and the cache is not locked during it.
+func (c *Client) signingKey(ctx context.Context, key []byte) (*signing.Verifier, error) {
+	for {
+		if v := c.cachedSigningKey(key); v != nil {
+			return v, nil
+		}
+		ch := c.fetches.DoChan(string(key), func() (any, error) {
+			if v := c.cachedSigningKey(key); v != nil {
+				return v, nil
+			}
+			return c.fetchSigningKey(ctx)
+		})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case r := <-ch:
+			// Attest again if the call that led the attestation gave up
+			if r.Err != nil && ctx.Err() == nil && canceled(r.Err) {
+				continue
+			}
+			if r.Err != nil {
+				return nil, r.Err
+			}
+			return r.Val.(*signing.Verifier), nil
+		}
+	}
+}
+
+// cachedSigningKey returns the cached verifier of the signing key if it has
+// not expired and was attested through the server key given, if any.
+func (c *Client) cachedSigningKey(key []byte) *signing.Verifier {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.verifier != nil && c.now().Before(c.verifier.Expiry()) && (key == nil || bytes.Equal(key, c.peerKey)) {
+		return c.verifier
+	}
+	return nil
+}
+
+// fetchSigningKey fetches and verifies the attestation of the signing key, and
+// caches its verifier.
+func (c *Client) fetchSigningKey(ctx context.Context) (*signing.Verifier, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	var p peer.Peer
+	r, err := c.echo.GetSigningKey(ctx, &pb.SigningKeyRequest{Nonce: nonce}, grpc.Peer(&p))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signing key: %w", err)
+	}
+	opts := c.opts
+	opts.Nonce = nonce
+	start := time.Now()
+	v, err := signing.NewVerifierContext(ctx, r.GetAttestationDocument(), opts)
+	c.Metrics.ObserveVerification("signing_key", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("signing key attestation verification failed: %w", err)
+	}
+	if !v.Matches(r.GetPublicKey()) {
+		return nil, errors.New("signing key does not match its attestation document")
+	}
+	c.mu.Lock()
+	c.verifier, c.peerKey = v, peerKey(&p)
+	c.mu.Unlock()
+	return v, nil
+}
+
+// canceled reports whether err comes from a canceled or expired context.
+func canceled(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	code := status.Code(err)
+	return code == codes.Canceled || code == codes.DeadlineExceeded
+}
+
+// Forget drops the cached signing key, so that the next call attests it again.
+func (c *Client) Forget() {
+	c.forget(nil)
+}
+
+// forget drops the cached signing key if it is v, or in any case if v is nil.
+func (c *Client) forget(v *signing.Verifier) {
+	c.mu.Lock()
+	if v == nil || c.verifier == v {
+		c.verifier = nil
+	}
+	c.mu.Unlock()
+}
+
+// Echo sends message without requesting an attestation document and returns
+// the response message once its signature verifies against the attested
+// signing key. If the signature does not verify, the cached key is dropped.
+func (c *Client) Echo(ctx context.Context, message string) (string, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return "", err
+	}
+	req := &pb.EchoRequest{Message: message, Nonce: nonce, SkipAttestation: true}
+	var p peer.Peer
+	r, err := c.echo.Echo(ctx, req, grpc.Peer(&p))
+	if err != nil {
+		return "", err
+	}
+	sig := r.GetSignature()
+	if sig == nil {
+		return "", errors.New("response is not signed")
+	}
+
+	// The signing key is attested through the server that answered, so that
+	// a new server key leads to a new attestation
+	v, err := c.signingKey(ctx, peerKey(&p))
+	if err != nil {
+		return "", err
+	}
+	start := time.Now()
+	err = v.Verify(service.HashEchoRequest(req), []byte(r.GetMessage()), sig.GetCounter(), sig.GetSignature())
+	c.Metrics.ObserveVerification("signature", start, err)
+	if err != nil {
+		if errors.Is(err, signing.ErrSignature) {
+			c.forget(v)
+		}
+		return "", err
+	}
+	return r.GetMessage(), nil
+}
+
+// EchoAttested sends message and returns the response message once the
+// attestation document of the response verifies, binding the request nonce
+// and the hash of the response message.
+func (c *Client) EchoAttested(ctx context.Context, message string) (string, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return "", err
+	}
+	r, err := c.echo.Echo(ctx, &pb.EchoRequest{Message: message, Nonce: nonce})
+	if err != nil {
+		return "", err
+	}
+	if len(r.GetAttestationDocument()) == 0 {
+		return "", errors.New("no attestation document received from server")
+	}
+	userData := sha256.Sum256([]byte(r.GetMessage()))
+	opts := c.opts
+	opts.Nonce, opts.UserData = nonce, userData[:]
+	start := time.Now()
+	_, err = attestation.VerifyContext(ctx, r.GetAttestationDocument(), opts)
+	c.Metrics.ObserveVerification("response", start, err)
+	if err != nil {
+		return "", fmt.Errorf("attestation document verification failed: %w", err)
+	}
+	return r.GetMessage(), nil
+}
+
+// Attest requests a fresh attestation document from AttestationService,
+// binding a new nonce, userData and publicKey, and verifies it. It returns the
+// encoded document and its parsed payload. The user_data field of the document
+// is attestation.OnDemandUserData(userData), and the document is rejected by
+// verifiers that do not set VerifyOptions.AllowOnDemand. A publicKey is refused
+// unless the server allows binding public keys.
+func (c *Client) Attest(ctx context.Context, userData, publicKey []byte) ([]byte, *attestation.AttestationDocument, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := c.att.GetAttestation(ctx, &attpb.GetAttestationRequest{Nonce: nonce, UserData: userData, PublicKey: publicKey})
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := c.opts
+	opts.Nonce, opts.UserData = nonce, attestation.OnDemandUserData(userData)
+	opts.AllowOnDemand = true
+	start := time.Now()
+	doc, err := attestation.VerifyContext(ctx, r.GetAttestationDocument(), opts)
+	c.Metrics.ObserveVerification("attestation", start, err)
+	if err != nil {
+		return nil, nil, fmt.Errorf("attestation document verification failed: %w", err)
+	}
+	if !bytes.Equal(doc.PublicKey, publicKey) {
+		return nil, nil, errors.New("attestation document does not bind the public key")
+	}
+	return r.GetAttestationDocument(), doc, nil
+}
@@ -0,0 +1,277 @@
+package echoclient_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/echoclient"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/metrics"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+	attpb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/ratls"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/signing"
+)
+
+// countingNSM counts the attestation documents it issues for the signing key.
+type countingNSM struct {
+	*attestertest.NSM
+	signingKey []byte
+	count      atomic.Int32
+}
+
+func (n *countingNSM) Attest(nonce, userData, publicKey []byte) ([]byte, error) {
+	if bytes.Equal(publicKey, n.signingKey) {
+		n.count.Add(1)
+	}
+	return n.NSM.Attest(nonce, userData, publicKey)
+}
+
+// enclave serves EchoService on in-memory listeners; every start uses a new
+// TLS key, like a restarted enclave, and the same signing key.
+type enclave struct {
+	nsm    *countingNSM
+	signer *signing.Signer
+
+	mu  sync.Mutex
+	lis *bufconn.Listener
+	srv *grpc.Server
+}
+
+func newEnclave(t *testing.T) *enclave {
+	t.Helper()
+	mock, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	key, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	e := &enclave{nsm: &countingNSM{NSM: mock, signingKey: signer.PublicKey()}, signer: signer}
+	t.Cleanup(e.stop)
+	e.start(t)
+	return e
+}
+
+func (e *enclave) start(t *testing.T) {
+	t.Helper()
+	creds, err := ratls.NewServerCredentials(func(publicKey []byte) ([]byte, error) {
+		return e.nsm.Attest(nil, nil, publicKey)
+	})
+	if err != nil {
+		t.Fatalf("NewServerCredentials: %v", err)
+	}
+	s := grpc.NewServer(grpc.Creds(creds))
+	pb.RegisterEchoServiceServer(s, service.NewEcho(e.nsm, e.signer))
+	att := service.NewAttestation(e.nsm, 0, 0)
+	att.AllowPublicKey = true
+	attpb.RegisterAttestationServiceServer(s, att)
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+
+	e.mu.Lock()
+	e.lis, e.srv = lis, s
+	e.mu.Unlock()
+}
+
+func (e *enclave) stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.srv.Stop()
+}
+
+func (e *enclave) dial(ctx context.Context, _ string) (net.Conn, error) {
+	e.mu.Lock()
+	lis := e.lis
+	e.mu.Unlock()
+	return lis.DialContext(ctx)
+}
+
+func (e *enclave) verifyOptions() attestation.VerifyOptions {
+	return attestation.VerifyOptions{
+		Roots:  e.nsm.CA.Roots(),
+		Policy: &attestation.PCRPolicy{Allowed: []attestation.Measurements{{0: e.nsm.PCRs[0]}}},
+	}
+}
+
+func dial(t *testing.T, e *enclave) *echoclient.Client {
+	t.Helper()
+	c, err := echoclient.Dial("passthrough:///bufnet", e.verifyOptions(), nil,
+		grpc.WithContextDialer(e.dial),
+		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),
+	)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func echo(t *testing.T, c *echoclient.Client, message string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := c.Echo(ctx, message)
+	if err != nil {
+		t.Fatalf("Echo(%q): %v", message, err)
+	}
+	if want := "Echo: " + message; r != want {
+		t.Errorf("Echo(%q) = %q, want %q", message, r, want)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	e := newEnclave(t)
+	c := dial(t, e)
+	for _, message := range []string{"hello", "again", "and again"} {
+		echo(t, c, message)
+	}
+	// Only the first call attested the signing key
+	if n := e.nsm.count.Load(); n != 1 {
+		t.Errorf("signing key attested %d times, want 1", n)
+	}
+	if n := c.Cache().Len(); n != 1 {
+		t.Errorf("%d server certificates cached, want 1", n)
+	}
+
+	v, err := c.SigningKey(context.Background())
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+	if !v.Matches(e.signer.PublicKey()) {
+		t.Error("cached signing key differs from the server key")
+	}
+
+	r, err := c.EchoAttested(context.Background(), "attested")
+	if err != nil {
+		t.Fatalf("EchoAttested: %v", err)
+	}
+	if r != "Echo: attested" {
+		t.Errorf("EchoAttested = %q, want %q", r, "Echo: attested")
+	}
+}
+
+func TestConcurrentEcho(t *testing.T) {
+	e := newEnclave(t)
+	c := dial(t, e)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Echo(context.Background(), "hello"); err != nil {
+				t.Errorf("Echo: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	// The concurrent calls shared one attestation of the signing key
+	if n := e.nsm.count.Load(); n != 1 {
+		t.Errorf("signing key attested %d times, want 1", n)
+	}
+}
+
+func TestDialMetrics(t *testing.T) {
+	e := newEnclave(t)
+	registry := prometheus.NewRegistry()
+	c, err := echoclient.Dial("passthrough:///bufnet", e.verifyOptions(), metrics.NewClient(registry),
+		grpc.WithContextDialer(e.dial),
+	)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	echo(t, c, "hello")
+
+	// The verification of the first handshake is recorded
+	path := filepath.Join(t.TempDir(), "client.prom")
+	if err := prometheus.WriteToTextfile(path, registry); err != nil {
+		t.Fatalf("WriteToTextfile: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	for _, want := range []string{
+		`enclave_client_verifications_total{kind="tls",result="ok"} 1`,
+		`enclave_client_verifications_total{kind="signing_key",result="ok"} 1`,
+		`enclave_client_tls_cache_lookups_total{result="miss"} 1`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("metrics do not contain %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestReattestOnNewServerKey(t *testing.T) {
+	e := newEnclave(t)
+	c := dial(t, e)
+	echo(t, c, "hello")
+
+	// The restarted server presents a new TLS key
+	e.stop()
+	e.start(t)
+	echo(t, c, "hello again")
+
+	if n := e.nsm.count.Load(); n != 2 {
+		t.Errorf("signing key attested %d times, want 2", n)
+	}
+	if n := c.Cache().Len(); n != 2 {
+		t.Errorf("%d server certificates cached, want 2", n)
+	}
+}
+
+func TestReattestOnExpiry(t *testing.T) {
+	e := newEnclave(t)
+	c := dial(t, e)
+	now := time.Now()
+	c.Now = func() time.Time { return now }
+	echo(t, c, "hello")
+
+	v, err := c.SigningKey(context.Background())
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+	now = v.Expiry()
+	echo(t, c, "hello again")
+
+	if n := e.nsm.count.Load(); n != 2 {
+		t.Errorf("signing key attested %d times, want 2", n)
+	}
+}
+
+func TestAttest(t *testing.T) {
+	e := newEnclave(t)
+	c := dial(t, e)
+	raw, doc, err := c.Attest(context.Background(), []byte("user data"), []byte("public key"))
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+	if len(raw) == 0 || !bytes.Equal(doc.UserData, attestation.OnDemandUserData([]byte("user data"))) || string(doc.PublicKey) != "public key" {
+		t.Errorf("Attest returned a document with user data %q and public key %q", doc.UserData, doc.PublicKey)
+	}
+}
@@ -0,0 +1,248 @@
+package echoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/signing"
+)
+
+// session verifies the responses of an attested stream.
+type session struct {
+	verifier   *signing.Verifier
+	transcript *service.StreamTranscript
+
+	mu       sync.Mutex
+	sent     uint64
+	received uint64
+}
+
+// attestStream returns a context carrying a fresh nonce for a new stream.
+func attestStream(ctx context.Context) (context.Context, []byte, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx, service.NonceMetadataKey, string(nonce)), nonce, nil
+}
+
+// newSession verifies the attestation document in the header of stream,
+// which must bind nonce and the signing key.
+func (c *Client) newSession(stream grpc.ClientStream, nonce []byte) (*session, error) {
+	header, err := stream.Header()
+	if err != nil {
+		return nil, err
+	}
+	docs := header.Get(service.AttestationMetadataKey)
+	if len(docs) != 1 {
+		// The stream failed before it was attested; report its status.
+		if err := stream.RecvMsg(new(pb.EchoStreamResponse)); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		return nil, errors.New("no attestation document received from server")
+	}
+	opts := c.opts
+	opts.Nonce = nonce
+	start := time.Now()
+	v, err := signing.NewVerifierContext(stream.Context(), []byte(docs[0]), opts)
+	c.Metrics.ObserveVerification("stream", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("stream attestation verification failed: %w", err)
+	}
+	return &session{verifier: v, transcript: service.NewStreamTranscript([]byte(docs[0]))}, nil
+}
+
+// request numbers req and absorbs it into the transcript.
+func (s *session) request(req *pb.EchoStreamRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent++
+	req.Sequence = s.sent
+	s.transcript.AddRequest(req)
+}
+
+// verify checks the sequence number and the signature of resp against
+// transcript, the transcript of the requests it answers.
+func (s *session) verify(resp *pb.EchoStreamResponse, transcript *service.StreamTranscript) error {
+	s.mu.Lock()
+	want := s.received + 1
+	s.mu.Unlock()
+	if resp.GetSequence() != want {
+		return fmt.Errorf("response sequence number %d, expected %d", resp.GetSequence(), want)
+	}
+	sig := resp.GetSignature()
+	if sig == nil {
+		return errors.New("response is not signed")
+	}
+	if err := s.verifier.Verify(transcript.ResponseHash(want), []byte(resp.GetMessage()), sig.GetCounter(), sig.GetSignature()); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.received = want
+	s.mu.Unlock()
+	return nil
+}
+
+// EchoServerStream sends message and calls fn with each of the count response
+// messages, once their signatures verify against the attestation of the stream.
+func (c *Client) EchoServerStream(ctx context.Context, message string, count uint32, fn func(string) error) error {
+	ctx, nonce, err := attestStream(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req := &pb.EchoStreamRequest{Sequence: 1, Message: message, Count: count}
+	stream, err := c.echo.EchoServerStream(ctx, req)
+	if err != nil {
+		return err
+	}
+	s, err := c.newSession(stream, nonce)
+	if err != nil {
+		return err
+	}
+	s.request(req)
+	transcript := s.transcript.Clone()
+
+	if count == 0 {
+		count = 1
+	}
+	for i := uint32(0); i < count; i++ {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if err := s.verify(resp, transcript); err != nil {
+			return err
+		}
+		if err := fn(resp.GetMessage()); err != nil {
+			return err
+		}
+	}
+	if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+		if err == nil {
+			err = errors.New("server sent more responses than requested")
+		}
+		return err
+	}
+	return nil
+}
+
+// EchoClientStream sends messages on one stream and returns the response
+// message once its signature verifies against the attestation of the stream.
+func (c *Client) EchoClientStream(ctx context.Context, messages []string) (string, error) {
+	ctx, nonce, err := attestStream(ctx)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.echo.EchoClientStream(ctx)
+	if err != nil {
+		return "", err
+	}
+	s, err := c.newSession(stream, nonce)
+	if err != nil {
+		return "", err
+	}
+	for _, message := range messages {
+		req := &pb.EchoStreamRequest{Message: message}
+		s.request(req)
+		if err := stream.Send(req); err != nil {
+			break // the error is returned by CloseAndRecv
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+	if err := s.verify(resp, s.transcript); err != nil {
+		return "", err
+	}
+	return resp.GetMessage(), nil
+}
+
+// Stream is an attested bidirectional echo stream. Send and Recv may be
+// called from different goroutines.
+type Stream struct {
+	stream  pb.EchoService_EchoBidiStreamClient
+	session *session
+	cancel  context.CancelFunc
+
+	mu      sync.Mutex
+	pending []*service.StreamTranscript // transcripts of the unanswered requests
+}
+
+// EchoStream opens a bidirectional stream. Every response answers the
+// request with the same sequence number. The stream must be closed after use.
+func (c *Client) EchoStream(ctx context.Context) (*Stream, error) {
+	ctx, nonce, err := attestStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.echo.EchoBidiStream(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s, err := c.newSession(stream, nonce)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Stream{stream: stream, session: s, cancel: cancel}, nil
+}
+
+// Send sends message on the stream.
+func (s *Stream) Send(message string) error {
+	req := &pb.EchoStreamRequest{Message: message}
+	s.mu.Lock()
+	s.session.request(req)
+	s.pending = append(s.pending, s.session.transcript.Clone())
+	s.mu.Unlock()
+	return s.stream.Send(req)
+}
+
+// Recv returns the next response message once its signature verifies against
+// the attestation of the stream. It returns io.EOF when the server has ended
+// the stream.
+func (s *Stream) Recv() (string, error) {
+	resp, err := s.stream.Recv()
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return "", errors.New("response to a request that was not sent")
+	}
+	transcript := s.pending[0]
+	s.pending = s.pending[1:]
+	s.mu.Unlock()
+	if err := s.session.verify(resp, transcript); err != nil {
+		return "", err
+	}
+	return resp.GetMessage(), nil
+}
+
+// CloseSend tells the server that no more messages will be sent.
+func (s *Stream) CloseSend() error {
+	return s.stream.CloseSend()
+}
+
+// Close cancels the stream.
+func (s *Stream) Close() {
+	s.cancel()
+}
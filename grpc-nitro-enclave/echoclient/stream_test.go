@@ -0,0 +1,87 @@
+package echoclient_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEchoServerStream(t *testing.T) {
+	e := newEnclave(t)
+	c := dial(t, e)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var got []string
+	err := c.EchoServerStream(ctx, "hello", 5, func(message string) error {
+		got = append(got, message)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EchoServerStream: %v", err)
+	}
+	if len(got) != 5 || got[4] != "Echo: hello" {
+		t.Errorf("EchoServerStream responses = %q, want 5 times %q", got, "Echo: hello")
+	}
+	// The stream was attested once
+	if n := e.nsm.count.Load(); n != 1 {
+		t.Errorf("signing key attested %d times, want 1", n)
+	}
+}
+
+func TestEchoClientStream(t *testing.T) {
+	e := newEnclave(t)
+	c := dial(t, e)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, err := c.EchoClientStream(ctx, []string{"one", "two", "three"})
+	if err != nil {
+		t.Fatalf("EchoClientStream: %v", err)
+	}
+	if want := "Echo: one two three"; r != want {
+		t.Errorf("EchoClientStream = %q, want %q", r, want)
+	}
+}
+
+func TestEchoStream(t *testing.T) {
+	e := newEnclave(t)
+	c := dial(t, e)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s, err := c.EchoStream(ctx)
+	if err != nil {
+		t.Fatalf("EchoStream: %v", err)
+	}
+	defer s.Close()
+
+	// Requests are sent ahead of the responses
+	const n = 10
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := s.Send(fmt.Sprint(i)); err != nil {
+				return
+			}
+		}
+		s.CloseSend()
+	}()
+	for i := 0; i < n; i++ {
+		r, err := s.Recv()
+		if err != nil {
+			t.Fatalf("Recv %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("Echo: %d", i); r != want {
+			t.Errorf("Recv %d = %q, want %q", i, r, want)
+		}
+	}
+	if _, err := s.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("Recv after the last response = %v, want %v", err, io.EOF)
+	}
+	if n := e.nsm.count.Load(); n != 1 {
+		t.Errorf("signing key attested %d times, want 1", n)
+	}
+}
@@ -0,0 +1,57 @@
+package keyrelease
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/keyrelease"
+)
+
+// Fetch obtains the secret secretID from a key release service. It runs inside
+// the enclave: it generates an ephemeral key pair, binds its public half and the
+// server challenge into an attestation document from att, and decrypts the
+// released secret with the private half.
+func Fetch(ctx context.Context, client pb.KeyReleaseServiceClient, att attester.Attester, secretID string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	challenge, err := client.GetChallenge(ctx, &pb.ChallengeRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get challenge: %w", err)
+	}
+	doc, err := attester.AttestContext(ctx, att, challenge.GetNonce(), nil, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain attestation document: %w", err)
+	}
+
+	r, err := client.ReleaseSecret(ctx, &pb.ReleaseSecretRequest{
+		SecretId:            secretID,
+		AttestationDocument: doc,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to release secret %q: %w", secretID, err)
+	}
+	secret := r.GetSecret()
+	plaintext, err := Open(key, &Envelope{
+		Algorithm:    secret.GetAlgorithm(),
+		EncryptedKey: secret.GetEncryptedKey(),
+		EphemeralKey: secret.GetEphemeralPublicKey(),
+		Nonce:        secret.GetNonce(),
+		Ciphertext:   secret.GetCiphertext(),
+	}, []byte(secretID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret %q: %w", secretID, err)
+	}
+	return plaintext, nil
+}
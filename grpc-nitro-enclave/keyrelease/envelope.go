@@ -0,0 +1,197 @@
+package keyrelease
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// Envelope encryption algorithms. The secret is encrypted with AES-256-GCM
+// under a random content key, which is either wrapped with RSA-OAEP or derived
+// from an ephemeral ECDH exchange with the recipient key.
+const (
+	AlgorithmRSAOAEP = "RSA-OAEP-256+A256GCM"
+	AlgorithmECDHES  = "ECDH-ES+HKDF-SHA256+A256GCM"
+)
+
+// MinRSAKeySize is the smallest accepted RSA recipient key, in bits.
+const MinRSAKeySize = 2048
+
+// Envelope is a secret encrypted to a public key.
+type Envelope struct {
+	Algorithm    string
+	EncryptedKey []byte // RSA-OAEP wrapped content key
+	EphemeralKey []byte // ECDH ephemeral public key, PKIX DER
+	Nonce        []byte // AES-GCM nonce
+	Ciphertext   []byte
+}
+
+// Seal encrypts plaintext to the PKIX DER encoded RSA, ECDSA or X25519 public
+// key, as found in the public_key field of an attestation document. The
+// additional data aad is authenticated but not encrypted.
+func Seal(publicKey, plaintext, aad []byte) (*Envelope, error) {
+	pub, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse recipient public key: %w", err)
+	}
+
+	var env Envelope
+	var key []byte
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < MinRSAKeySize {
+			return nil, fmt.Errorf("RSA recipient key is %d bits, want at least %d", pub.N.BitLen(), MinRSAKeySize)
+		}
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		env.Algorithm = AlgorithmRSAOAEP
+		if env.EncryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil); err != nil {
+			return nil, fmt.Errorf("failed to wrap content key: %w", err)
+		}
+	case *ecdsa.PublicKey, *ecdh.PublicKey:
+		recipient, err := ecdhPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		ephemeral, err := recipient.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := ephemeral.ECDH(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive content key: %w", err)
+		}
+		env.Algorithm = AlgorithmECDHES
+		if env.EphemeralKey, err = x509.MarshalPKIXPublicKey(ephemeral.PublicKey()); err != nil {
+			return nil, err
+		}
+		recipientKey, err := x509.MarshalPKIXPublicKey(recipient)
+		if err != nil {
+			return nil, err
+		}
+		key = deriveKey(shared, env.EphemeralKey, recipientKey)
+	default:
+		return nil, fmt.Errorf("unsupported recipient key type %T", pub)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	env.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return nil, err
+	}
+	env.Ciphertext = aead.Seal(nil, env.Nonce, plaintext, aad)
+	return &env, nil
+}
+
+// Open decrypts env with the private key matching the public key it was sealed
+// to: an *rsa.PrivateKey, *ecdsa.PrivateKey or *ecdh.PrivateKey.
+func Open(privateKey crypto.PrivateKey, env *Envelope, aad []byte) ([]byte, error) {
+	var key []byte
+	switch env.Algorithm {
+	case AlgorithmRSAOAEP:
+		priv, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s envelope needs an RSA private key, got %T", env.Algorithm, privateKey)
+		}
+		var err error
+		if key, err = rsa.DecryptOAEP(sha256.New(), nil, priv, env.EncryptedKey, nil); err != nil {
+			return nil, fmt.Errorf("failed to unwrap content key: %w", err)
+		}
+	case AlgorithmECDHES:
+		priv, err := ecdhPrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		ephemeralKey, err := x509.ParsePKIXPublicKey(env.EphemeralKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ephemeral public key: %w", err)
+		}
+		ephemeral, err := ecdhPublicKey(ephemeralKey)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := priv.ECDH(ephemeral)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive content key: %w", err)
+		}
+		recipientKey, err := x509.MarshalPKIXPublicKey(priv.PublicKey())
+		if err != nil {
+			return nil, err
+		}
+		key = deriveKey(shared, env.EphemeralKey, recipientKey)
+	default:
+		return nil, fmt.Errorf("unsupported envelope algorithm %q", env.Algorithm)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(env.Nonce))
+	}
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, aad)
+	if err != nil {
+		return nil, errors.New("failed to decrypt secret")
+	}
+	return plaintext, nil
+}
+
+func ecdhPublicKey(pub crypto.PublicKey) (*ecdh.PublicKey, error) {
+	switch pub := pub.(type) {
+	case *ecdh.PublicKey:
+		return pub, nil
+	case *ecdsa.PublicKey:
+		return pub.ECDH()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T for ECDH", pub)
+	}
+}
+
+func ecdhPrivateKey(priv crypto.PrivateKey) (*ecdh.PrivateKey, error) {
+	switch priv := priv.(type) {
+	case *ecdh.PrivateKey:
+		return priv, nil
+	case *ecdsa.PrivateKey:
+		return priv.ECDH()
+	default:
+		return nil, fmt.Errorf("%s envelope needs an EC private key, got %T", AlgorithmECDHES, priv)
+	}
+}
+
+// deriveKey derives the content key from the ECDH shared secret with
+// HKDF-SHA256 (RFC 5869), binding both public keys.
+func deriveKey(shared, ephemeralKey, recipientKey []byte) []byte {
+	extract := hmac.New(sha256.New, nil)
+	extract.Write(shared)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write([]byte(AlgorithmECDHES))
+	expand.Write(ephemeralKey)
+	expand.Write(recipientKey)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
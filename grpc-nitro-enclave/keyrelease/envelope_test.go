@@ -0,0 +1,104 @@
+package keyrelease_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/keyrelease"
+)
+
+func TestSealOpen(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		private crypto.PrivateKey
+		public  crypto.PublicKey
+		wantAlg string
+	}{
+		{name: "RSA", private: rsaKey, public: &rsaKey.PublicKey, wantAlg: keyrelease.AlgorithmRSAOAEP},
+		{name: "P-256", private: p256, public: &p256.PublicKey, wantAlg: keyrelease.AlgorithmECDHES},
+		{name: "P-384", private: p384, public: &p384.PublicKey, wantAlg: keyrelease.AlgorithmECDHES},
+		{name: "X25519", private: x25519, public: x25519.PublicKey(), wantAlg: keyrelease.AlgorithmECDHES},
+	}
+
+	secret := []byte("correct horse battery staple")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			der, err := x509.MarshalPKIXPublicKey(tt.public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env, err := keyrelease.Seal(der, secret, []byte("id"))
+			if err != nil {
+				t.Fatalf("Seal: %v", err)
+			}
+			if env.Algorithm != tt.wantAlg {
+				t.Errorf("Algorithm = %q, want %q", env.Algorithm, tt.wantAlg)
+			}
+			if bytes.Contains(env.Ciphertext, secret) {
+				t.Error("ciphertext contains the secret")
+			}
+
+			got, err := keyrelease.Open(tt.private, env, []byte("id"))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if !bytes.Equal(got, secret) {
+				t.Errorf("Open = %q, want %q", got, secret)
+			}
+
+			if _, err := keyrelease.Open(tt.private, env, []byte("other id")); err == nil {
+				t.Error("Open succeeded with other additional data")
+			}
+			tampered := *env
+			tampered.Ciphertext = append([]byte(nil), env.Ciphertext...)
+			tampered.Ciphertext[0] ^= 1
+			if _, err := keyrelease.Open(tt.private, &tampered, []byte("id")); err == nil {
+				t.Error("Open succeeded with a tampered ciphertext")
+			}
+		})
+	}
+}
+
+func TestSealRejects(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallDER, err := x509.MarshalPKIXPublicKey(&small.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, key := range map[string][]byte{
+		"not a key":     []byte("public key"),
+		"small RSA key": smallDER,
+	} {
+		if _, err := keyrelease.Seal(key, []byte("secret"), nil); err == nil {
+			t.Errorf("Seal with %s succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Package keyrelease implements a service that holds secrets and releases them
+// only to enclaves that present a fresh attestation document matching a PCR
+// policy, encrypted to the public key bound into that document.
+//
+// The enclave first requests a single-use challenge nonce, then obtains an
+// attestation document binding that nonce and the public half of an ephemeral
+// key pair, and sends it with the identifier of the secret. Fetch implements
+// the enclave side of this exchange.
+package keyrelease
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/keyrelease"
+)
+
+// Defaults for Options.
+const (
+	DefaultChallengeTTL  = time.Minute
+	DefaultMaxChallenges = 10000
+)
+
+// nonceSize is the size of the challenge nonces.
+const nonceSize = 32
+
+// Options configures a Server.
+type Options struct {
+	// Secrets maps secret identifiers to their values.
+	Secrets map[string][]byte
+
+	// Verify configures the verification of attestation documents. Its Policy
+	// applies to secrets without an entry in Policies. Nonce, UserData and
+	// MaxAge are set by the server.
+	Verify attestation.VerifyOptions
+
+	// Policies optionally sets the PCR policy of individual secrets, for
+	// example the upgrade policy of a sealing key.
+	Policies map[string]*attestation.PCRPolicy
+
+	// ChallengeTTL is how long a challenge nonce can be used, and the maximum
+	// age of the attestation document. Defaults to DefaultChallengeTTL.
+	ChallengeTTL time.Duration
+
+	// MaxChallenges limits the number of outstanding challenges.
+	// Defaults to DefaultMaxChallenges.
+	MaxChallenges int
+}
+
+// Server implements KeyReleaseService.
+type Server struct {
+	pb.UnimplementedKeyReleaseServiceServer
+	opts Options
+	now  func() time.Time
+
+	mu         sync.Mutex
+	challenges map[string]time.Time // nonce to expiry
+}
+
+// NewServer returns a KeyReleaseService releasing opts.Secrets to enclaves
+// that satisfy opts.Verify.
+func NewServer(opts Options) (*Server, error) {
+	for id := range opts.Secrets {
+		if policy := opts.policy(id); policy == nil || len(policy.Allowed) == 0 {
+			return nil, fmt.Errorf("keyrelease: secret %q has no PCR policy", id)
+		}
+	}
+	if len(opts.Secrets) == 0 && opts.Verify.Policy == nil {
+		return nil, errors.New("keyrelease: a PCR policy is required")
+	}
+	if opts.ChallengeTTL <= 0 {
+		opts.ChallengeTTL = DefaultChallengeTTL
+	}
+	if opts.MaxChallenges <= 0 {
+		opts.MaxChallenges = DefaultMaxChallenges
+	}
+	return &Server{opts: opts, now: time.Now, challenges: make(map[string]time.Time)}, nil
+}
+
+func (s *Server) GetChallenge(ctx context.Context, in *pb.ChallengeRequest) (*pb.ChallengeResponse, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate nonce: %v", err)
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for n, expiry := range s.challenges {
+		if now.After(expiry) {
+			delete(s.challenges, n)
+		}
+	}
+	if len(s.challenges) >= s.opts.MaxChallenges {
+		return nil, status.Error(codes.ResourceExhausted, "too many outstanding challenges")
+	}
+	s.challenges[string(nonce)] = now.Add(s.opts.ChallengeTTL)
+
+	return &pb.ChallengeResponse{
+		Nonce:      nonce,
+		TtlSeconds: uint32(s.opts.ChallengeTTL / time.Second),
+	}, nil
+}
+
+// policy returns the PCR policy of the secret id.
+func (o *Options) policy(id string) *attestation.PCRPolicy {
+	if p, ok := o.Policies[id]; ok {
+		return p
+	}
+	return o.Verify.Policy
+}
+
+func (s *Server) ReleaseSecret(ctx context.Context, in *pb.ReleaseSecretRequest) (*pb.ReleaseSecretResponse, error) {
+	opts := s.opts.Verify
+	opts.Policy = s.opts.policy(in.GetSecretId())
+	if opts.Policy == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown secret %q", in.GetSecretId())
+	}
+	opts.Nonce = nil
+	opts.UserData = nil
+	opts.CurrentTime = s.now()
+	opts.MaxAge = s.opts.ChallengeTTL
+
+	// Validate the whole request before consuming the challenge, so that
+	// invalid requests cannot burn the challenges of others and a refused
+	// request can be retried with the same challenge
+	doc, err := attestation.Verify(in.GetAttestationDocument(), opts)
+	if err != nil {
+		log.Printf("Refused secret %q: %v", in.GetSecretId(), err)
+		return nil, status.Errorf(codes.PermissionDenied, "attestation verification failed: %v", err)
+	}
+	if len(doc.PublicKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "attestation document has no public key")
+	}
+	secret, ok := s.opts.Secrets[in.GetSecretId()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown secret %q", in.GetSecretId())
+	}
+
+	// Encrypt the secret to the enclave key, authenticating the secret
+	// identifier. The envelope is only returned once the challenge is consumed.
+	env, err := Seal(doc.PublicKey, secret, []byte(in.GetSecretId()))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to encrypt secret: %v", err)
+	}
+	if !s.consumeChallenge(doc.Nonce) {
+		log.Printf("Refused secret %q: unknown or expired challenge", in.GetSecretId())
+		return nil, status.Error(codes.PermissionDenied, "attestation document does not bind a valid challenge")
+	}
+	log.Printf("Released secret %q to enclave %s", in.GetSecretId(), doc.ModuleID)
+
+	return &pb.ReleaseSecretResponse{Secret: &pb.EncryptedSecret{
+		Algorithm:          env.Algorithm,
+		EncryptedKey:       env.EncryptedKey,
+		EphemeralPublicKey: env.EphemeralKey,
+		Nonce:              env.Nonce,
+		Ciphertext:         env.Ciphertext,
+	}}, nil
+}
+
+// consumeChallenge removes nonce from the outstanding challenges and reports
+// whether it was issued and has not expired.
+func (s *Server) consumeChallenge(nonce []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiry, ok := s.challenges[string(nonce)]
+	if !ok {
+		return false
+	}
+	delete(s.challenges, string(nonce))
+	return !s.now().After(expiry)
+}
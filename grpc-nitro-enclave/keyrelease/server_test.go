@@ -0,0 +1,234 @@
+package keyrelease_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/keyrelease"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/keyrelease"
+)
+
+var secret = []byte("database password")
+
+// startServer serves KeyReleaseService for documents of nsm on an in-memory listener.
+func startServer(t *testing.T, nsm *attestertest.NSM, policy *attestation.PCRPolicy, ttl time.Duration) pb.KeyReleaseServiceClient {
+	t.Helper()
+	srv, err := keyrelease.NewServer(keyrelease.Options{
+		Secrets:      map[string][]byte{"db": secret},
+		Verify:       attestation.VerifyOptions{Roots: nsm.CA.Roots(), Policy: policy},
+		ChallengeTTL: ttl,
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	pb.RegisterKeyReleaseServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewKeyReleaseServiceClient(conn)
+}
+
+func newNSM(t *testing.T) (*attestertest.NSM, *attestation.PCRPolicy) {
+	t.Helper()
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	return nsm, &attestation.PCRPolicy{Allowed: []attestation.Measurements{{0: nsm.PCRs[0], 2: nsm.PCRs[2]}}}
+}
+
+func publicKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestFetch(t *testing.T) {
+	nsm, policy := newNSM(t)
+	c := startServer(t, nsm, policy, 0)
+
+	got, err := keyrelease.Fetch(context.Background(), c, nsm, "db")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if !bytes.Equal(got, secret) {
+		t.Errorf("Fetch = %q, want %q", got, secret)
+	}
+}
+
+func TestNewServerRequiresPolicy(t *testing.T) {
+	if _, err := keyrelease.NewServer(keyrelease.Options{}); err == nil {
+		t.Error("NewServer without a PCR policy succeeded")
+	}
+}
+
+func TestReleaseSecretRefuses(t *testing.T) {
+	nsm, policy := newNSM(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		request  func(t *testing.T, c pb.KeyReleaseServiceClient) *pb.ReleaseSecretRequest
+		wantCode codes.Code
+	}{
+		{
+			name: "PCR mismatch",
+			request: func(t *testing.T, c pb.KeyReleaseServiceClient) *pb.ReleaseSecretRequest {
+				other, _ := newNSM(t)
+				other.CA = nsm.CA
+				other.PCRs[2] = bytes.Repeat([]byte{0xff}, 48)
+				return request(t, c, other, "db", publicKey(t))
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "no challenge",
+			request: func(t *testing.T, c pb.KeyReleaseServiceClient) *pb.ReleaseSecretRequest {
+				doc, err := nsm.Attest([]byte("made-up nonce"), nil, publicKey(t))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return &pb.ReleaseSecretRequest{SecretId: "db", AttestationDocument: doc}
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "replayed document",
+			request: func(t *testing.T, c pb.KeyReleaseServiceClient) *pb.ReleaseSecretRequest {
+				in := request(t, c, nsm, "db", publicKey(t))
+				if _, err := c.ReleaseSecret(ctx, in); err != nil {
+					t.Fatalf("first ReleaseSecret: %v", err)
+				}
+				return in
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "expired challenge",
+			ttl:  time.Second,
+			request: func(t *testing.T, c pb.KeyReleaseServiceClient) *pb.ReleaseSecretRequest {
+				in := request(t, c, nsm, "db", publicKey(t))
+				time.Sleep(1100 * time.Millisecond)
+				return in
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "no public key",
+			request: func(t *testing.T, c pb.KeyReleaseServiceClient) *pb.ReleaseSecretRequest {
+				return request(t, c, nsm, "db", nil)
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "unknown secret",
+			request: func(t *testing.T, c pb.KeyReleaseServiceClient) *pb.ReleaseSecretRequest {
+				return request(t, c, nsm, "other", publicKey(t))
+			},
+			wantCode: codes.NotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startServer(t, nsm, policy, tt.ttl)
+			_, err := c.ReleaseSecret(ctx, tt.request(t, c))
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("ReleaseSecret error = %v, want code %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRefusedRequestKeepsChallenge(t *testing.T) {
+	nsm, policy := newNSM(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		secretID  string
+		publicKey []byte
+		wantCode  codes.Code
+	}{
+		{name: "no public key", secretID: "db", wantCode: codes.InvalidArgument},
+		{name: "invalid public key", secretID: "db", publicKey: []byte("not a key"), wantCode: codes.InvalidArgument},
+		{name: "unknown secret", secretID: "other", publicKey: publicKey(t), wantCode: codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startServer(t, nsm, policy, 0)
+			challenge, err := c.GetChallenge(ctx, &pb.ChallengeRequest{})
+			if err != nil {
+				t.Fatalf("GetChallenge: %v", err)
+			}
+			doc, err := nsm.Attest(challenge.GetNonce(), nil, tt.publicKey)
+			if err != nil {
+				t.Fatalf("Attest: %v", err)
+			}
+			_, err = c.ReleaseSecret(ctx, &pb.ReleaseSecretRequest{SecretId: tt.secretID, AttestationDocument: doc})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("ReleaseSecret error = %v, want code %v", err, tt.wantCode)
+			}
+
+			// The challenge is still valid for a correct request
+			doc, err = nsm.Attest(challenge.GetNonce(), nil, publicKey(t))
+			if err != nil {
+				t.Fatalf("Attest: %v", err)
+			}
+			if _, err := c.ReleaseSecret(ctx, &pb.ReleaseSecretRequest{SecretId: "db", AttestationDocument: doc}); err != nil {
+				t.Errorf("ReleaseSecret after a refused request: %v", err)
+			}
+		})
+	}
+}
+
+// request returns a release request for secretID with a document of nsm
+// binding a fresh challenge and publicKey.
+func request(t *testing.T, c pb.KeyReleaseServiceClient, nsm *attestertest.NSM, secretID string, publicKey []byte) *pb.ReleaseSecretRequest {
+	t.Helper()
+	challenge, err := c.GetChallenge(context.Background(), &pb.ChallengeRequest{})
+	if err != nil {
+		t.Fatalf("GetChallenge: %v", err)
+	}
+	doc, err := nsm.Attest(challenge.GetNonce(), nil, publicKey)
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+	return &pb.ReleaseSecretRequest{SecretId: secretID, AttestationDocument: doc}
+}
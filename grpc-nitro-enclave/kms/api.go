@@ -0,0 +1,95 @@
+package kms
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Operations of the KMS JSON API, sent in the X-Amz-Target header.
+const (
+	TargetDecrypt         = "TrentService.Decrypt"
+	TargetEncrypt         = "TrentService.Encrypt"
+	TargetGenerateDataKey = "TrentService.GenerateDataKey"
+
+	// TargetGenerateDataKeyWithoutPlaintext takes a GenerateDataKeyRequest
+	// without Recipient and returns only the CiphertextBlob.
+	TargetGenerateDataKeyWithoutPlaintext = "TrentService.GenerateDataKeyWithoutPlaintext"
+)
+
+// ContentType is the content type of KMS requests and responses.
+const ContentType = "application/x-amz-json-1.1"
+
+// KeyEncryptionAlgorithm is the only algorithm KMS supports to encrypt
+// responses to an attested recipient.
+const KeyEncryptionAlgorithm = "RSAES_OAEP_SHA_256"
+
+// Recipient asks KMS to encrypt the plaintext of a response to the public key
+// in the attestation document instead of returning it in the clear.
+type Recipient struct {
+	AttestationDocument    []byte `json:"AttestationDocument"`
+	KeyEncryptionAlgorithm string `json:"KeyEncryptionAlgorithm"`
+}
+
+// DecryptRequest is the body of a Decrypt request.
+type DecryptRequest struct {
+	CiphertextBlob    []byte            `json:"CiphertextBlob"`
+	KeyID             string            `json:"KeyId,omitempty"`
+	EncryptionContext map[string]string `json:"EncryptionContext,omitempty"`
+	Recipient         *Recipient        `json:"Recipient,omitempty"`
+}
+
+// DecryptResponse is the body of a Decrypt response. With a Recipient,
+// Plaintext is empty and CiphertextForRecipient holds it as CMS EnvelopedData.
+type DecryptResponse struct {
+	KeyID                  string `json:"KeyId"`
+	Plaintext              []byte `json:"Plaintext,omitempty"`
+	CiphertextForRecipient []byte `json:"CiphertextForRecipient,omitempty"`
+	EncryptionAlgorithm    string `json:"EncryptionAlgorithm,omitempty"`
+}
+
+// EncryptRequest is the body of an Encrypt request.
+type EncryptRequest struct {
+	KeyID             string            `json:"KeyId"`
+	Plaintext         []byte            `json:"Plaintext"`
+	EncryptionContext map[string]string `json:"EncryptionContext,omitempty"`
+}
+
+// EncryptResponse is the body of an Encrypt response.
+type EncryptResponse struct {
+	KeyID               string `json:"KeyId"`
+	CiphertextBlob      []byte `json:"CiphertextBlob"`
+	EncryptionAlgorithm string `json:"EncryptionAlgorithm,omitempty"`
+}
+
+// GenerateDataKeyRequest is the body of a GenerateDataKey request.
+type GenerateDataKeyRequest struct {
+	KeyID             string            `json:"KeyId"`
+	KeySpec           string            `json:"KeySpec,omitempty"` // AES_256 or AES_128
+	NumberOfBytes     int               `json:"NumberOfBytes,omitempty"`
+	EncryptionContext map[string]string `json:"EncryptionContext,omitempty"`
+	Recipient         *Recipient        `json:"Recipient,omitempty"`
+}
+
+// GenerateDataKeyResponse is the body of a GenerateDataKey response.
+type GenerateDataKeyResponse struct {
+	KeyID                  string `json:"KeyId"`
+	CiphertextBlob         []byte `json:"CiphertextBlob"`
+	Plaintext              []byte `json:"Plaintext,omitempty"`
+	CiphertextForRecipient []byte `json:"CiphertextForRecipient,omitempty"`
+}
+
+// APIError is an error returned by the KMS API, such as AccessDeniedException.
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Type       string `json:"__type"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("kms: %s (HTTP %d): %s", e.Type, e.StatusCode, e.Message)
+}
+
+// NewAPIError returns an error of the given type with a client error status.
+func NewAPIError(errorType, format string, args ...any) *APIError {
+	return &APIError{StatusCode: http.StatusBadRequest, Type: errorType, Message: fmt.Sprintf(format, args...)}
+}
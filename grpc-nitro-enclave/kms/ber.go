@@ -0,0 +1,153 @@
+package kms
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxBERDepth bounds the nesting of BER input.
+const maxBERDepth = 32
+
+// berElement is a decoded BER TLV.
+type berElement struct {
+	tag         []byte // identifier octets
+	constructed bool
+	content     []byte        // primitive content
+	children    []*berElement // constructed content
+}
+
+// berToDER converts BER to DER as far as encoding/asn1 needs it: indefinite
+// lengths become definite and constructed OCTET STRINGs are flattened. CMS
+// structures produced by KMS use both.
+func berToDER(ber []byte) ([]byte, error) {
+	e, rest, err := parseBER(ber, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data after BER element")
+	}
+	return e.encode(), nil
+}
+
+func parseBER(b []byte, depth int) (*berElement, []byte, error) {
+	if depth > maxBERDepth {
+		return nil, nil, errors.New("BER nesting too deep")
+	}
+	if len(b) < 2 {
+		return nil, nil, errors.New("truncated BER element")
+	}
+
+	// Identifier octets, with high tag numbers continued in following octets
+	n := 1
+	if b[0]&0x1f == 0x1f {
+		for {
+			if n >= len(b) {
+				return nil, nil, errors.New("truncated BER tag")
+			}
+			n++
+			if b[n-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+	e := &berElement{tag: b[:n], constructed: b[0]&0x20 != 0}
+	if n >= len(b) {
+		return nil, nil, errors.New("truncated BER length")
+	}
+
+	// Length octets
+	l := int(b[n])
+	n++
+	indefinite := l == 0x80
+	switch {
+	case indefinite:
+		if !e.constructed {
+			return nil, nil, errors.New("indefinite length on a primitive BER element")
+		}
+	case l > 0x80:
+		size := l & 0x7f
+		if size > 4 || n+size > len(b) {
+			return nil, nil, errors.New("invalid BER length")
+		}
+		l = 0
+		for _, c := range b[n : n+size] {
+			l = l<<8 | int(c)
+		}
+		n += size
+	}
+	b = b[n:]
+
+	if !indefinite && l > len(b) {
+		return nil, nil, fmt.Errorf("BER element length %d exceeds the %d remaining bytes", l, len(b))
+	}
+	if !e.constructed {
+		e.content = b[:l]
+		return e, b[l:], nil
+	}
+
+	content := b
+	if !indefinite {
+		content = b[:l]
+	}
+	for {
+		if indefinite {
+			if len(content) < 2 {
+				return nil, nil, errors.New("missing end-of-contents in BER element")
+			}
+			if content[0] == 0 && content[1] == 0 {
+				return e.flatten(), content[2:], nil
+			}
+		} else if len(content) == 0 {
+			return e.flatten(), b[l:], nil
+		}
+		child, rest, err := parseBER(content, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		e.children = append(e.children, child)
+		content = rest
+	}
+}
+
+// flatten turns a constructed OCTET STRING into a primitive one.
+func (e *berElement) flatten() *berElement {
+	if len(e.tag) != 1 || e.tag[0] != 0x24 {
+		return e
+	}
+	flat := &berElement{tag: []byte{0x04}}
+	var collect func(*berElement)
+	collect = func(e *berElement) {
+		flat.content = append(flat.content, e.content...)
+		for _, c := range e.children {
+			collect(c)
+		}
+	}
+	collect(e)
+	return flat
+}
+
+func (e *berElement) encode() []byte {
+	content := e.content
+	if e.constructed {
+		content = nil
+		for _, c := range e.children {
+			content = append(content, c.encode()...)
+		}
+	}
+	out := append([]byte(nil), e.tag...)
+	out = appendDERLength(out, len(content))
+	return append(out, content...)
+}
+
+func appendDERLength(b []byte, l int) []byte {
+	if l < 0x80 {
+		return append(b, byte(l))
+	}
+	var octets []byte
+	for ; l > 0; l >>= 8 {
+		octets = append([]byte{byte(l)}, octets...)
+	}
+	b = append(b, 0x80|byte(len(octets)))
+	return append(b, octets...)
+}
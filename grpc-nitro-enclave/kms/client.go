@@ -0,0 +1,166 @@
+// Package kms decrypts data keys inside an enclave with the AWS KMS Decrypt
+// API and its Recipient parameter.
+//
+// The client generates an ephemeral RSA key pair, obtains an attestation
+// document binding its public key, and sends it with the ciphertext to a
+// KMS-compatible endpoint, typically reached through a vsock tunnel to the
+// parent instance. KMS checks the document against the key policy (for example
+// kms:RecipientAttestation:PCR0 conditions) and returns the plaintext encrypted
+// to the ephemeral key as CMS EnvelopedData, which only the enclave can open.
+//
+// Package fakekms provides a local stand-in for tests and development.
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/transport"
+)
+
+// RSAKeySize is the size of the ephemeral recipient key.
+const RSAKeySize = 2048
+
+// maxResponseSize bounds the size of KMS responses.
+const maxResponseSize = 1 << 20
+
+// Client calls the KMS Decrypt API with attestation.
+type Client struct {
+	// Endpoint is the URL of the KMS API, such as https://kms.us-east-1.amazonaws.com.
+	Endpoint string
+
+	// Region is the AWS region used to sign requests.
+	Region string
+
+	// Credentials sign requests. If nil, requests are sent unsigned, which
+	// only a fake KMS accepts.
+	Credentials *Credentials
+
+	// HTTPClient sends requests. If nil, http.DefaultClient is used; see
+	// NewTunnelClient to reach KMS through the parent instance.
+	HTTPClient *http.Client
+
+	// Attester provides the attestation documents.
+	Attester attester.Attester
+}
+
+// NewTunnelClient returns an HTTP client that sends all requests through a
+// connection to address on the given transport, for example vsock "3:8000" on
+// the parent instance, where a proxy forwards them to KMS. TLS is still
+// negotiated end to end with the host of the request URL.
+func NewTunnelClient(transportName, address string) *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return transport.Dial(ctx, transportName, address)
+			},
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        2,
+			IdleConnTimeout:     time.Minute,
+		},
+	}
+}
+
+// Decrypt decrypts ciphertextBlob, which was encrypted under keyID (optional
+// for symmetric keys) with the given encryption context. The plaintext is
+// released by KMS only to this enclave, encrypted to an ephemeral key.
+func (c *Client) Decrypt(ctx context.Context, ciphertextBlob []byte, keyID string, encryptionContext map[string]string) ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, RSAKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate recipient key: %w", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal recipient key: %w", err)
+	}
+	doc, err := attester.AttestContext(ctx, c.Attester, nil, nil, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain attestation document: %w", err)
+	}
+
+	var out DecryptResponse
+	if err := c.call(ctx, TargetDecrypt, &DecryptRequest{
+		CiphertextBlob:    ciphertextBlob,
+		KeyID:             keyID,
+		EncryptionContext: encryptionContext,
+		Recipient: &Recipient{
+			AttestationDocument:    doc,
+			KeyEncryptionAlgorithm: KeyEncryptionAlgorithm,
+		},
+	}, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Plaintext) > 0 {
+		return nil, errors.New("kms: plaintext returned in the clear despite the attested recipient")
+	}
+	if len(out.CiphertextForRecipient) == 0 {
+		return nil, errors.New("kms: response has no CiphertextForRecipient")
+	}
+
+	plaintext, err := DecryptEnvelopedData(out.CiphertextForRecipient, key)
+	if err != nil {
+		return nil, fmt.Errorf("kms: failed to decrypt CiphertextForRecipient: %w", err)
+	}
+	return plaintext, nil
+}
+
+// call sends a KMS JSON API request and decodes the response into out.
+func (c *Client) call(ctx context.Context, target string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("kms: invalid endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("X-Amz-Target", target)
+	if c.Credentials != nil {
+		c.Credentials.sign(req, body, c.Region, "kms", time.Now())
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("kms: %s request failed: %w", target, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("kms: failed to read %s response: %w", target, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Type == "" {
+			apiErr.Type = "UnknownError"
+			apiErr.Message = string(data)
+		}
+		// Types may be qualified, as in com.amazonaws.kms#AccessDeniedException
+		if i := strings.LastIndexByte(apiErr.Type, '#'); i >= 0 {
+			apiErr.Type = apiErr.Type[i+1:]
+		}
+		return apiErr
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("kms: failed to decode %s response: %w", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package kms_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/kms"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/kms/fakekms"
+)
+
+// startKMS serves a fake KMS trusting nsm, with a key "enclave" restricted to
+// the PCRs of nsm and a key "open" without attestation condition.
+func startKMS(t *testing.T, nsm *attestertest.NSM) *httptest.Server {
+	t.Helper()
+	srv, err := fakekms.NewServer(attestation.VerifyOptions{Roots: nsm.CA.Roots()},
+		&fakekms.Key{
+			ID:       "enclave",
+			Material: bytes.Repeat([]byte{1}, 32),
+			Policy:   &attestation.PCRPolicy{Allowed: []attestation.Measurements{{0: nsm.PCRs[0], 2: nsm.PCRs[2]}}},
+		},
+		&fakekms.Key{ID: "open", Material: bytes.Repeat([]byte{2}, 32)},
+	)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func newNSM(t *testing.T) *attestertest.NSM {
+	t.Helper()
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	return nsm
+}
+
+// call sends a KMS request without attestation, as the parent instance would.
+func call(t *testing.T, endpoint, target string, in, out any) error {
+	t.Helper()
+	body, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", kms.ContentType)
+	req.Header.Set("X-Amz-Target", target)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &kms.APIError{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return apiErr
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func generateDataKey(t *testing.T, endpoint, keyID string, encryptionContext map[string]string) *kms.GenerateDataKeyResponse {
+	t.Helper()
+	var out kms.GenerateDataKeyResponse
+	err := call(t, endpoint, kms.TargetGenerateDataKey, &kms.GenerateDataKeyRequest{
+		KeyID:             keyID,
+		KeySpec:           "AES_256",
+		EncryptionContext: encryptionContext,
+	}, &out)
+	if err != nil {
+		t.Fatalf("GenerateDataKey: %v", err)
+	}
+	return &out
+}
+
+func TestDecrypt(t *testing.T) {
+	nsm := newNSM(t)
+	ts := startKMS(t, nsm)
+	c := &kms.Client{Endpoint: ts.URL, Attester: nsm}
+	ctx := context.Background()
+	encryptionContext := map[string]string{"purpose": "test"}
+
+	// The plaintext of the enclave key is only released to the enclave
+	var apiErr *kms.APIError
+	if err := call(t, ts.URL, kms.TargetGenerateDataKey, &kms.GenerateDataKeyRequest{KeyID: "enclave", KeySpec: "AES_256"}, nil); !errors.As(err, &apiErr) || apiErr.Type != "AccessDeniedException" {
+		t.Fatalf("GenerateDataKey without attestation error = %v, want AccessDeniedException", err)
+	}
+
+	// Encrypt a data key on the parent, decrypt it in the enclave
+	var encrypted kms.EncryptResponse
+	dataKey := bytes.Repeat([]byte{0xaa}, 32)
+	if err := call(t, ts.URL, kms.TargetEncrypt, &kms.EncryptRequest{KeyID: "enclave", Plaintext: dataKey, EncryptionContext: encryptionContext}, &encrypted); err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	got, err := c.Decrypt(ctx, encrypted.CiphertextBlob, "enclave", encryptionContext)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(got, dataKey) {
+		t.Errorf("Decrypt = %x, want %x", got, dataKey)
+	}
+
+	// A data key generated without plaintext on the parent
+	var generated kms.GenerateDataKeyResponse
+	if err := call(t, ts.URL, kms.TargetGenerateDataKeyWithoutPlaintext, &kms.GenerateDataKeyRequest{KeyID: "enclave", NumberOfBytes: 24}, &generated); err != nil {
+		t.Fatalf("GenerateDataKeyWithoutPlaintext: %v", err)
+	}
+	if len(generated.Plaintext) != 0 {
+		t.Error("GenerateDataKeyWithoutPlaintext returned the plaintext")
+	}
+	if got, err := c.Decrypt(ctx, generated.CiphertextBlob, "", nil); err != nil || len(got) != 24 {
+		t.Errorf("Decrypt = %x, %v, want 24 bytes", got, err)
+	}
+
+	// Keys without attestation condition work too
+	open := generateDataKey(t, ts.URL, "open", nil)
+	if got, err := c.Decrypt(ctx, open.CiphertextBlob, "", nil); err != nil || !bytes.Equal(got, open.Plaintext) {
+		t.Errorf("Decrypt = %x, %v, want %x", got, err, open.Plaintext)
+	}
+}
+
+func TestDecryptRefused(t *testing.T) {
+	nsm := newNSM(t)
+	ts := startKMS(t, nsm)
+	ctx := context.Background()
+
+	var blob kms.EncryptResponse
+	if err := call(t, ts.URL, kms.TargetEncrypt, &kms.EncryptRequest{KeyID: "enclave", Plaintext: []byte("data key"), EncryptionContext: map[string]string{"purpose": "test"}}, &blob); err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	otherImage := newNSM(t)
+	otherImage.CA = nsm.CA
+	otherImage.PCRs[0] = bytes.Repeat([]byte{0xff}, 48)
+
+	tests := []struct {
+		name              string
+		attester          *attestertest.NSM
+		keyID             string
+		encryptionContext map[string]string
+		wantType          string
+	}{
+		{name: "other image", attester: otherImage, encryptionContext: map[string]string{"purpose": "test"}, wantType: "AccessDeniedException"},
+		{name: "untrusted enclave", attester: newNSM(t), encryptionContext: map[string]string{"purpose": "test"}, wantType: "ValidationException"},
+		{name: "wrong encryption context", attester: nsm, encryptionContext: map[string]string{"purpose": "other"}, wantType: "InvalidCiphertextException"},
+		{name: "wrong key", attester: nsm, keyID: "open", encryptionContext: map[string]string{"purpose": "test"}, wantType: "IncorrectKeyException"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &kms.Client{Endpoint: ts.URL, Attester: tt.attester}
+			_, err := c.Decrypt(ctx, blob.CiphertextBlob, tt.keyID, tt.encryptionContext)
+			var apiErr *kms.APIError
+			if !errors.As(err, &apiErr) || apiErr.Type != tt.wantType {
+				t.Errorf("Decrypt error = %v, want %s", err, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestDecryptSignsRequests(t *testing.T) {
+	var authorization, token string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization, token = r.Header.Get("Authorization"), r.Header.Get("X-Amz-Security-Token")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"com.amazonaws.kms#InvalidCiphertextException","message":"invalid"}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	c := &kms.Client{
+		Endpoint:    ts.URL,
+		Region:      "eu-central-1",
+		Credentials: &kms.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"},
+		Attester:    newNSM(t),
+	}
+	_, err := c.Decrypt(context.Background(), []byte("blob"), "", nil)
+	var apiErr *kms.APIError
+	if !errors.As(err, &apiErr) || apiErr.Type != "InvalidCiphertextException" || apiErr.Message != "invalid" {
+		t.Errorf("Decrypt error = %v, want InvalidCiphertextException", err)
+	}
+
+	for _, want := range []string{
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/",
+		"/eu-central-1/kms/aws4_request",
+		"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target",
+		"Signature=",
+	} {
+		if !strings.Contains(authorization, want) {
+			t.Errorf("Authorization = %q, want it to contain %q", authorization, want)
+		}
+	}
+	if token != "token" {
+		t.Errorf("X-Amz-Security-Token = %q, want %q", token, "token")
+	}
+}
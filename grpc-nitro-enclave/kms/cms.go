@@ -0,0 +1,266 @@
+package kms
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// Object identifiers of the CMS structures returned by KMS (RFC 5652, RFC 8017, RFC 3565).
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSAESOAEP     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidMGF1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidAES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RecipientIdentifier    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type oaepParameters struct {
+	HashAlgorithm    pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+	MaskGenAlgorithm pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:1"`
+}
+
+// DecryptEnvelopedData decrypts a CMS EnvelopedData structure (BER or DER), as
+// returned by KMS in CiphertextForRecipient: the content encryption key is
+// wrapped with RSAES-OAEP using SHA-256 and the content is encrypted with AES-256-CBC.
+func DecryptEnvelopedData(data []byte, key *rsa.PrivateKey) ([]byte, error) {
+	der, err := berToDER(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CMS encoding: %w", err)
+	}
+
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("failed to parse CMS ContentInfo: %w", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after CMS ContentInfo")
+	}
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, fmt.Errorf("CMS content type is %v, want EnvelopedData", ci.ContentType)
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, fmt.Errorf("failed to parse CMS EnvelopedData: %w", err)
+	}
+
+	// Unwrap the content encryption key with the first key transport recipient
+	var cek []byte
+	for _, raw := range ed.RecipientInfos {
+		if raw.Class != asn1.ClassUniversal || raw.Tag != asn1.TagSequence {
+			continue // key agreement, KEK or password recipients
+		}
+		var ri keyTransRecipientInfo
+		if _, err := asn1.Unmarshal(raw.FullBytes, &ri); err != nil {
+			return nil, fmt.Errorf("failed to parse CMS KeyTransRecipientInfo: %w", err)
+		}
+		if err := checkOAEPSHA256(ri.KeyEncryptionAlgorithm); err != nil {
+			return nil, err
+		}
+		if cek, err = rsa.DecryptOAEP(sha256.New(), nil, key, ri.EncryptedKey, nil); err != nil {
+			return nil, fmt.Errorf("failed to unwrap content encryption key: %w", err)
+		}
+		break
+	}
+	if cek == nil {
+		return nil, errors.New("no key transport recipient in CMS EnvelopedData")
+	}
+
+	eci := ed.EncryptedContentInfo
+	if !eci.ContentEncryptionAlgorithm.Algorithm.Equal(oidAES256CBC) {
+		return nil, fmt.Errorf("unsupported content encryption algorithm %v", eci.ContentEncryptionAlgorithm.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("failed to parse AES-CBC IV: %w", err)
+	}
+	ciphertext, err := encryptedContent(eci.EncryptedContent)
+	if err != nil {
+		return nil, err
+	}
+	return decryptAESCBC(cek, iv, ciphertext)
+}
+
+// encryptedContent returns the bytes of the implicitly tagged encryptedContent
+// OCTET STRING, which BER encoders may split into a constructed string of chunks.
+func encryptedContent(v asn1.RawValue) ([]byte, error) {
+	if !v.IsCompound {
+		return v.Bytes, nil
+	}
+	var content []byte
+	for rest := v.Bytes; len(rest) > 0; {
+		var chunk []byte
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse encrypted content: %w", err)
+		}
+		content = append(content, chunk...)
+	}
+	return content, nil
+}
+
+// checkOAEPSHA256 checks that alg is RSAES-OAEP with SHA-256 and MGF1 with SHA-256.
+func checkOAEPSHA256(alg pkix.AlgorithmIdentifier) error {
+	if !alg.Algorithm.Equal(oidRSAESOAEP) {
+		return fmt.Errorf("unsupported key encryption algorithm %v", alg.Algorithm)
+	}
+	var params oaepParameters
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+		return fmt.Errorf("failed to parse RSAES-OAEP parameters: %w", err)
+	}
+	var mgfHash pkix.AlgorithmIdentifier
+	if params.MaskGenAlgorithm.Algorithm.Equal(oidMGF1) {
+		if _, err := asn1.Unmarshal(params.MaskGenAlgorithm.Parameters.FullBytes, &mgfHash); err != nil {
+			return fmt.Errorf("failed to parse MGF1 parameters: %w", err)
+		}
+	}
+	// Absent parameters default to SHA-1
+	if !params.HashAlgorithm.Algorithm.Equal(oidSHA256) || !mgfHash.Algorithm.Equal(oidSHA256) {
+		return errors.New("RSAES-OAEP parameters are not SHA-256 with MGF1 SHA-256")
+	}
+	return nil
+}
+
+func decryptAESCBC(key, iv, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, fmt.Errorf("invalid AES-CBC IV size %d", len(iv))
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("invalid AES-CBC ciphertext size %d", len(ciphertext))
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	// Remove the PKCS#7 padding
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > block.BlockSize() ||
+		subtle.ConstantTimeCompare(plaintext[len(plaintext)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) != 1 {
+		return nil, errors.New("invalid AES-CBC padding")
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
+
+// EncryptEnvelopedData encrypts plaintext to recipient in the DER encoded CMS
+// EnvelopedData format that DecryptEnvelopedData expects. It is used by the
+// fake KMS.
+func EncryptEnvelopedData(plaintext []byte, recipient *rsa.PublicKey) ([]byte, error) {
+	cek := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(cek); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	// Encrypt the content with AES-256-CBC and PKCS#7 padding
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte(nil), plaintext...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, recipient, cek, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap content encryption key: %w", err)
+	}
+
+	// Identify the recipient by the SHA-1 hash of its public key, as in RFC 5280
+	spki, err := x509.MarshalPKIXPublicKey(recipient)
+	if err != nil {
+		return nil, err
+	}
+	var parsed struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(spki, &parsed); err != nil {
+		return nil, err
+	}
+	ski := sha1.Sum(parsed.PublicKey.Bytes)
+
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	mgfParams, err := asn1.Marshal(sha256ID)
+	if err != nil {
+		return nil, err
+	}
+	oaepParams, err := asn1.Marshal(oaepParameters{
+		HashAlgorithm:    sha256ID,
+		MaskGenAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgfParams}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ri, err := asn1.Marshal(keyTransRecipientInfo{
+		Version:                2,
+		RecipientIdentifier:    asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: ski[:]},
+		KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAESOAEP, Parameters: asn1.RawValue{FullBytes: oaepParams}},
+		EncryptedKey:           encryptedKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	ed, err := asn1.Marshal(envelopedData{
+		Version:        2,
+		RecipientInfos: []asn1.RawValue{{FullBytes: ri}},
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+			EncryptedContent:           asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: ciphertext},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: ed},
+	})
+}
@@ -0,0 +1,121 @@
+package kms_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/kms"
+)
+
+func TestEnvelopedData(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1, 15, 16, 32, 1000} {
+		plaintext := bytes.Repeat([]byte{0x5a}, size)
+		der, err := kms.EncryptEnvelopedData(plaintext, &key.PublicKey)
+		if err != nil {
+			t.Fatalf("EncryptEnvelopedData: %v", err)
+		}
+
+		for name, data := range map[string][]byte{"DER": der, "BER": toBER(t, der)} {
+			got, err := kms.DecryptEnvelopedData(data, key)
+			if err != nil {
+				t.Fatalf("%s, %d bytes: DecryptEnvelopedData: %v", name, size, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("%s, %d bytes: got %x, want %x", name, size, got, plaintext)
+			}
+		}
+
+		if _, err := kms.DecryptEnvelopedData(der, other); err == nil {
+			t.Errorf("%d bytes: DecryptEnvelopedData with another key succeeded", size)
+		}
+	}
+}
+
+func TestDecryptEnvelopedDataMalformed(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := kms.EncryptEnvelopedData([]byte("data key"), &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := map[string][]byte{
+		"empty":     nil,
+		"truncated": der[:len(der)/2],
+		"trailing":  append(append([]byte(nil), der...), 0),
+		"garbage":   bytes.Repeat([]byte{0x30, 0x80}, 64),
+	}
+	for name, data := range inputs {
+		if _, err := kms.DecryptEnvelopedData(data, key); err == nil {
+			t.Errorf("%s: DecryptEnvelopedData succeeded", name)
+		}
+	}
+}
+
+// toBER re-encodes DER with indefinite lengths for all constructed elements and
+// splits OCTET STRINGs and the implicitly tagged encrypted content into chunks,
+// as BER encoders such as the one of KMS may do.
+func toBER(t *testing.T, der []byte) []byte {
+	t.Helper()
+	var out []byte
+	for len(der) > 0 {
+		tag := der[0]
+		l, n := int(der[1]), 2
+		if l&0x80 != 0 {
+			size := l & 0x7f
+			l = 0
+			for _, c := range der[2 : 2+size] {
+				l = l<<8 | int(c)
+			}
+			n += size
+		}
+		content := der[n : n+l]
+		der = der[n+l:]
+
+		switch {
+		case tag&0x20 != 0:
+			out = append(out, tag, 0x80)
+			out = append(out, toBER(t, content)...)
+			out = append(out, 0, 0)
+		case (tag == 0x04 || tag == 0x80) && len(content) > 16:
+			// OCTET STRING, or [0] IMPLICIT OCTET STRING
+			out = append(out, tag|0x20, 0x80)
+			for len(content) > 0 {
+				chunk := content[:min(16, len(content))]
+				content = content[len(chunk):]
+				out = append(out, 0x04, byte(len(chunk)))
+				out = append(out, chunk...)
+			}
+			out = append(out, 0, 0)
+		default:
+			out = append(out, tag)
+			out = appendLength(out, len(content))
+			out = append(out, content...)
+		}
+	}
+	return out
+}
+
+func appendLength(b []byte, l int) []byte {
+	switch {
+	case l < 0x80:
+		return append(b, byte(l))
+	case l < 0x100:
+		return append(b, 0x81, byte(l))
+	default:
+		return append(b, 0x82, byte(l>>8), byte(l))
+	}
+}
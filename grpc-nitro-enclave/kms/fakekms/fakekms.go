@@ -0,0 +1,365 @@
+// Package fakekms is a local stand-in for AWS KMS, for tests and development
+// outside AWS. It implements the Encrypt, Decrypt and GenerateDataKey
+// operations of the KMS JSON API, including the Recipient parameter, for
+// symmetric keys held in memory.
+//
+// A key with a PCR policy behaves like a KMS key whose key policy has
+// kms:RecipientAttestation:PCR conditions: Decrypt and GenerateDataKey succeed
+// only with a Recipient attestation document that verifies and matches the
+// policy, and the plaintext is then returned only as CiphertextForRecipient.
+// Requests are not authenticated.
+package fakekms
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/kms"
+)
+
+// MaxAttestationAge is the maximum age of Recipient attestation documents, as enforced by KMS.
+const MaxAttestationAge = 5 * time.Minute
+
+// maxRequestSize bounds the size of request bodies.
+const maxRequestSize = 1 << 20
+
+// blobVersion is the first byte of the ciphertext blobs of the fake KMS.
+const blobVersion = 1
+
+// Key is a symmetric KMS key.
+type Key struct {
+	ID string
+
+	// Material is the 256-bit AES key.
+	Material []byte
+
+	// Policy, if non-nil, restricts Decrypt and GenerateDataKey to attested
+	// recipients whose PCRs match it.
+	Policy *attestation.PCRPolicy
+}
+
+// Server serves the KMS JSON API over HTTP.
+type Server struct {
+	keys   map[string]*Key
+	verify attestation.VerifyOptions
+}
+
+// NewServer returns a fake KMS holding keys. Recipient attestation documents
+// are verified with verify, whose Policy is replaced by the policy of each key.
+// If verify.MaxAge is zero, MaxAttestationAge applies.
+func NewServer(verify attestation.VerifyOptions, keys ...*Key) (*Server, error) {
+	if verify.MaxAge == 0 {
+		verify.MaxAge = MaxAttestationAge
+	}
+	s := &Server{keys: make(map[string]*Key, len(keys)), verify: verify}
+	for _, k := range keys {
+		if len(k.Material) != 32 {
+			return nil, fmt.Errorf("fakekms: key %q material is %d bytes, want 32", k.ID, len(k.Material))
+		}
+		if _, dup := s.keys[k.ID]; dup {
+			return nil, fmt.Errorf("fakekms: duplicate key %q", k.ID)
+		}
+		s.keys[k.ID] = k
+	}
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		writeError(w, kms.NewAPIError("SerializationException", "failed to read request: %v", err))
+		return
+	}
+
+	target := r.Header.Get("X-Amz-Target")
+	var out any
+	var apiErr *kms.APIError
+	switch target {
+	case kms.TargetEncrypt:
+		var in kms.EncryptRequest
+		if apiErr = decode(body, &in); apiErr == nil {
+			out, apiErr = s.encrypt(&in)
+		}
+	case kms.TargetDecrypt:
+		var in kms.DecryptRequest
+		if apiErr = decode(body, &in); apiErr == nil {
+			out, apiErr = s.decrypt(&in)
+		}
+	case kms.TargetGenerateDataKey:
+		var in kms.GenerateDataKeyRequest
+		if apiErr = decode(body, &in); apiErr == nil {
+			out, apiErr = s.generateDataKey(&in)
+		}
+	case kms.TargetGenerateDataKeyWithoutPlaintext:
+		var in kms.GenerateDataKeyRequest
+		if apiErr = decode(body, &in); apiErr == nil {
+			in.Recipient = nil
+			out, apiErr = s.generateDataKeyWithoutPlaintext(&in)
+		}
+	default:
+		apiErr = kms.NewAPIError("UnknownOperationException", "unsupported operation %q", target)
+	}
+	if apiErr != nil {
+		log.Printf("fakekms: %s: %s: %s", target, apiErr.Type, apiErr.Message)
+		writeError(w, apiErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", kms.ContentType)
+	json.NewEncoder(w).Encode(out)
+}
+
+func decode(body []byte, v any) *kms.APIError {
+	if err := json.Unmarshal(body, v); err != nil {
+		return kms.NewAPIError("SerializationException", "invalid request: %v", err)
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, e *kms.APIError) {
+	w.Header().Set("Content-Type", kms.ContentType)
+	w.WriteHeader(e.StatusCode)
+	json.NewEncoder(w).Encode(e)
+}
+
+func (s *Server) key(id string) (*Key, *kms.APIError) {
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, kms.NewAPIError("NotFoundException", "key %q does not exist", id)
+	}
+	return k, nil
+}
+
+func (s *Server) encrypt(in *kms.EncryptRequest) (*kms.EncryptResponse, *kms.APIError) {
+	k, apiErr := s.key(in.KeyID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	blob, err := seal(k, in.Plaintext, in.EncryptionContext)
+	if err != nil {
+		return nil, internalError(err)
+	}
+	return &kms.EncryptResponse{KeyID: k.ID, CiphertextBlob: blob, EncryptionAlgorithm: "SYMMETRIC_DEFAULT"}, nil
+}
+
+func (s *Server) decrypt(in *kms.DecryptRequest) (*kms.DecryptResponse, *kms.APIError) {
+	id, err := blobKeyID(in.CiphertextBlob)
+	if err != nil {
+		return nil, kms.NewAPIError("InvalidCiphertextException", "%v", err)
+	}
+	if in.KeyID != "" && in.KeyID != id {
+		return nil, kms.NewAPIError("IncorrectKeyException", "ciphertext was not encrypted under key %q", in.KeyID)
+	}
+	k, apiErr := s.key(id)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	recipient, apiErr := s.recipientKey(k, in.Recipient)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	plaintext, err := open(k, in.CiphertextBlob, in.EncryptionContext)
+	if err != nil {
+		return nil, kms.NewAPIError("InvalidCiphertextException", "%v", err)
+	}
+
+	out := &kms.DecryptResponse{KeyID: k.ID, EncryptionAlgorithm: "SYMMETRIC_DEFAULT"}
+	if recipient == nil {
+		out.Plaintext = plaintext
+		return out, nil
+	}
+	if out.CiphertextForRecipient, err = kms.EncryptEnvelopedData(plaintext, recipient); err != nil {
+		return nil, internalError(err)
+	}
+	return out, nil
+}
+
+func (s *Server) generateDataKey(in *kms.GenerateDataKeyRequest) (*kms.GenerateDataKeyResponse, *kms.APIError) {
+	k, apiErr := s.key(in.KeyID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	recipient, apiErr := s.recipientKey(k, in.Recipient)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	dataKey, blob, apiErr := newDataKey(k, in)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	out := &kms.GenerateDataKeyResponse{KeyID: k.ID, CiphertextBlob: blob}
+	var err error
+	if recipient == nil {
+		out.Plaintext = dataKey
+		return out, nil
+	}
+	if out.CiphertextForRecipient, err = kms.EncryptEnvelopedData(dataKey, recipient); err != nil {
+		return nil, internalError(err)
+	}
+	return out, nil
+}
+
+func (s *Server) generateDataKeyWithoutPlaintext(in *kms.GenerateDataKeyRequest) (*kms.GenerateDataKeyResponse, *kms.APIError) {
+	k, apiErr := s.key(in.KeyID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	_, blob, apiErr := newDataKey(k, in)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return &kms.GenerateDataKeyResponse{KeyID: k.ID, CiphertextBlob: blob}, nil
+}
+
+// newDataKey generates a data key of the requested size and encrypts it under k.
+func newDataKey(k *Key, in *kms.GenerateDataKeyRequest) (dataKey, blob []byte, apiErr *kms.APIError) {
+	size := in.NumberOfBytes
+	switch {
+	case in.KeySpec == "AES_256" && size == 0:
+		size = 32
+	case in.KeySpec == "AES_128" && size == 0:
+		size = 16
+	case in.KeySpec != "" || size < 1 || size > 1024:
+		return nil, nil, kms.NewAPIError("ValidationException", "specify either KeySpec AES_256 or AES_128, or NumberOfBytes between 1 and 1024")
+	}
+	dataKey = make([]byte, size)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, internalError(err)
+	}
+	blob, err := seal(k, dataKey, in.EncryptionContext)
+	if err != nil {
+		return nil, nil, internalError(err)
+	}
+	return dataKey, blob, nil
+}
+
+// recipientKey verifies the Recipient attestation document against the policy
+// of k and returns the RSA key that the plaintext must be encrypted to, or nil
+// if the plaintext may be returned in the clear.
+func (s *Server) recipientKey(k *Key, r *kms.Recipient) (*rsa.PublicKey, *kms.APIError) {
+	if r == nil {
+		if k.Policy != nil {
+			return nil, kms.NewAPIError("AccessDeniedException", "key %q requires a recipient attestation document", k.ID)
+		}
+		return nil, nil
+	}
+	if r.KeyEncryptionAlgorithm != kms.KeyEncryptionAlgorithm {
+		return nil, kms.NewAPIError("ValidationException", "unsupported KeyEncryptionAlgorithm %q", r.KeyEncryptionAlgorithm)
+	}
+
+	opts := s.verify
+	opts.Policy = k.Policy
+	doc, err := attestation.Verify(r.AttestationDocument, opts)
+	if err != nil {
+		if errors.Is(err, attestation.ErrPCRMismatch) {
+			return nil, kms.NewAPIError("AccessDeniedException", "recipient attestation does not satisfy the policy of key %q: %v", k.ID, err)
+		}
+		return nil, kms.NewAPIError("ValidationException", "invalid recipient attestation document: %v", err)
+	}
+	pub, err := x509.ParsePKIXPublicKey(doc.PublicKey)
+	if err != nil {
+		return nil, kms.NewAPIError("ValidationException", "invalid public key in recipient attestation document: %v", err)
+	}
+	rsaKey, ok := pub.(*rsa.PublicKey)
+	if !ok || rsaKey.N.BitLen() < kms.RSAKeySize {
+		return nil, kms.NewAPIError("ValidationException", "recipient public key must be RSA with at least %d bits", kms.RSAKeySize)
+	}
+	return rsaKey, nil
+}
+
+func internalError(err error) *kms.APIError {
+	return &kms.APIError{StatusCode: http.StatusInternalServerError, Type: "KMSInternalException", Message: err.Error()}
+}
+
+// Ciphertext blobs hold the version, the key ID and the AES-GCM nonce and
+// ciphertext. The key ID and the encryption context are authenticated.
+
+func seal(k *Key, plaintext []byte, encryptionContext map[string]string) ([]byte, error) {
+	aead, err := newGCM(k.Material)
+	if err != nil {
+		return nil, err
+	}
+	blob := []byte{blobVersion}
+	blob = binary.BigEndian.AppendUint16(blob, uint16(len(k.ID)))
+	blob = append(blob, k.ID...)
+	header := len(blob)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	blob = append(blob, nonce...)
+	return aead.Seal(blob, nonce, plaintext, additionalData(blob[:header], encryptionContext)), nil
+}
+
+func blobKeyID(blob []byte) (string, error) {
+	if len(blob) < 3 || blob[0] != blobVersion {
+		return "", errors.New("ciphertext was not produced by this KMS")
+	}
+	n := int(binary.BigEndian.Uint16(blob[1:3]))
+	if len(blob) < 3+n {
+		return "", errors.New("truncated ciphertext")
+	}
+	return string(blob[3 : 3+n]), nil
+}
+
+func open(k *Key, blob []byte, encryptionContext map[string]string) ([]byte, error) {
+	aead, err := newGCM(k.Material)
+	if err != nil {
+		return nil, err
+	}
+	header := 3 + len(k.ID)
+	if len(blob) < header+aead.NonceSize() {
+		return nil, errors.New("truncated ciphertext")
+	}
+	nonce := blob[header : header+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, blob[header+aead.NonceSize():], additionalData(blob[:header], encryptionContext))
+	if err != nil {
+		return nil, errors.New("ciphertext or encryption context is invalid")
+	}
+	return plaintext, nil
+}
+
+// additionalData binds the blob header and the encryption context, in key order.
+func additionalData(header []byte, encryptionContext map[string]string) []byte {
+	keys := make([]string, 0, len(encryptionContext))
+	for k := range encryptionContext {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	b.Write(header)
+	for _, k := range keys {
+		for _, s := range []string{k, encryptionContext[k]} {
+			b.Write(binary.BigEndian.AppendUint32(nil, uint32(len(s))))
+			b.WriteString(s)
+		}
+	}
+	return b.Bytes()
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
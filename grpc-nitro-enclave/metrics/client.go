@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Client collects the attestation verification metrics of a client. A nil
+// *Client records nothing.
+type Client struct {
+	verifications *prometheus.CounterVec
+	verifySeconds *prometheus.HistogramVec
+	cacheLookups  *prometheus.CounterVec
+}
+
+// NewClient registers the client metrics in r. It panics if they are already
+// registered.
+func NewClient(r prometheus.Registerer) *Client {
+	f := promauto.With(r)
+	return &Client{
+		verifications: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "enclave_client_verifications_total",
+			Help: "Attestation documents verified by the client, by kind and result.",
+		}, []string{"kind", "result"}),
+		verifySeconds: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "enclave_client_verification_seconds",
+			Help: "Duration of the attestation document verifications.",
+		}, []string{"kind"}),
+		cacheLookups: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "enclave_client_tls_cache_lookups_total",
+			Help: "Lookups of server certificates in the attested TLS cache, by result.",
+		}, []string{"result"}),
+	}
+}
+
+// ObserveVerification records a verification of the given kind that started
+// at start and returned err.
+func (m *Client) ObserveVerification(kind string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.verifications.WithLabelValues(kind, result).Inc()
+	m.verifySeconds.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCacheLookup records whether a server certificate was found in the
+// attested TLS cache.
+func (m *Client) ObserveCacheLookup(hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(result).Inc()
+}
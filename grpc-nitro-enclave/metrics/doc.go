@@ -0,0 +1,11 @@
+// Package metrics defines the Prometheus metrics of the client and the server,
+// registered with client_golang, and the gRPC stats handler and attester
+// wrapper that record the server metrics.
+//
+// The enclave has no network interface, so its metrics are served over HTTP on
+// a dedicated vsock port, which the vsock-proxy on the parent instance exposes
+// to Prometheus:
+//
+//	vsock-proxy -listen :9090 -cid 16 -port 9090
+//	curl localhost:9090/metrics
+package metrics
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+)
+
+// Server collects the metrics of a gRPC server and of its attester. It is a
+// stats.Handler, installed with grpc.StatsHandler.
+type Server struct {
+	started     *prometheus.CounterVec
+	handled     *prometheus.CounterVec
+	handling    *prometheus.HistogramVec
+	received    *prometheus.CounterVec
+	sent        *prometheus.CounterVec
+	connections prometheus.Gauge
+	connsTotal  prometheus.Counter
+
+	attestSeconds prometheus.Histogram
+	attestErrors  prometheus.Counter
+}
+
+// rpcLabels are the labels of the RPC metrics.
+var rpcLabels = []string{"grpc_type", "grpc_service", "grpc_method"}
+
+// NewServer registers the server metrics in r. It panics if they are already
+// registered.
+func NewServer(r prometheus.Registerer) *Server {
+	f := promauto.With(r)
+	return &Server{
+		started: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_started_total",
+			Help: "RPCs started on the server.",
+		}, rpcLabels),
+		handled: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "RPCs completed on the server, by status code.",
+		}, []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"}),
+		handling: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "grpc_server_handling_seconds",
+			Help: "Duration of the RPCs handled by the server.",
+		}, rpcLabels),
+		received: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_msg_received_total",
+			Help: "Messages received on the server.",
+		}, rpcLabels),
+		sent: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_msg_sent_total",
+			Help: "Messages sent by the server.",
+		}, rpcLabels),
+		connections: f.NewGauge(prometheus.GaugeOpts{
+			Name: "grpc_server_connections_active",
+			Help: "Connections currently open on the server.",
+		}),
+		connsTotal: f.NewCounter(prometheus.CounterOpts{
+			Name: "grpc_server_connections_total",
+			Help: "Connections accepted by the server.",
+		}),
+
+		attestSeconds: f.NewHistogram(prometheus.HistogramOpts{
+			Name: "enclave_nsm_attestation_seconds",
+			Help: "Duration of the attestation requests to the NSM.",
+		}),
+		attestErrors: f.NewCounter(prometheus.CounterOpts{
+			Name: "enclave_nsm_attestation_errors_total",
+			Help: "Failed attestation requests to the NSM.",
+		}),
+	}
+}
+
+// rpcTag carries the labels of an RPC from TagRPC to HandleRPC.
+type rpcTag struct {
+	typ, service, method string
+}
+
+type rpcTagKey struct{}
+
+// splitMethod splits a full method name, /package.Service/Method.
+func splitMethod(fullMethod string) (service, method string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "unknown", "unknown"
+	}
+	return service, method
+}
+
+func rpcType(begin *stats.Begin) string {
+	switch {
+	case begin.IsClientStream && begin.IsServerStream:
+		return "bidi_stream"
+	case begin.IsClientStream:
+		return "client_stream"
+	case begin.IsServerStream:
+		return "server_stream"
+	}
+	return "unary"
+}
+
+// TagRPC implements stats.Handler.
+func (m *Server) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	service, method := splitMethod(info.FullMethodName)
+	return context.WithValue(ctx, rpcTagKey{}, &rpcTag{typ: "unary", service: service, method: method})
+}
+
+// HandleRPC implements stats.Handler.
+func (m *Server) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	tag, ok := ctx.Value(rpcTagKey{}).(*rpcTag)
+	if !ok {
+		return
+	}
+	switch s := s.(type) {
+	case *stats.Begin:
+		tag.typ = rpcType(s)
+		m.started.WithLabelValues(tag.typ, tag.service, tag.method).Inc()
+	case *stats.InPayload:
+		m.received.WithLabelValues(tag.typ, tag.service, tag.method).Inc()
+	case *stats.OutPayload:
+		m.sent.WithLabelValues(tag.typ, tag.service, tag.method).Inc()
+	case *stats.End:
+		m.handled.WithLabelValues(tag.typ, tag.service, tag.method, status.Code(s.Error).String()).Inc()
+		m.handling.WithLabelValues(tag.typ, tag.service, tag.method).Observe(s.EndTime.Sub(s.BeginTime).Seconds())
+	}
+}
+
+// TagConn implements stats.Handler.
+func (m *Server) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn implements stats.Handler.
+func (m *Server) HandleConn(_ context.Context, s stats.ConnStats) {
+	switch s.(type) {
+	case *stats.ConnBegin:
+		m.connections.Inc()
+		m.connsTotal.Inc()
+	case *stats.ConnEnd:
+		m.connections.Dec()
+	}
+}
+
+// Attester returns att recording the duration and the errors of its
+// attestation requests. It keeps the io.Closer of att, if any, and passes
+// the context of the request on to it.
+func (m *Server) Attester(att attester.Attester) attester.Attester {
+	return &instrumentedAttester{Attester: att, m: m}
+}
+
+type instrumentedAttester struct {
+	attester.Attester
+	m *Server
+}
+
+func (a *instrumentedAttester) Attest(nonce, userData, publicKey []byte) ([]byte, error) {
+	return a.AttestContext(context.Background(), nonce, userData, publicKey)
+}
+
+// AttestContext implements attester.ContextAttester, passing ctx to the wrapped
+// attester.
+func (a *instrumentedAttester) AttestContext(ctx context.Context, nonce, userData, publicKey []byte) ([]byte, error) {
+	start := time.Now()
+	doc, err := attester.AttestContext(ctx, a.Attester, nonce, userData, publicKey)
+	a.m.attestSeconds.Observe(time.Since(start).Seconds())
+	if err != nil {
+		a.m.attestErrors.Inc()
+	}
+	return doc, err
+}
+
+// Close closes the wrapped attester if it is an io.Closer.
+func (a *instrumentedAttester) Close() error {
+	if closer, ok := a.Attester.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
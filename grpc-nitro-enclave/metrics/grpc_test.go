@@ -0,0 +1,116 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/metrics"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+)
+
+// text returns the metrics gathered from g in the text exposition format.
+func text(t *testing.T, g prometheus.Gatherer) string {
+	t.Helper()
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	var b strings.Builder
+	enc := expfmt.NewEncoder(&b, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, f := range families {
+		if err := enc.Encode(f); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+	}
+	return b.String()
+}
+
+// failingAttester always fails to attest.
+type failingAttester struct{}
+
+func (failingAttester) Attest(nonce, userData, publicKey []byte) ([]byte, error) {
+	return nil, errors.New("nsm: device unavailable")
+}
+
+func TestServer(t *testing.T) {
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	r := prometheus.NewRegistry()
+	m := metrics.NewServer(r)
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.StatsHandler(m))
+	pb.RegisterEchoServiceServer(s, service.NewEcho(m.Attester(nsm), nil))
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client := pb.NewEchoServiceClient(conn)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Echo(ctx, &pb.EchoRequest{Message: "hi", Nonce: []byte("nonce")}); err != nil {
+			t.Fatalf("Echo: %v", err)
+		}
+	}
+	if _, err := client.Echo(ctx, &pb.EchoRequest{Message: "hi"}); err == nil {
+		t.Fatal("Echo without nonce succeeded")
+	}
+
+	got := text(t, r)
+	for _, want := range []string{
+		`grpc_server_started_total{grpc_method="Echo",grpc_service="echo.EchoService",grpc_type="unary"} 3`,
+		`grpc_server_handled_total{grpc_code="OK",grpc_method="Echo",grpc_service="echo.EchoService",grpc_type="unary"} 2`,
+		`grpc_server_handled_total{grpc_code="InvalidArgument",grpc_method="Echo",grpc_service="echo.EchoService",grpc_type="unary"} 1`,
+		`grpc_server_handling_seconds_count{grpc_method="Echo",grpc_service="echo.EchoService",grpc_type="unary"} 3`,
+		`grpc_server_msg_sent_total{grpc_method="Echo",grpc_service="echo.EchoService",grpc_type="unary"} 2`,
+		"\ngrpc_server_connections_active 1\n",
+		"\ngrpc_server_connections_total 1\n",
+		"\nenclave_nsm_attestation_seconds_count 2\n",
+		"\nenclave_nsm_attestation_errors_total 0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, got)
+		}
+	}
+
+	conn.Close()
+	s.Stop()
+	if got := text(t, r); !strings.Contains(got, "\ngrpc_server_connections_active 0\n") {
+		t.Errorf("connection still active after Stop:\n%s", got)
+	}
+}
+
+func TestAttesterErrors(t *testing.T) {
+	r := prometheus.NewRegistry()
+	att := metrics.NewServer(r).Attester(failingAttester{})
+	if _, err := att.Attest(nil, nil, nil); err == nil {
+		t.Fatal("Attest succeeded")
+	}
+	got := text(t, r)
+	for _, want := range []string{"\nenclave_nsm_attestation_errors_total 1\n", "\nenclave_nsm_attestation_seconds_count 1\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, got)
+		}
+	}
+}
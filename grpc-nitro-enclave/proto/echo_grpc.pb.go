@@ -23,6 +23,14 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type EchoServiceClient interface {
 	Echo(ctx context.Context, in *EchoRequest, opts ...grpc.CallOption) (*EchoResponse, error)
+	// GetSigningKey returns the public key that signs responses, bound into an attestation document
+	GetSigningKey(ctx context.Context, in *SigningKeyRequest, opts ...grpc.CallOption) (*SigningKeyResponse, error)
+	// EchoServerStream answers a request with count responses
+	EchoServerStream(ctx context.Context, in *EchoStreamRequest, opts ...grpc.CallOption) (EchoService_EchoServerStreamClient, error)
+	// EchoClientStream answers all requests of the stream with one response
+	EchoClientStream(ctx context.Context, opts ...grpc.CallOption) (EchoService_EchoClientStreamClient, error)
+	// EchoBidiStream answers every request with one response
+	EchoBidiStream(ctx context.Context, opts ...grpc.CallOption) (EchoService_EchoBidiStreamClient, error)
 }
 
 type echoServiceClient struct {
@@ -42,11 +50,125 @@ func (c *echoServiceClient) Echo(ctx context.Context, in *EchoRequest, opts ...g
 	return out, nil
 }
 
+func (c *echoServiceClient) GetSigningKey(ctx context.Context, in *SigningKeyRequest, opts ...grpc.CallOption) (*SigningKeyResponse, error) {
+	out := new(SigningKeyResponse)
+	err := c.cc.Invoke(ctx, "/echo.EchoService/GetSigningKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *echoServiceClient) EchoServerStream(ctx context.Context, in *EchoStreamRequest, opts ...grpc.CallOption) (EchoService_EchoServerStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EchoService_ServiceDesc.Streams[0], "/echo.EchoService/EchoServerStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &echoServiceEchoServerStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type EchoService_EchoServerStreamClient interface {
+	Recv() (*EchoStreamResponse, error)
+	grpc.ClientStream
+}
+
+type echoServiceEchoServerStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *echoServiceEchoServerStreamClient) Recv() (*EchoStreamResponse, error) {
+	m := new(EchoStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *echoServiceClient) EchoClientStream(ctx context.Context, opts ...grpc.CallOption) (EchoService_EchoClientStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EchoService_ServiceDesc.Streams[1], "/echo.EchoService/EchoClientStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &echoServiceEchoClientStreamClient{stream}
+	return x, nil
+}
+
+type EchoService_EchoClientStreamClient interface {
+	Send(*EchoStreamRequest) error
+	CloseAndRecv() (*EchoStreamResponse, error)
+	grpc.ClientStream
+}
+
+type echoServiceEchoClientStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *echoServiceEchoClientStreamClient) Send(m *EchoStreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *echoServiceEchoClientStreamClient) CloseAndRecv() (*EchoStreamResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(EchoStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *echoServiceClient) EchoBidiStream(ctx context.Context, opts ...grpc.CallOption) (EchoService_EchoBidiStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EchoService_ServiceDesc.Streams[2], "/echo.EchoService/EchoBidiStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &echoServiceEchoBidiStreamClient{stream}
+	return x, nil
+}
+
+type EchoService_EchoBidiStreamClient interface {
+	Send(*EchoStreamRequest) error
+	Recv() (*EchoStreamResponse, error)
+	grpc.ClientStream
+}
+
+type echoServiceEchoBidiStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *echoServiceEchoBidiStreamClient) Send(m *EchoStreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *echoServiceEchoBidiStreamClient) Recv() (*EchoStreamResponse, error) {
+	m := new(EchoStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // EchoServiceServer is the server API for EchoService service.
 // All implementations must embed UnimplementedEchoServiceServer
 // for forward compatibility
 type EchoServiceServer interface {
 	Echo(context.Context, *EchoRequest) (*EchoResponse, error)
+	// GetSigningKey returns the public key that signs responses, bound into an attestation document
+	GetSigningKey(context.Context, *SigningKeyRequest) (*SigningKeyResponse, error)
+	// EchoServerStream answers a request with count responses
+	EchoServerStream(*EchoStreamRequest, EchoService_EchoServerStreamServer) error
+	// EchoClientStream answers all requests of the stream with one response
+	EchoClientStream(EchoService_EchoClientStreamServer) error
+	// EchoBidiStream answers every request with one response
+	EchoBidiStream(EchoService_EchoBidiStreamServer) error
 	mustEmbedUnimplementedEchoServiceServer()
 }
 
@@ -57,6 +179,18 @@ type UnimplementedEchoServiceServer struct {
 func (UnimplementedEchoServiceServer) Echo(context.Context, *EchoRequest) (*EchoResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Echo not implemented")
 }
+func (UnimplementedEchoServiceServer) GetSigningKey(context.Context, *SigningKeyRequest) (*SigningKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSigningKey not implemented")
+}
+func (UnimplementedEchoServiceServer) EchoServerStream(*EchoStreamRequest, EchoService_EchoServerStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method EchoServerStream not implemented")
+}
+func (UnimplementedEchoServiceServer) EchoClientStream(EchoService_EchoClientStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method EchoClientStream not implemented")
+}
+func (UnimplementedEchoServiceServer) EchoBidiStream(EchoService_EchoBidiStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method EchoBidiStream not implemented")
+}
 func (UnimplementedEchoServiceServer) mustEmbedUnimplementedEchoServiceServer() {}
 
 // UnsafeEchoServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -88,6 +222,97 @@ func _EchoService_Echo_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _EchoService_GetSigningKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SigningKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EchoServiceServer).GetSigningKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/echo.EchoService/GetSigningKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EchoServiceServer).GetSigningKey(ctx, req.(*SigningKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EchoService_EchoServerStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EchoStreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EchoServiceServer).EchoServerStream(m, &echoServiceEchoServerStreamServer{stream})
+}
+
+type EchoService_EchoServerStreamServer interface {
+	Send(*EchoStreamResponse) error
+	grpc.ServerStream
+}
+
+type echoServiceEchoServerStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *echoServiceEchoServerStreamServer) Send(m *EchoStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _EchoService_EchoClientStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EchoServiceServer).EchoClientStream(&echoServiceEchoClientStreamServer{stream})
+}
+
+type EchoService_EchoClientStreamServer interface {
+	SendAndClose(*EchoStreamResponse) error
+	Recv() (*EchoStreamRequest, error)
+	grpc.ServerStream
+}
+
+type echoServiceEchoClientStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *echoServiceEchoClientStreamServer) SendAndClose(m *EchoStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *echoServiceEchoClientStreamServer) Recv() (*EchoStreamRequest, error) {
+	m := new(EchoStreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _EchoService_EchoBidiStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EchoServiceServer).EchoBidiStream(&echoServiceEchoBidiStreamServer{stream})
+}
+
+type EchoService_EchoBidiStreamServer interface {
+	Send(*EchoStreamResponse) error
+	Recv() (*EchoStreamRequest, error)
+	grpc.ServerStream
+}
+
+type echoServiceEchoBidiStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *echoServiceEchoBidiStreamServer) Send(m *EchoStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *echoServiceEchoBidiStreamServer) Recv() (*EchoStreamRequest, error) {
+	m := new(EchoStreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // EchoService_ServiceDesc is the grpc.ServiceDesc for EchoService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -99,7 +324,28 @@ var EchoService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Echo",
 			Handler:    _EchoService_Echo_Handler,
 		},
+		{
+			MethodName: "GetSigningKey",
+			Handler:    _EchoService_GetSigningKey_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "EchoServerStream",
+			Handler:       _EchoService_EchoServerStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "EchoClientStream",
+			Handler:       _EchoService_EchoClientStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "EchoBidiStream",
+			Handler:       _EchoService_EchoBidiStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/echo.proto",
 }
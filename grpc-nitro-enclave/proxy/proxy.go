@@ -0,0 +1,349 @@
+// Package proxy forwards TCP connections on the parent instance to a vsock
+// listener inside an enclave, replacing socat.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are cumulative counters of a Proxy.
+type Stats struct {
+	Accepted    uint64 // connections accepted
+	Rejected    uint64 // connections rejected because of the connection limit
+	Failed      uint64 // connections whose upstream dial failed
+	Active      int64  // connections currently being forwarded
+	BytesIn     uint64 // bytes copied from clients to the upstream
+	BytesOut    uint64 // bytes copied from the upstream to clients
+	IdleTimeout uint64 // connections closed because they were idle
+}
+
+// Proxy copies bytes between accepted connections and connections obtained from Dial.
+type Proxy struct {
+	// Dial opens the upstream connection, e.g. to a vsock CID and port.
+	Dial func() (net.Conn, error)
+
+	// MaxConns limits the number of concurrent connections. Zero means no limit.
+	MaxConns int
+
+	// IdleTimeout closes a connection when no bytes were copied in either
+	// direction for this long. Zero disables the timeout.
+	IdleTimeout time.Duration
+
+	// Logger receives per-connection logs. If nil, the standard logger is used.
+	Logger *log.Logger
+
+	accepted, rejected, failed, idle atomic.Uint64
+	bytesIn, bytesOut                atomic.Uint64
+	active                           atomic.Int64
+	nextID                           atomic.Uint64
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*proxyConn]struct{}
+	shutdown  bool
+	wg        sync.WaitGroup
+}
+
+// ErrProxyClosed is returned by Serve after Shutdown or Close.
+var ErrProxyClosed = errors.New("proxy: closed")
+
+// minIdleCheck is the shortest interval between two checks of the idle timeout.
+const minIdleCheck = time.Millisecond
+
+// errConnLimit is returned by addConn when MaxConns connections are active.
+var errConnLimit = errors.New("proxy: connection limit reached")
+
+// Serve accepts connections on l and forwards them until Shutdown or Close is
+// called or l fails. It always returns a non-nil error.
+func (p *Proxy) Serve(l net.Listener) error {
+	if !p.trackListener(l, true) {
+		return ErrProxyClosed
+	}
+	defer p.trackListener(l, false)
+
+	for {
+		client, err := l.Accept()
+		if err != nil {
+			if p.closed() {
+				return ErrProxyClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		p.accepted.Add(1)
+
+		pc := &proxyConn{id: p.nextID.Add(1), client: client}
+		switch err := p.addConn(pc); {
+		case errors.Is(err, errConnLimit):
+			p.rejected.Add(1)
+			p.logf("rejected connection from %s: limit of %d connections reached", client.RemoteAddr(), p.MaxConns)
+			client.Close()
+			continue
+		case err != nil:
+			client.Close()
+			return err
+		}
+		go p.handle(pc)
+	}
+}
+
+// Shutdown stops accepting connections and waits for active connections to
+// finish. If ctx expires first, the remaining connections are closed and the
+// context error is returned.
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	p.closeListeners()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		p.closeConns()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting connections and closes all active connections.
+func (p *Proxy) Close() error {
+	p.closeListeners()
+	p.closeConns()
+	p.wg.Wait()
+	return nil
+}
+
+// Stats returns a snapshot of the proxy counters.
+func (p *Proxy) Stats() Stats {
+	return Stats{
+		Accepted:    p.accepted.Load(),
+		Rejected:    p.rejected.Load(),
+		Failed:      p.failed.Load(),
+		Active:      p.active.Load(),
+		BytesIn:     p.bytesIn.Load(),
+		BytesOut:    p.bytesOut.Load(),
+		IdleTimeout: p.idle.Load(),
+	}
+}
+
+// proxyConn is a client connection and its upstream connection.
+type proxyConn struct {
+	id       uint64
+	client   net.Conn
+	upstream net.Conn
+
+	mu           sync.Mutex
+	lastActivity time.Time
+}
+
+func (c *proxyConn) touch() {
+	c.mu.Lock()
+	c.lastActivity = time.Now()
+	c.mu.Unlock()
+}
+
+func (c *proxyConn) idleSince() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Since(c.lastActivity)
+}
+
+func (c *proxyConn) close() {
+	c.client.Close()
+	c.mu.Lock()
+	upstream := c.upstream
+	c.mu.Unlock()
+	if upstream != nil {
+		upstream.Close()
+	}
+}
+
+func (p *Proxy) handle(c *proxyConn) {
+	defer p.wg.Done()
+	defer p.removeConn(c)
+	defer c.client.Close()
+
+	start := time.Now()
+	upstream, err := p.Dial()
+	if err != nil {
+		p.failed.Add(1)
+		p.logf("conn %d from %s: failed to connect upstream: %v", c.id, c.client.RemoteAddr(), err)
+		return
+	}
+	defer upstream.Close()
+
+	c.mu.Lock()
+	c.upstream = upstream
+	c.lastActivity = time.Now()
+	c.mu.Unlock()
+	if p.closed() {
+		return
+	}
+	p.logf("conn %d: %s -> %s", c.id, c.client.RemoteAddr(), upstream.RemoteAddr())
+
+	var in, out atomic.Uint64
+	var copies sync.WaitGroup
+	copies.Add(2)
+	go func() {
+		defer copies.Done()
+		p.copy(c, upstream, c.client, &in, &p.bytesIn)
+	}()
+	go func() {
+		defer copies.Done()
+		p.copy(c, c.client, upstream, &out, &p.bytesOut)
+	}()
+
+	reason := "closed"
+	if p.IdleTimeout > 0 {
+		done := make(chan struct{})
+		go func() {
+			copies.Wait()
+			close(done)
+		}()
+		// Check for idleness four times per timeout, but not more often
+		// than minIdleCheck, so that tiny timeouts don't spin (or panic)
+		ticker := time.NewTicker(max(p.IdleTimeout/4, minIdleCheck))
+	wait:
+		for {
+			select {
+			case <-done:
+				break wait
+			case <-ticker.C:
+				if c.idleSince() >= p.IdleTimeout {
+					p.idle.Add(1)
+					reason = "idle timeout"
+					c.close()
+					<-done
+					break wait
+				}
+			}
+		}
+		ticker.Stop()
+	} else {
+		copies.Wait()
+	}
+
+	p.logf("conn %d: %s after %v, %d bytes in, %d bytes out", c.id, reason, time.Since(start).Round(time.Millisecond), in.Load(), out.Load())
+}
+
+// copy copies from src to dst until EOF, then half-closes dst so the peer sees
+// the end of the stream. On errors, or if dst cannot be half-closed, both
+// connections are closed.
+func (p *Proxy) copy(c *proxyConn, dst, src net.Conn, connCounter, totalCounter *atomic.Uint64) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			c.touch()
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				c.close()
+				return
+			}
+			connCounter.Add(uint64(n))
+			totalCounter.Add(uint64(n))
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			c.close()
+			return
+		}
+	}
+
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok && cw.CloseWrite() == nil {
+		return
+	}
+	c.close()
+}
+
+func (p *Proxy) trackListener(l net.Listener, add bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if add {
+		if p.shutdown {
+			return false
+		}
+		if p.listeners == nil {
+			p.listeners = make(map[net.Listener]struct{})
+		}
+		p.listeners[l] = struct{}{}
+	} else {
+		delete(p.listeners, l)
+	}
+	return true
+}
+
+// addConn registers c as active, unless the proxy is shut down or MaxConns
+// connections are active. It is done under p.mu so that Shutdown and Close
+// wait for every connection that was added.
+func (p *Proxy) addConn(c *proxyConn) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.shutdown {
+		return ErrProxyClosed
+	}
+	if p.MaxConns > 0 && len(p.conns) >= p.MaxConns {
+		return errConnLimit
+	}
+	if p.conns == nil {
+		p.conns = make(map[*proxyConn]struct{})
+	}
+	p.conns[c] = struct{}{}
+	p.active.Add(1)
+	p.wg.Add(1)
+	return nil
+}
+
+func (p *Proxy) removeConn(c *proxyConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.conns, c)
+	p.active.Add(-1)
+}
+
+func (p *Proxy) closed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.shutdown
+}
+
+func (p *Proxy) closeListeners() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shutdown = true
+	for l := range p.listeners {
+		l.Close()
+	}
+}
+
+func (p *Proxy) closeConns() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for c := range p.conns {
+		c.close()
+	}
+}
+
+func (p *Proxy) logf(format string, args ...any) {
+	if p.Logger != nil {
+		p.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
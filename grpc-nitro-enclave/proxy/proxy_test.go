@@ -0,0 +1,268 @@
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/proxy"
+)
+
+// upstream listens on loopback and hands out the connections it accepts.
+type upstream struct {
+	lis   net.Listener
+	conns chan net.Conn
+}
+
+func newUpstream(t *testing.T) *upstream {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	u := &upstream{lis: lis, conns: make(chan net.Conn, 16)}
+	go func() {
+		for {
+			c, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			u.conns <- c
+		}
+	}()
+	t.Cleanup(func() {
+		lis.Close()
+		close(u.conns)
+		for c := range u.conns {
+			c.Close()
+		}
+	})
+	return u
+}
+
+func (u *upstream) dial() (net.Conn, error) {
+	return net.Dial("tcp", u.lis.Addr().String())
+}
+
+// accept returns the next upstream connection opened by the proxy.
+func (u *upstream) accept(t *testing.T) net.Conn {
+	t.Helper()
+	select {
+	case c := <-u.conns:
+		t.Cleanup(func() { c.Close() })
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxy did not connect upstream")
+		return nil
+	}
+}
+
+// startProxy serves p on a loopback listener and returns its address. The
+// proxy is closed at the end of the test.
+func startProxy(t *testing.T, p *proxy.Proxy) string {
+	t.Helper()
+	p.Logger = log.New(io.Discard, "", 0)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- p.Serve(lis) }()
+	t.Cleanup(func() {
+		p.Close()
+		if err := <-served; !errors.Is(err, proxy.ErrProxyClosed) {
+			t.Errorf("Serve = %v, want %v", err, proxy.ErrProxyClosed)
+		}
+	})
+	return lis.Addr().String()
+}
+
+func dial(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func expectRead(t *testing.T, c net.Conn, want string) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, len(want))
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(buf) != want {
+		t.Fatalf("Read = %q, want %q", buf, want)
+	}
+}
+
+// expectClosed checks that the peer of c closes the connection.
+func expectClosed(t *testing.T, c net.Conn) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Fatal("connection still open")
+	} else if errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("connection not closed in time")
+	}
+}
+
+func TestForward(t *testing.T) {
+	u := newUpstream(t)
+	p := &proxy.Proxy{Dial: u.dial}
+	client := dial(t, startProxy(t, p))
+	server := u.accept(t)
+
+	if _, err := client.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	expectRead(t, server, "ping")
+	if _, err := server.Write([]byte("pong!")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	expectRead(t, client, "pong!")
+
+	if s := p.Stats(); s.Accepted != 1 || s.Active != 1 {
+		t.Errorf("Stats = %+v, want 1 accepted and 1 active connection", s)
+	}
+
+	// Closing the client ends the connection on both sides
+	client.Close()
+	expectClosed(t, server)
+	server.Close()
+	waitFor(t, func() bool { return p.Stats().Active == 0 })
+	if s := p.Stats(); s.BytesIn != 4 || s.BytesOut != 5 {
+		t.Errorf("Stats = %+v, want 4 bytes in and 5 bytes out", s)
+	}
+}
+
+func TestMaxConns(t *testing.T) {
+	u := newUpstream(t)
+	p := &proxy.Proxy{Dial: u.dial, MaxConns: 1}
+	addr := startProxy(t, p)
+
+	first := dial(t, addr)
+	firstServer := u.accept(t)
+	second := dial(t, addr)
+	expectClosed(t, second)
+	if s := p.Stats(); s.Accepted != 2 || s.Rejected != 1 || s.Active != 1 {
+		t.Errorf("Stats = %+v, want 2 accepted, 1 rejected and 1 active connection", s)
+	}
+
+	// The slot is free again once the first connection ends
+	first.Close()
+	firstServer.Close()
+	waitFor(t, func() bool { return p.Stats().Active == 0 })
+	third := dial(t, addr)
+	server := u.accept(t)
+	if _, err := third.Write([]byte("hi")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	expectRead(t, server, "hi")
+}
+
+func TestIdleTimeout(t *testing.T) {
+	// Timeouts shorter than the check interval must not panic
+	for _, timeout := range []time.Duration{100 * time.Millisecond, time.Millisecond, time.Nanosecond} {
+		t.Run(timeout.String(), func(t *testing.T) {
+			u := newUpstream(t)
+			p := &proxy.Proxy{Dial: u.dial, IdleTimeout: timeout}
+			client := dial(t, startProxy(t, p))
+			server := u.accept(t)
+
+			expectClosed(t, client)
+			expectClosed(t, server)
+			waitFor(t, func() bool { return p.Stats().Active == 0 })
+			if s := p.Stats(); s.IdleTimeout != 1 {
+				t.Errorf("Stats = %+v, want 1 idle timeout", s)
+			}
+		})
+	}
+}
+
+func TestDialFailure(t *testing.T) {
+	p := &proxy.Proxy{Dial: func() (net.Conn, error) { return nil, errors.New("no enclave") }}
+	client := dial(t, startProxy(t, p))
+	expectClosed(t, client)
+	waitFor(t, func() bool { return p.Stats().Active == 0 })
+	if s := p.Stats(); s.Failed != 1 {
+		t.Errorf("Stats = %+v, want 1 failed connection", s)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	u := newUpstream(t)
+	p := &proxy.Proxy{Dial: u.dial}
+	addr := startProxy(t, p)
+	client := dial(t, addr)
+	server := u.accept(t)
+
+	// Shutdown waits for the active connection until the context expires,
+	// then closes it
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+	expectClosed(t, client)
+	expectClosed(t, server)
+	if s := p.Stats(); s.Active != 0 {
+		t.Errorf("Stats = %+v, want no active connection", s)
+	}
+
+	// New connections are refused
+	if c, err := net.Dial("tcp", addr); err == nil {
+		expectClosed(t, c)
+		c.Close()
+	}
+}
+
+func TestShutdownDrains(t *testing.T) {
+	u := newUpstream(t)
+	p := &proxy.Proxy{Dial: u.dial}
+	client := dial(t, startProxy(t, p))
+	server := u.accept(t)
+
+	done := make(chan error, 1)
+	go func() { done <- p.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v with an active connection", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The connection still forwards until it ends
+	if _, err := client.Write([]byte("bye")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	expectRead(t, server, "bye")
+	client.Close()
+	server.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Shutdown = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after the connection ended")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,146 @@
+package ratls
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/metrics"
+)
+
+// DefaultMaxCacheEntries is the default maximum number of server certificates
+// remembered by a Cache.
+const DefaultMaxCacheEntries = 1024
+
+// Cache remembers the server certificates whose attestation documents
+// verified, so that reconnecting to a server with the same key does not verify
+// its document again. A certificate is remembered until it, or a certificate of
+// the attestation chain, expires, and no longer than VerifyOptions.MaxAge after
+// the document timestamp. A server that changes its key presents a new
+// certificate, whose document is verified on the first handshake.
+//
+// A Cache is bound to the VerifyOptions it was created with. It is safe for
+// concurrent use.
+type Cache struct {
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+
+	// MaxEntries is the maximum number of certificates remembered. If zero,
+	// DefaultMaxCacheEntries is used.
+	MaxEntries int
+
+	opts    attestation.VerifyOptions
+	metrics *metrics.Client
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]cacheEntry
+}
+
+type cacheEntry struct {
+	doc     *attestation.AttestationDocument
+	expires time.Time
+}
+
+// NewCache returns an empty Cache verifying documents with opts. The cache
+// lookups and the verifications are recorded in m, if not nil.
+func NewCache(opts attestation.VerifyOptions, m *metrics.Client) *Cache {
+	return &Cache{opts: opts, metrics: m, entries: make(map[[sha256.Size]byte]cacheEntry)}
+}
+
+func (c *Cache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// Credentials returns TLS credentials like NewClientCredentials that verify
+// server certificates through the cache.
+func (c *Cache) Credentials() credentials.TransportCredentials {
+	return newClientCredentials(func(cert *x509.Certificate) error {
+		_, err := c.Verify(cert)
+		return err
+	})
+}
+
+// Verify is VerifyCertificate with the options of the cache, returning the
+// remembered document if cert was verified before and has not expired.
+func (c *Cache) Verify(cert *x509.Certificate) (*attestation.AttestationDocument, error) {
+	key := sha256.Sum256(cert.Raw)
+	now := c.now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	hit := ok && now.Before(entry.expires)
+	c.metrics.ObserveCacheLookup(hit)
+	if hit {
+		return entry.doc, nil
+	}
+
+	start := time.Now()
+	report, err := verifyCertificate(cert, c.opts)
+	c.metrics.ObserveVerification("tls", start, err)
+	if err != nil {
+		return nil, err
+	}
+	expires := report.Expiry()
+	if cert.NotAfter.Before(expires) {
+		expires = cert.NotAfter
+	}
+	if c.opts.MaxAge > 0 {
+		stale := report.Document.Time().Add(c.opts.MaxAge)
+		if stale.Before(expires) {
+			expires = stale
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict(now)
+	c.entries[key] = cacheEntry{doc: report.Document, expires: expires}
+	return report.Document, nil
+}
+
+// evict drops the expired entries and, if the cache is still full, an
+// arbitrary entry to make room for a new one.
+func (c *Cache) evict(now time.Time) {
+	max := c.MaxEntries
+	if max <= 0 {
+		max = DefaultMaxCacheEntries
+	}
+	if len(c.entries) < max {
+		return
+	}
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < max {
+			break
+		}
+		delete(c.entries, key)
+	}
+}
+
+// Len returns the number of certificates remembered, including expired ones
+// that have not been evicted yet.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Purge forgets all certificates, so that the next handshakes verify the
+// server documents again.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
@@ -0,0 +1,110 @@
+package ratls_test
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/ratls"
+)
+
+func newCertificate(t *testing.T, nsm *attestertest.NSM) *x509.Certificate {
+	t.Helper()
+	tlsCert, err := ratls.NewCertificate(func(publicKey []byte) ([]byte, error) {
+		return nsm.Attest(nil, nil, publicKey)
+	})
+	if err != nil {
+		t.Fatalf("NewCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert
+}
+
+// stripped returns a copy of cert without its attestation document, which
+// only verifies if the cache remembers cert.
+func stripped(cert *x509.Certificate) *x509.Certificate {
+	c := *cert
+	c.Extensions = nil
+	return &c
+}
+
+func TestCache(t *testing.T) {
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	cache := ratls.NewCache(attestation.VerifyOptions{Roots: nsm.CA.Roots()}, nil)
+	now := time.Now()
+	cache.Now = func() time.Time { return now }
+
+	cert := newCertificate(t, nsm)
+	if _, err := cache.Verify(cert); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, err := cache.Verify(stripped(cert)); err != nil {
+		t.Fatalf("Verify of a remembered certificate: %v", err)
+	}
+
+	// A new server key is verified on its own
+	if _, err := cache.Verify(stripped(newCertificate(t, nsm))); err == nil {
+		t.Fatal("Verify accepted an unknown certificate without attestation document")
+	}
+	if _, err := cache.Verify(newCertificate(t, nsm)); err != nil {
+		t.Fatalf("Verify of a new certificate: %v", err)
+	}
+	if n := cache.Len(); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+
+	// The server certificate expires before the attestation leaf
+	now = cert.NotAfter
+	if _, err := cache.Verify(stripped(cert)); err == nil {
+		t.Fatal("Verify accepted an expired cache entry")
+	}
+
+	cache.Purge()
+	if n := cache.Len(); n != 0 {
+		t.Errorf("Len after Purge = %d, want 0", n)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	cache := ratls.NewCache(attestation.VerifyOptions{Roots: nsm.CA.Roots(), MaxAge: time.Minute}, nil)
+	now := time.Now()
+	cache.Now = func() time.Time { return now }
+
+	cert := newCertificate(t, nsm)
+	if _, err := cache.Verify(cert); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := cache.Verify(stripped(cert)); err == nil {
+		t.Fatal("Verify accepted a cache entry older than MaxAge")
+	}
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	cache := ratls.NewCache(attestation.VerifyOptions{Roots: nsm.CA.Roots()}, nil)
+	cache.MaxEntries = 2
+	for i := 0; i < 5; i++ {
+		if _, err := cache.Verify(newCertificate(t, nsm)); err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+	}
+	if n := cache.Len(); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+}
@@ -0,0 +1,186 @@
+// Package ratls provides attestation-bound TLS (RA-TLS) credentials for gRPC.
+//
+// The server generates an ephemeral key pair inside the enclave, requests an
+// attestation document whose public_key field holds the DER encoded public key
+// and serves a self-signed certificate for that key. The attestation document
+// is carried in a certificate extension. The client accepts the certificate only
+// if the document verifies and binds exactly the certificate's public key; the
+// TLS handshake then proves that the server holds the matching private key.
+package ratls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+)
+
+// AttestationExtensionOID identifies the certificate extension that carries the
+// attestation document. It is private to this sample and not registered.
+var AttestationExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1, 1}
+
+// CertificateLifetime is how long a server certificate is used before a new key
+// pair and attestation document are generated. It is shorter than the validity
+// of the NSM attestation certificate, so that clients can always verify the chain.
+const CertificateLifetime = time.Hour
+
+// AttestFunc returns an attestation document whose public_key field is publicKey.
+type AttestFunc func(publicKey []byte) ([]byte, error)
+
+// NewCertificate generates an ephemeral ECDSA P-384 key pair, obtains an
+// attestation document binding its public key and returns a self-signed
+// certificate for the key that carries the document.
+func NewCertificate(attest AttestFunc) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	doc, err := attest(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain attestation document: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "nitro-enclave"},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(CertificateLifetime + time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		ExtraExtensions: []pkix.Extension{
+			{Id: AttestationExtensionOID, Value: doc},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// certificateSource hands out the current server certificate and replaces it
+// once it is older than CertificateLifetime.
+type certificateSource struct {
+	attest AttestFunc
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	created time.Time
+}
+
+func (s *certificateSource) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cert == nil || time.Since(s.created) > CertificateLifetime {
+		cert, err := NewCertificate(s.attest)
+		if err != nil {
+			return nil, err
+		}
+		s.cert, s.created = cert, time.Now()
+	}
+	return s.cert, nil
+}
+
+// NewServerCredentials returns TLS credentials for a gRPC server running in an
+// enclave. The first certificate is created immediately so that attestation
+// errors surface at startup.
+func NewServerCredentials(attest AttestFunc) (credentials.TransportCredentials, error) {
+	source := &certificateSource{attest: attest}
+	if _, err := source.getCertificate(nil); err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		MinVersion:     tls.VersionTLS13,
+		GetCertificate: source.getCertificate,
+	}), nil
+}
+
+// NewClientCredentials returns TLS credentials that accept a server certificate
+// only if it carries an attestation document that verifies with opts and binds
+// the certificate's public key. The document is verified on every handshake;
+// see Cache to verify each server key once.
+func NewClientCredentials(opts attestation.VerifyOptions) credentials.TransportCredentials {
+	return newClientCredentials(func(cert *x509.Certificate) error {
+		_, err := VerifyCertificate(cert, opts)
+		return err
+	})
+}
+
+// newClientCredentials returns TLS credentials that authenticate the server
+// certificate with verify.
+func newClientCredentials(verify func(*x509.Certificate) error) credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS13,
+		// The certificate is self-signed; it is authenticated by the attestation
+		// document in VerifyPeerCertificate instead of a CA.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("ratls: no server certificate")
+			}
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return fmt.Errorf("ratls: failed to parse server certificate: %w", err)
+			}
+			return verify(cert)
+		},
+	})
+}
+
+// VerifyCertificate verifies the attestation document carried by cert with opts
+// and checks that it binds the certificate's public key. It returns the parsed
+// attestation document.
+func VerifyCertificate(cert *x509.Certificate, opts attestation.VerifyOptions) (*attestation.AttestationDocument, error) {
+	report, err := verifyCertificate(cert, opts)
+	if err != nil {
+		return nil, err
+	}
+	return report.Document, nil
+}
+
+func verifyCertificate(cert *x509.Certificate, opts attestation.VerifyOptions) (*attestation.VerificationReport, error) {
+	var rawDoc []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(AttestationExtensionOID) {
+			rawDoc = ext.Value
+			break
+		}
+	}
+	if rawDoc == nil {
+		return nil, errors.New("ratls: server certificate has no attestation document")
+	}
+
+	report := attestation.VerifyReport(rawDoc, opts)
+	if !report.OK() {
+		return nil, fmt.Errorf("ratls: %w", report.Err)
+	}
+	if !bytes.Equal(report.Document.PublicKey, cert.RawSubjectPublicKeyInfo) {
+		return nil, errors.New("ratls: attestation document does not bind the certificate public key")
+	}
+	return report, nil
+}
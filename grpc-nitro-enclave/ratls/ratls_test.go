@@ -0,0 +1,49 @@
+package ratls_test
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/ratls"
+)
+
+func TestVerifyCertificate(t *testing.T) {
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	opts := attestation.VerifyOptions{Roots: nsm.CA.Roots()}
+
+	tlsCert, err := ratls.NewCertificate(func(publicKey []byte) ([]byte, error) {
+		return nsm.Attest(nil, nil, publicKey)
+	})
+	if err != nil {
+		t.Fatalf("NewCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if _, err := ratls.VerifyCertificate(cert, opts); err != nil {
+		t.Fatalf("VerifyCertificate: %v", err)
+	}
+
+	// A document binding some other key must not authenticate the certificate.
+	otherCert, err := ratls.NewCertificate(func(publicKey []byte) ([]byte, error) {
+		return nsm.Attest(nil, nil, []byte("some other key"))
+	})
+	if err != nil {
+		t.Fatalf("NewCertificate: %v", err)
+	}
+	cert, err = x509.ParseCertificate(otherCert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	_, err = ratls.VerifyCertificate(cert, opts)
+	if err == nil || !strings.Contains(err.Error(), "does not bind") {
+		t.Fatalf("VerifyCertificate error = %v, want key binding error", err)
+	}
+}
@@ -0,0 +1,168 @@
+// Package sealed persists enclave state on the parent instance.
+//
+// State blobs are encrypted with AES-256-GCM under a sealing key that the
+// enclave obtains from a key release service (see package keyrelease) after
+// attestation, and stored through BlobStore on the parent instance. The key
+// release service only releases the sealing key to images whose PCRs satisfy
+// its policy for that key, which is the upgrade policy: to let a new image
+// restore the state of the current one, add the measurements of the new image
+// to the policy before deploying it, and remove the old ones afterwards.
+//
+// Each blob records its name, the time it was sealed and the PCRs of the
+// sealing enclave, authenticated with the state. The parent instance can
+// withhold blobs or replace them with older versions of the same name.
+package sealed
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/keyrelease"
+	blobpb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/blobstore"
+	keypb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/keyrelease"
+)
+
+// KeySize is the size of the sealing key.
+const KeySize = 32
+
+// blobVersion is the first byte of sealed blobs.
+const blobVersion = 1
+
+// ErrNotFound is returned by Load if no blob is stored under the name.
+var ErrNotFound = errors.New("sealed: blob not found")
+
+// Metadata describes a sealed blob.
+type Metadata struct {
+	Name     string         `json:"name"`
+	SealedAt time.Time      `json:"sealed_at"`
+	PCRs     map[int][]byte `json:"pcrs"` // PCRs of the sealing enclave
+}
+
+// Store seals state blobs and keeps them in a BlobStore.
+type Store struct {
+	blobs blobpb.BlobStoreClient
+	aead  cipher.AEAD
+	pcrs  map[int][]byte
+}
+
+// NewStore returns a Store sealing blobs under key and recording pcrs as the
+// PCRs of the sealing enclave.
+func NewStore(key []byte, pcrs map[int][]byte, blobs blobpb.BlobStoreClient) (*Store, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("sealed: key is %d bytes, want %d", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{blobs: blobs, aead: aead, pcrs: pcrs}, nil
+}
+
+// Open fetches the sealing key keyID from the key release service after
+// attesting with att, and returns a Store keeping blobs in blobs. It fails if
+// the PCRs of this enclave do not satisfy the policy of the key.
+func Open(ctx context.Context, keys keypb.KeyReleaseServiceClient, keyID string, blobs blobpb.BlobStoreClient, att attester.Attester) (*Store, error) {
+	key, err := keyrelease.Fetch(ctx, keys, att, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("sealed: failed to fetch sealing key: %w", err)
+	}
+
+	// Read the PCRs of this enclave from a document of the local NSM
+	doc, err := attester.AttestContext(ctx, att, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("sealed: failed to obtain attestation document: %w", err)
+	}
+	parsed, err := attestation.Parse(doc)
+	if err != nil {
+		return nil, fmt.Errorf("sealed: %w", err)
+	}
+	return NewStore(key, parsed.PCRs, blobs)
+}
+
+// Save seals state and stores it under name, replacing any previous blob.
+func (s *Store) Save(ctx context.Context, name string, state []byte) error {
+	header, err := json.Marshal(&Metadata{Name: name, SealedAt: time.Now().UTC(), PCRs: s.pcrs})
+	if err != nil {
+		return err
+	}
+	blob := []byte{blobVersion}
+	blob = binary.BigEndian.AppendUint32(blob, uint32(len(header)))
+	blob = append(blob, header...)
+	aad := len(blob)
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	blob = append(blob, nonce...)
+	blob = s.aead.Seal(blob, nonce, state, blob[:aad])
+
+	if _, err := s.blobs.Put(ctx, &blobpb.PutRequest{Name: name, Data: blob}); err != nil {
+		return fmt.Errorf("sealed: failed to store %q: %w", name, err)
+	}
+	return nil
+}
+
+// Load fetches the blob stored under name and unseals it. It returns
+// ErrNotFound if there is none.
+func (s *Store) Load(ctx context.Context, name string) ([]byte, *Metadata, error) {
+	r, err := s.blobs.Get(ctx, &blobpb.GetRequest{Name: name})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("sealed: failed to fetch %q: %w", name, err)
+	}
+	state, meta, err := s.open(r.GetData())
+	if err != nil {
+		return nil, nil, fmt.Errorf("sealed: %q: %w", name, err)
+	}
+	if meta.Name != name {
+		return nil, nil, fmt.Errorf("sealed: blob %q was sealed as %q", name, meta.Name)
+	}
+	return state, meta, nil
+}
+
+// Delete removes the blob stored under name.
+func (s *Store) Delete(ctx context.Context, name string) error {
+	if _, err := s.blobs.Delete(ctx, &blobpb.DeleteRequest{Name: name}); err != nil {
+		return fmt.Errorf("sealed: failed to delete %q: %w", name, err)
+	}
+	return nil
+}
+
+func (s *Store) open(blob []byte) ([]byte, *Metadata, error) {
+	if len(blob) < 5 || blob[0] != blobVersion {
+		return nil, nil, errors.New("not a sealed blob")
+	}
+	n := int(binary.BigEndian.Uint32(blob[1:5]))
+	aad := 5 + n
+	if len(blob) < aad+s.aead.NonceSize() {
+		return nil, nil, errors.New("truncated sealed blob")
+	}
+	nonce := blob[aad : aad+s.aead.NonceSize()]
+	state, err := s.aead.Open(nil, nonce, blob[aad+s.aead.NonceSize():], blob[:aad])
+	if err != nil {
+		return nil, nil, errors.New("blob was not sealed with this key or was modified")
+	}
+	var meta Metadata
+	if err := json.Unmarshal(blob[5:aad], &meta); err != nil {
+		return nil, nil, fmt.Errorf("invalid sealed blob header: %w", err)
+	}
+	return state, &meta, nil
+}
@@ -0,0 +1,190 @@
+package sealed_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/blobstore"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/keyrelease"
+	blobpb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/blobstore"
+	keypb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/keyrelease"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/sealed"
+)
+
+// parent runs the key release service and the blob store of the parent instance.
+type parent struct {
+	dir   string
+	keys  keypb.KeyReleaseServiceClient
+	blobs blobpb.BlobStoreClient
+}
+
+// startParent serves a sealing key released to images matching upgradePolicy,
+// and a blob store in a temporary directory.
+func startParent(t *testing.T, ca *attestertest.CA, upgradePolicy *attestation.PCRPolicy) *parent {
+	t.Helper()
+	keys, err := keyrelease.NewServer(keyrelease.Options{
+		Secrets:  map[string][]byte{"sealing-key": bytes.Repeat([]byte{7}, sealed.KeySize)},
+		Verify:   attestation.VerifyOptions{Roots: ca.Roots()},
+		Policies: map[string]*attestation.PCRPolicy{"sealing-key": upgradePolicy},
+	})
+	if err != nil {
+		t.Fatalf("keyrelease.NewServer: %v", err)
+	}
+	dir := t.TempDir()
+	blobs, err := blobstore.NewServer(dir)
+	if err != nil {
+		t.Fatalf("blobstore.NewServer: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	keypb.RegisterKeyReleaseServiceServer(s, keys)
+	blobpb.RegisterBlobStoreServer(s, blobs)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &parent{dir: dir, keys: keypb.NewKeyReleaseServiceClient(conn), blobs: blobpb.NewBlobStoreClient(conn)}
+}
+
+// image returns a mock NSM of ca reporting PCR0 filled with b.
+func image(t *testing.T, ca *attestertest.CA, b byte) *attestertest.NSM {
+	t.Helper()
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	nsm.CA = ca
+	nsm.PCRs[0] = bytes.Repeat([]byte{b}, 48)
+	return nsm
+}
+
+func policy(images ...*attestertest.NSM) *attestation.PCRPolicy {
+	p := &attestation.PCRPolicy{}
+	for _, nsm := range images {
+		p.Allowed = append(p.Allowed, attestation.Measurements{0: nsm.PCRs[0]})
+	}
+	return p
+}
+
+func TestSaveLoad(t *testing.T) {
+	ca, err := attestertest.NewCA()
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	v1, v2, rogue := image(t, ca, 1), image(t, ca, 2), image(t, ca, 3)
+	p := startParent(t, ca, policy(v1, v2))
+	ctx := context.Background()
+
+	store, err := sealed.Open(ctx, p.keys, "sealing-key", p.blobs, v1)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	state := []byte(`{"counter": 42}`)
+	if err := store.Save(ctx, "state", state); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(p.dir, "state")); err != nil || bytes.Contains(data, state) {
+		t.Errorf("stored blob = %q, %v, want sealed state", data, err)
+	}
+
+	// The upgraded image restores the state sealed by the previous one
+	upgraded, err := sealed.Open(ctx, p.keys, "sealing-key", p.blobs, v2)
+	if err != nil {
+		t.Fatalf("Open upgraded image: %v", err)
+	}
+	got, meta, err := upgraded.Load(ctx, "state")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !bytes.Equal(got, state) {
+		t.Errorf("Load = %q, want %q", got, state)
+	}
+	if meta.Name != "state" || !bytes.Equal(meta.PCRs[0], v1.PCRs[0]) {
+		t.Errorf("Metadata = %+v, want state sealed by PCR0 %x", meta, v1.PCRs[0])
+	}
+
+	// An image outside the upgrade policy does not get the sealing key
+	if _, err := sealed.Open(ctx, p.keys, "sealing-key", p.blobs, rogue); err == nil {
+		t.Error("Open succeeded for an image outside the upgrade policy")
+	}
+
+	if _, _, err := upgraded.Load(ctx, "missing"); !errors.Is(err, sealed.ErrNotFound) {
+		t.Errorf("Load of a missing blob error = %v, want ErrNotFound", err)
+	}
+	if err := upgraded.Delete(ctx, "state"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := upgraded.Load(ctx, "state"); !errors.Is(err, sealed.ErrNotFound) {
+		t.Errorf("Load after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLoadRejectsTamperedBlobs(t *testing.T) {
+	ca, err := attestertest.NewCA()
+	if err != nil {
+		t.Fatalf("NewCA: %v", err)
+	}
+	nsm := image(t, ca, 1)
+	p := startParent(t, ca, policy(nsm))
+	ctx := context.Background()
+
+	store, err := sealed.Open(ctx, p.keys, "sealing-key", p.blobs, nsm)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := store.Save(ctx, "a", []byte("state of a")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	blob, err := os.ReadFile(filepath.Join(p.dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := sealed.NewStore(bytes.Repeat([]byte{8}, sealed.KeySize), nil, p.blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), blob...)
+	flipped[len(flipped)-1] ^= 1
+	tests := []struct {
+		name  string
+		blob  []byte
+		store *sealed.Store
+	}{
+		{name: "renamed", blob: blob, store: store},
+		{name: "modified", blob: flipped, store: store},
+		{name: "truncated", blob: blob[:10], store: store},
+		{name: "other key", blob: blob, store: otherKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(p.dir, "b"), tt.blob, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := tt.store.Load(ctx, "b"); err == nil || errors.Is(err, sealed.ErrNotFound) {
+				t.Errorf("Load error = %v, want tampering error", err)
+			}
+		})
+	}
+}
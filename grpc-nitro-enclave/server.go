@@ -1,84 +1,380 @@
+//go:build ignore
+
+// The enclave server is a standalone program: build it with `go build server.go`.
+// The ignore build tag keeps it out of `go build ./...`, as client.go
+// is a separate program in the same directory.
 package main
 
 import (
     "context"
+    "encoding/json"
+    "errors"
+    "flag"
     "log"
-    "fmt"
+    "net"
+    "net/http"
+    "io"
+    "os"
+    "os/signal"
+    "syscall"
     "encoding/base64"
+    "time"
 
-    "github.com/mdlayher/vsock"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/trace"
+    "go.opentelemetry.io/otel/trace/noop"
     "google.golang.org/grpc"
+    "google.golang.org/grpc/credentials/insecure"
+    healthpb "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/reflection"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/config"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/kms"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/metrics"
     pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
-
-    "github.com/hf/nsm"
-    "github.com/hf/nsm/request"
+    attpb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/attestation"
+    blobpb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/blobstore"
+    keypb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/keyrelease"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/ratls"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/sealed"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/signing"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/tracing"
+    "github.com/prof-project/nitro-example/grpc-nitro-enclave/transport"
 )
 
-const (
-    port = 50051 // vsock port number for the gRPC server
-)
+// dialParent connects to a service on the parent instance. With the vsock
+// transport, address is the port (or cid:port) of the service.
+func dialParent(transportName, address string) (*grpc.ClientConn, error) {
+    return grpc.NewClient("passthrough:///parent",
+        grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+            return transport.Dial(ctx, transportName, address)
+        }),
+        grpc.WithTransportCredentials(insecure.NewCredentials()),
+    )
+}
+
+// serverState is the state persisted across restarts in sealed storage.
+type serverState struct {
+    Boots     int       `json:"boots"`
+    FirstBoot time.Time `json:"first_boot"`
+}
+
+// restoreState restores the server state from sealed storage, counts this
+// boot and seals the updated state.
+func restoreState(ctx context.Context, store *sealed.Store) (*serverState, error) {
+    var state serverState
+    data, meta, err := store.Load(ctx, "server-state")
+    switch {
+    case errors.Is(err, sealed.ErrNotFound):
+        state.FirstBoot = time.Now().UTC()
+    case err != nil:
+        return nil, err
+    default:
+        if err := json.Unmarshal(data, &state); err != nil {
+            return nil, err
+        }
+        log.Printf("Restored state sealed at %v by an enclave with PCR0 %x", meta.SealedAt, meta.PCRs[0])
+    }
+    state.Boots++
+    data, err = json.Marshal(&state)
+    if err != nil {
+        return nil, err
+    }
+    return &state, store.Save(ctx, "server-state", data)
+}
 
-type server struct {
-    pb.UnimplementedEchoServiceServer
-    attestationDocument []byte
+// loadSigningKey returns the response signing key kept in sealed storage, or
+// generates one and seals it on first boot. Without a store, the key is
+// generated for this run only.
+func loadSigningKey(ctx context.Context, store *sealed.Store) (*signing.Signer, error) {
+    if store == nil {
+        key, err := signing.GenerateKey()
+        if err != nil {
+            return nil, err
+        }
+        return signing.NewSigner(key)
+    }
+    data, _, err := store.Load(ctx, "signing-key")
+    if err == nil {
+        key, err := signing.ParseKey(data)
+        if err != nil {
+            return nil, err
+        }
+        return signing.NewSigner(key)
+    }
+    if !errors.Is(err, sealed.ErrNotFound) {
+        return nil, err
+    }
+    key, err := signing.GenerateKey()
+    if err != nil {
+        return nil, err
+    }
+    data, err = signing.MarshalKey(key)
+    if err != nil {
+        return nil, err
+    }
+    if err := store.Save(ctx, "signing-key", data); err != nil {
+        return nil, err
+    }
+    return signing.NewSigner(key)
 }
 
-func (s *server) Echo(ctx context.Context, in *pb.EchoRequest) (*pb.EchoResponse, error) {
-    log.Printf("Received: %v", in.GetMessage())
-    // Include the attestation document in the response
-    return &pb.EchoResponse{
-        Message:             "Echo: " + in.GetMessage(),
-        AttestationDocument: s.attestationDocument,
-    }, nil
+// newTracerProvider returns the tracer provider exporting the spans of the
+// server as configured by cfg, or nil if tracing is disabled. The collector is
+// reached through the vsock proxy cfg.Tunnel on the parent instance, if set.
+func newTracerProvider(ctx context.Context, cfg config.Tracing) (*sdktrace.TracerProvider, error) {
+    var exp sdktrace.SpanExporter
+    var err error
+    switch {
+    case cfg.File != "":
+        exp, err = tracing.OpenFileExporter(cfg.File)
+    case cfg.Endpoint != "":
+        var client *http.Client
+        if cfg.Tunnel != "" {
+            client = kms.NewTunnelClient(transport.VSock, cfg.Tunnel)
+        }
+        exp, err = tracing.NewOTLPExporter(ctx, cfg.Endpoint, client)
+    default:
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return tracing.NewProvider(cfg.ServiceName, exp), nil
 }
 
 func main() {
-    // Obtain the attestation document
-    attestationDoc, err := attest(nil, nil, nil)
+    cfg := config.DefaultServer()
+    if _, err := config.Load("server", os.Args[1:], cfg); err != nil {
+        if errors.Is(err, flag.ErrHelp) {
+            return
+        }
+        log.Fatalf("%v", err)
+    }
+
+    // Trace the startup and the calls, as children of the spans of the clients
+    provider, err := newTracerProvider(context.Background(), cfg.Tracing)
+    if err != nil {
+        log.Fatalf("Failed to set up tracing: %v", err)
+    }
+    var tp trace.TracerProvider = noop.NewTracerProvider()
+    if provider != nil {
+        tp = provider
+    }
+    startupCtx, startup := tp.Tracer(tracing.ScopeName).Start(context.Background(), "startup")
+
+    // Set up the attestation provider
+    att, err := attester.New(cfg.Attester)
+    if err != nil {
+        log.Fatalf("Failed to set up attester: %v", err)
+    }
+    if local, ok := att.(*attester.Local); ok {
+        log.Printf("Using the local development attester; documents will not verify against the AWS root")
+        if cfg.LocalRootOut != "" {
+            if err := os.WriteFile(cfg.LocalRootOut, local.RootPEM(), 0644); err != nil {
+                log.Fatalf("Failed to write development root certificate: %v", err)
+            }
+            log.Printf("Development root certificate written to %s", cfg.LocalRootOut)
+        }
+    }
+
+    // Record the RPCs, the connections and the attestation requests. The
+    // health probes use the unwrapped attester, so that they are not counted.
+    registry := prometheus.NewRegistry()
+    serverMetrics := metrics.NewServer(registry)
+    nsm := att
+    att = serverMetrics.Attester(att)
+
+    // Obtain an attestation document at startup to check that the attester is usable
+    attestationDoc, err := attester.AttestContext(startupCtx, att, nil, nil, nil)
     if err != nil {
         log.Fatalf("Failed to obtain attestation document: %v", err)
     }
 
     log.Printf("Attestation Document (base64): %v\n", base64.StdEncoding.EncodeToString(attestationDoc))
 
-    // Create a vsock listener
-    listener, err := vsock.Listen(uint32(port), &vsock.Config{})
-    if err != nil {
-        log.Fatalf("failed to listen: %v", err)
+    // Server reflection exposes the API of the server, only allow it in debug-mode enclaves
+    if cfg.Reflection {
+        doc, err := attestation.Parse(attestationDoc)
+        if err != nil {
+            log.Fatalf("Failed to parse attestation document: %v", err)
+        }
+        if !doc.DebugMode() {
+            log.Fatalf("Server reflection is only allowed in debug-mode enclaves")
+        }
     }
-    s := grpc.NewServer()
-    // Pass the attestation document to the server implementation
-    pb.RegisterEchoServiceServer(s, &server{attestationDocument: attestationDoc})
-    log.Printf("Server listening on vsock port %d", port)
-    if err := s.Serve(listener); err != nil {
-        log.Fatalf("failed to serve: %v", err)
+
+    // Self-test of the KMS attestation: decrypt a data key, which KMS only
+    // releases to this enclave, and discard it. The server has no use for the
+    // key yet, so it is zeroed right away rather than kept in memory.
+    if cfg.KMS.Ciphertext != "" {
+        ciphertext, err := base64.StdEncoding.DecodeString(cfg.KMS.Ciphertext)
+        if err != nil {
+            log.Fatalf("Invalid KMS ciphertext: %v", err)
+        }
+        client := &kms.Client{Endpoint: cfg.KMS.Endpoint, Region: cfg.KMS.Region, Attester: att}
+        if client.Endpoint == "" {
+            client.Endpoint = "https://kms." + cfg.KMS.Region + ".amazonaws.com"
+        }
+        if cfg.KMS.Tunnel != "" {
+            client.HTTPClient = kms.NewTunnelClient(transport.VSock, cfg.KMS.Tunnel)
+        }
+        if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+            client.Credentials = &kms.Credentials{
+                AccessKeyID:     id,
+                SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+                SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+            }
+        }
+        ctx, cancel := context.WithTimeout(startupCtx, cfg.StartupTimeout)
+        dataKey, err := client.Decrypt(ctx, ciphertext, "", nil)
+        cancel()
+        if err != nil {
+            log.Fatalf("KMS self-test failed to decrypt the data key: %v", err)
+        }
+        log.Printf("KMS self-test passed: decrypted a %d-byte data key", len(dataKey))
+        clear(dataKey)
+    }
+
+    // Restore the state of the previous run from sealed storage on the parent
+    var store *sealed.Store
+    if cfg.Sealed.Enabled() {
+        keyConn, err := dialParent(cfg.Transport, cfg.Sealed.KeyRelease)
+        if err != nil {
+            log.Fatalf("Failed to connect to key release service: %v", err)
+        }
+        blobConn, err := dialParent(cfg.Transport, cfg.Sealed.BlobStore)
+        if err != nil {
+            log.Fatalf("Failed to connect to blob store: %v", err)
+        }
+        ctx, cancel := context.WithTimeout(startupCtx, cfg.StartupTimeout)
+        store, err = sealed.Open(ctx, keypb.NewKeyReleaseServiceClient(keyConn), cfg.Sealed.Key, blobpb.NewBlobStoreClient(blobConn), att)
+        if err != nil {
+            log.Fatalf("Failed to open sealed storage: %v", err)
+        }
+        state, err := restoreState(ctx, store)
+        cancel()
+        if err != nil {
+            log.Fatalf("Failed to restore sealed state: %v", err)
+        }
+        log.Printf("Boot %d since %v", state.Boots, state.FirstBoot)
     }
-}
 
-// Uses AWS NSM to obtain an attestation document
-func attest(nonce, userData, publicKey []byte) ([]byte, error) {
-    sess, err := nsm.OpenDefaultSession()
+    // Set up the response signing key, which stays the same across restarts with sealed storage
+    ctx, cancel := context.WithTimeout(startupCtx, cfg.StartupTimeout)
+    signer, err := loadSigningKey(ctx, store)
+    cancel()
     if err != nil {
-        return nil, err
+        log.Fatalf("Failed to set up signing key: %v", err)
     }
-    defer sess.Close()
+    log.Printf("Response signing key (base64): %v", base64.StdEncoding.EncodeToString(signer.PublicKey()))
+    startup.End()
 
-    res, err := sess.Send(&request.Attestation{
-        Nonce:     nonce,
-        UserData:  userData,
-        PublicKey: publicKey,
+    // Create the listener
+    listener, err := transport.Listen(cfg.Transport, cfg.Listen)
+    if err != nil {
+        log.Fatalf("failed to listen: %v", err)
+    }
+
+    // Serve TLS with an ephemeral key whose public half is bound into an attestation document
+    creds, err := ratls.NewServerCredentials(func(publicKey []byte) ([]byte, error) {
+        return att.Attest(nil, nil, publicKey)
     })
     if err != nil {
-        return nil, err
+        log.Fatalf("failed to create attested TLS credentials: %v", err)
+    }
+    serverOpts := []grpc.ServerOption{grpc.Creds(creds), grpc.StatsHandler(serverMetrics)}
+    if provider != nil {
+        serverOpts = append(serverOpts, grpc.StatsHandler(tracing.ServerHandler(provider)))
+    }
+    s := grpc.NewServer(serverOpts...)
+    pb.RegisterEchoServiceServer(s, service.NewEcho(att, signer))
+    attestationService := service.NewAttestation(att, cfg.Attestation.Rate, cfg.Attestation.Burst)
+    attestationService.AllowPublicKey = cfg.Attestation.AllowPublicKey
+    if cfg.Attestation.AllowPublicKey {
+        log.Printf("GetAttestation binds caller public keys; do not use with KMS recipients or key release")
+    }
+    attpb.RegisterAttestationServiceServer(s, attestationService)
+
+    // Report the health of the server from the NSM and the listener state
+    health := service.NewHealth(nsm, pb.EchoService_ServiceDesc.ServiceName, attpb.AttestationService_ServiceDesc.ServiceName)
+    healthpb.RegisterHealthServer(s, health)
+    healthCtx, stopHealth := context.WithCancel(context.Background())
+    go health.Run(healthCtx, cfg.Health.Interval)
+    if cfg.Reflection {
+        reflection.Register(s)
+        log.Printf("Server reflection enabled")
     }
 
-    if res.Error != "" {
-        return nil, fmt.Errorf("NSM error: %s", res.Error)
+    // Serve the metrics over HTTP on a dedicated port, which the parent
+    // instance exposes with vsock-proxy
+    var metricsServer *http.Server
+    if cfg.Metrics.Listen != "" {
+        metricsListener, err := transport.Listen(cfg.Transport, cfg.Metrics.Listen)
+        if err != nil {
+            log.Fatalf("failed to listen for metrics: %v", err)
+        }
+        mux := http.NewServeMux()
+        mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+        metricsServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+        go func() {
+            if err := metricsServer.Serve(metricsListener); !errors.Is(err, http.ErrServerClosed) {
+                log.Printf("Metrics server failed: %v", err)
+            }
+        }()
+        log.Printf("Metrics served on %s %s", cfg.Transport, cfg.Metrics.Listen)
     }
 
-    if res.Attestation == nil || res.Attestation.Document == nil {
-        return nil, fmt.Errorf("NSM device did not return an attestation")
+    // Shut down gracefully on SIGTERM or SIGINT: report NOT_SERVING first, then
+    // stop accepting connections and drain the in-flight calls
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+    stopped := make(chan struct{})
+    go func() {
+        defer close(stopped)
+        <-ctx.Done()
+        log.Printf("Shutting down, reporting NOT_SERVING")
+        stopHealth()
+        health.Shutdown()
+        time.Sleep(cfg.Shutdown.Delay)
+
+        log.Printf("Draining in-flight calls for up to %v", cfg.Shutdown.DrainTimeout)
+        timer := time.AfterFunc(cfg.Shutdown.DrainTimeout, func() {
+            log.Printf("Drain timeout expired, closing remaining connections")
+            s.Stop()
+        })
+        defer timer.Stop()
+        s.GracefulStop()
+    }()
+
+    // The listener is reported healthy once Serve accepts on it, and again
+    // NOT_SERVING as soon as accepting fails or Serve closes it
+    log.Printf("Server listening on %s %s", cfg.Transport, cfg.Listen)
+    err = s.Serve(health.Listener(listener))
+    if err != nil {
+        log.Fatalf("failed to serve: %v", err)
+    }
+    <-stopped
+    if metricsServer != nil {
+        metricsServer.Close()
+    }
+    if provider != nil {
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        if err := provider.Shutdown(shutdownCtx); err != nil {
+            log.Printf("Failed to export the last spans: %v", err)
+        }
+        cancel()
     }
 
-    return res.Attestation.Document, nil
+    // Close the NSM session once no call uses it anymore
+    if closer, ok := att.(io.Closer); ok {
+        if err := closer.Close(); err != nil {
+            log.Printf("Failed to close NSM session: %v", err)
+        }
+    }
+    log.Printf("Server stopped")
 }
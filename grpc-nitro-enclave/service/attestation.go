@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+	attpb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/attestation"
+)
+
+// Limits for the fields of a GetAttestation request. The user data is hashed
+// into the user_data field of the document; the public key, if allowed, is
+// bound as is, within the NSM limit.
+const (
+	MaxUserDataSize  = 512
+	MaxPublicKeySize = 1024
+)
+
+// Defaults for the rate limit of GetAttestation.
+const (
+	DefaultAttestationRate  = 10 // documents per second
+	DefaultAttestationBurst = 20
+)
+
+// Attestation implements AttestationService: it obtains attestation documents
+// from the attester with the caller's fields. The user_data field of the
+// documents is attestation.OnDemandUserData of the caller's user data, so that
+// they cannot pass for the documents the enclave binds its own keys with.
+// Calls are rate-limited across all clients to protect the NSM.
+type Attestation struct {
+	attpb.UnimplementedAttestationServiceServer
+
+	// AllowPublicKey lets callers bind a public key of their choosing into
+	// the documents. It is off by default and unsafe if the enclave's PCRs
+	// guard anything released to the public key of a document: AWS KMS
+	// encrypts the responses of Decrypt and GenerateDataKey to the public key
+	// of the Recipient document after checking only its PCRs, so any caller
+	// could obtain the data keys of the enclave.
+	AllowPublicKey bool
+
+	attester attester.Attester
+	limiter  *limiter
+}
+
+// NewAttestation returns an AttestationService that obtains attestation
+// documents from att, at most rate per second with bursts of burst documents.
+// If rate is not positive, calls are not limited.
+func NewAttestation(att attester.Attester, rate float64, burst int) *Attestation {
+	s := &Attestation{attester: att}
+	if rate > 0 {
+		s.limiter = newLimiter(rate, burst)
+	}
+	return s
+}
+
+func (s *Attestation) GetAttestation(ctx context.Context, in *attpb.GetAttestationRequest) (*attpb.GetAttestationResponse, error) {
+	if len(in.GetNonce()) > MaxNonceSize {
+		return nil, status.Errorf(codes.InvalidArgument, "nonce must be at most %d bytes, got %d", MaxNonceSize, len(in.GetNonce()))
+	}
+	if len(in.GetUserData()) > MaxUserDataSize {
+		return nil, status.Errorf(codes.InvalidArgument, "user data must be at most %d bytes, got %d", MaxUserDataSize, len(in.GetUserData()))
+	}
+	if len(in.GetPublicKey()) > MaxPublicKeySize {
+		return nil, status.Errorf(codes.InvalidArgument, "public key must be at most %d bytes, got %d", MaxPublicKeySize, len(in.GetPublicKey()))
+	}
+	if len(in.GetPublicKey()) > 0 && !s.AllowPublicKey {
+		return nil, status.Error(codes.PermissionDenied, "public key binding is disabled on this server")
+	}
+
+	// Only valid requests count against the rate limit
+	if s.limiter != nil && !s.limiter.allow() {
+		return nil, status.Error(codes.ResourceExhausted, "attestation rate limit exceeded")
+	}
+
+	attestationDoc, err := attester.AttestContext(ctx, s.attester, in.GetNonce(), attestation.OnDemandUserData(in.GetUserData()), in.GetPublicKey())
+	if err != nil {
+		log.Printf("Failed to obtain attestation document: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to obtain attestation document: %v", err)
+	}
+	return &attpb.GetAttestationResponse{AttestationDocument: attestationDoc}, nil
+}
+
+// limiter is a token bucket allowing rate events per second on average, with
+// bursts of up to burst events.
+type limiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow reports whether an event may happen now, and consumes a token if so.
+func (l *limiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
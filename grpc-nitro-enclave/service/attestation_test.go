@@ -0,0 +1,192 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/keyrelease"
+	attpb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/attestation"
+	krpb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto/keyrelease"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/ratls"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+)
+
+func startAttestationServer(t *testing.T, rate float64, burst int, allowPublicKey bool) (*attestertest.NSM, attpb.AttestationServiceClient) {
+	t.Helper()
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	srv := service.NewAttestation(nsm, rate, burst)
+	srv.AllowPublicKey = allowPublicKey
+	attpb.RegisterAttestationServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return nsm, attpb.NewAttestationServiceClient(conn)
+}
+
+func TestGetAttestation(t *testing.T) {
+	nsm, c := startAttestationServer(t, 0, 0, true)
+	req := &attpb.GetAttestationRequest{
+		Nonce:     []byte("nonce"),
+		UserData:  []byte("user data"),
+		PublicKey: []byte("public key"),
+	}
+	r, err := c.GetAttestation(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GetAttestation: %v", err)
+	}
+	doc, err := attestation.Verify(r.GetAttestationDocument(), attestation.VerifyOptions{
+		Roots:         nsm.CA.Roots(),
+		Nonce:         req.Nonce,
+		UserData:      attestation.OnDemandUserData(req.UserData),
+		AllowOnDemand: true,
+	})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !bytes.Equal(doc.PublicKey, req.PublicKey) {
+		t.Errorf("public key = %q, want %q", doc.PublicKey, req.PublicKey)
+	}
+}
+
+// TestGetAttestationNotTrusted checks that the documents handed out on demand,
+// which bind a key of the caller if allowed, are not accepted as binding a key
+// of the enclave.
+func TestGetAttestationNotTrusted(t *testing.T) {
+	nsm, c := startAttestationServer(t, 0, 0, true)
+
+	t.Run("ratls", func(t *testing.T) {
+		tlsCert, err := ratls.NewCertificate(func(publicKey []byte) ([]byte, error) {
+			r, err := c.GetAttestation(context.Background(), &attpb.GetAttestationRequest{PublicKey: publicKey})
+			return r.GetAttestationDocument(), err
+		})
+		if err != nil {
+			t.Fatalf("NewCertificate: %v", err)
+		}
+		cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+		if err != nil {
+			t.Fatalf("ParseCertificate: %v", err)
+		}
+		_, err = ratls.VerifyCertificate(cert, attestation.VerifyOptions{Roots: nsm.CA.Roots()})
+		if !errors.Is(err, attestation.ErrOnDemand) {
+			t.Fatalf("VerifyCertificate error = %v, want %v", err, attestation.ErrOnDemand)
+		}
+	})
+
+	t.Run("keyrelease", func(t *testing.T) {
+		srv, err := keyrelease.NewServer(keyrelease.Options{
+			Secrets: map[string][]byte{"db": []byte("database password")},
+			Verify: attestation.VerifyOptions{
+				Roots:  nsm.CA.Roots(),
+				Policy: &attestation.PCRPolicy{Allowed: []attestation.Measurements{{0: nsm.PCRs[0]}}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewServer: %v", err)
+		}
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		challenge, err := srv.GetChallenge(context.Background(), &krpb.ChallengeRequest{})
+		if err != nil {
+			t.Fatalf("GetChallenge: %v", err)
+		}
+		r, err := c.GetAttestation(context.Background(), &attpb.GetAttestationRequest{Nonce: challenge.GetNonce(), PublicKey: publicKey})
+		if err != nil {
+			t.Fatalf("GetAttestation: %v", err)
+		}
+		_, err = srv.ReleaseSecret(context.Background(), &krpb.ReleaseSecretRequest{SecretId: "db", AttestationDocument: r.GetAttestationDocument()})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("ReleaseSecret error = %v, want code %v", err, codes.PermissionDenied)
+		}
+	})
+}
+
+func TestGetAttestationPublicKeyDisabled(t *testing.T) {
+	_, c := startAttestationServer(t, 0, 0, false)
+	_, err := c.GetAttestation(context.Background(), &attpb.GetAttestationRequest{PublicKey: []byte("public key")})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("GetAttestation error = %v, want code %v", err, codes.PermissionDenied)
+	}
+	if _, err := c.GetAttestation(context.Background(), &attpb.GetAttestationRequest{Nonce: []byte("nonce")}); err != nil {
+		t.Fatalf("GetAttestation without public key: %v", err)
+	}
+}
+
+func TestGetAttestationRejects(t *testing.T) {
+	_, c := startAttestationServer(t, 0, 0, true)
+	tests := []struct {
+		name string
+		req  *attpb.GetAttestationRequest
+	}{
+		{"nonce", &attpb.GetAttestationRequest{Nonce: make([]byte, service.MaxNonceSize+1)}},
+		{"user data", &attpb.GetAttestationRequest{UserData: make([]byte, service.MaxUserDataSize+1)}},
+		{"public key", &attpb.GetAttestationRequest{PublicKey: make([]byte, service.MaxPublicKeySize+1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.GetAttestation(context.Background(), tt.req)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("GetAttestation error = %v, want code %v", err, codes.InvalidArgument)
+			}
+		})
+	}
+}
+
+func TestGetAttestationRateLimit(t *testing.T) {
+	_, c := startAttestationServer(t, 0.001, 2, false)
+
+	// Invalid requests do not use up the limit
+	for _, req := range []*attpb.GetAttestationRequest{
+		{Nonce: make([]byte, service.MaxNonceSize+1)},
+		{PublicKey: []byte("public key")},
+	} {
+		if _, err := c.GetAttestation(context.Background(), req); err == nil || status.Code(err) == codes.ResourceExhausted {
+			t.Fatalf("GetAttestation of an invalid request error = %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetAttestation(context.Background(), &attpb.GetAttestationRequest{}); err != nil {
+			t.Fatalf("GetAttestation %d: %v", i, err)
+		}
+	}
+	_, err := c.GetAttestation(context.Background(), &attpb.GetAttestationRequest{})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("GetAttestation error = %v, want code %v", err, codes.ResourceExhausted)
+	}
+}
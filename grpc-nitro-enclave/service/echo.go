@@ -0,0 +1,103 @@
+// Package service implements the gRPC services of the enclave server.
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/signing"
+)
+
+// MaxNonceSize is the NSM limit for the nonce field of an attestation document.
+const MaxNonceSize = 512
+
+// Echo implements EchoService. Every response carries a fresh attestation
+// document binding the client nonce and the SHA-256 hash of the response message,
+// unless the client asks to skip it, and is signed by the enclave signing key.
+type Echo struct {
+	pb.UnimplementedEchoServiceServer
+	attester attester.Attester
+	signer   *signing.Signer
+}
+
+// NewEcho returns an EchoService that obtains attestation documents from att
+// and signs responses with signer. If signer is nil, responses are not signed.
+func NewEcho(att attester.Attester, signer *signing.Signer) *Echo {
+	return &Echo{attester: att, signer: signer}
+}
+
+// HashEchoRequest returns the request hash covered by the signature of the
+// response to in.
+func HashEchoRequest(in *pb.EchoRequest) []byte {
+	return signing.HashRequest([]byte(in.GetMessage()), in.GetNonce())
+}
+
+func checkNonce(nonce []byte) error {
+	if len(nonce) == 0 || len(nonce) > MaxNonceSize {
+		return status.Errorf(codes.InvalidArgument, "nonce must be between 1 and %d bytes, got %d", MaxNonceSize, len(nonce))
+	}
+	return nil
+}
+
+func (s *Echo) Echo(ctx context.Context, in *pb.EchoRequest) (*pb.EchoResponse, error) {
+	log.Printf("Received: %v", in.GetMessage())
+
+	if err := checkNonce(in.GetNonce()); err != nil {
+		return nil, err
+	}
+	if in.GetSkipAttestation() && s.signer == nil {
+		return nil, status.Error(codes.FailedPrecondition, "responses are not signed, an attestation document is required")
+	}
+
+	message := "Echo: " + in.GetMessage()
+	resp := &pb.EchoResponse{Message: message}
+
+	// Request a fresh attestation document binding the client nonce and a hash of the response message
+	if !in.GetSkipAttestation() {
+		userData := sha256.Sum256([]byte(message))
+		attestationDoc, err := attester.AttestContext(ctx, s.attester, in.GetNonce(), userData[:], nil)
+		if err != nil {
+			log.Printf("Failed to obtain attestation document: %v", err)
+			return nil, status.Errorf(codes.Internal, "failed to obtain attestation document: %v", err)
+		}
+		resp.AttestationDocument = attestationDoc
+	}
+
+	// Sign the response message together with a hash of the request
+	if s.signer != nil {
+		counter, sig, err := s.signer.Sign(HashEchoRequest(in), []byte(message))
+		if err != nil {
+			log.Printf("Failed to sign response: %v", err)
+			return nil, status.Errorf(codes.Internal, "failed to sign response: %v", err)
+		}
+		resp.Signature = &pb.ResponseSignature{Counter: counter, Signature: sig}
+	}
+
+	return resp, nil
+}
+
+func (s *Echo) GetSigningKey(ctx context.Context, in *pb.SigningKeyRequest) (*pb.SigningKeyResponse, error) {
+	if s.signer == nil {
+		return nil, status.Error(codes.Unimplemented, "responses are not signed")
+	}
+	if err := checkNonce(in.GetNonce()); err != nil {
+		return nil, err
+	}
+
+	// Bind the signing key and the client nonce into an attestation document
+	attestationDoc, err := attester.AttestContext(ctx, s.attester, in.GetNonce(), nil, s.signer.PublicKey())
+	if err != nil {
+		log.Printf("Failed to obtain attestation document: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to obtain attestation document: %v", err)
+	}
+	return &pb.SigningKeyResponse{
+		PublicKey:           s.signer.PublicKey(),
+		AttestationDocument: attestationDoc,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/ratls"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+)
+
+// startServer serves EchoService over RA-TLS on an in-memory listener and
+// returns the mock NSM backing it.
+func startServer(t *testing.T) (*attestertest.NSM, *bufconn.Listener) {
+	t.Helper()
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	creds, err := ratls.NewServerCredentials(func(publicKey []byte) ([]byte, error) {
+		return nsm.Attest(nil, nil, publicKey)
+	})
+	if err != nil {
+		t.Fatalf("NewServerCredentials: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.Creds(creds))
+	pb.RegisterEchoServiceServer(s, service.NewEcho(nsm, nil))
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return nsm, lis
+}
+
+func dial(t *testing.T, lis *bufconn.Listener, creds credentials.TransportCredentials) pb.EchoServiceClient {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(creds),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewEchoServiceClient(conn)
+}
+
+func TestEcho(t *testing.T) {
+	nsm, lis := startServer(t)
+	policy := &attestation.PCRPolicy{Allowed: []attestation.Measurements{{0: nsm.PCRs[0]}}}
+	c := dial(t, lis, ratls.NewClientCredentials(attestation.VerifyOptions{Roots: nsm.CA.Roots(), Policy: policy}))
+
+	nonce := []byte("0123456789abcdef0123456789abcdef")
+	r, err := c.Echo(context.Background(), &pb.EchoRequest{Message: "hello", Nonce: nonce})
+	if err != nil {
+		t.Fatalf("Echo: %v", err)
+	}
+	if r.GetMessage() != "Echo: hello" {
+		t.Errorf("Message = %q, want %q", r.GetMessage(), "Echo: hello")
+	}
+
+	userData := sha256.Sum256([]byte(r.GetMessage()))
+	if _, err := attestation.Verify(r.GetAttestationDocument(), attestation.VerifyOptions{
+		Roots:    nsm.CA.Roots(),
+		Nonce:    nonce,
+		UserData: userData[:],
+		Policy:   policy,
+	}); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}
+
+func TestEchoRequiresNonce(t *testing.T) {
+	nsm, lis := startServer(t)
+	c := dial(t, lis, ratls.NewClientCredentials(attestation.VerifyOptions{Roots: nsm.CA.Roots()}))
+
+	_, err := c.Echo(context.Background(), &pb.EchoRequest{Message: "hello"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Echo error = %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestEchoRejectsUnexpectedEnclave(t *testing.T) {
+	nsm, lis := startServer(t)
+	policy := &attestation.PCRPolicy{Allowed: []attestation.Measurements{{0: bytes.Repeat([]byte{0xff}, 48)}}}
+	c := dial(t, lis, ratls.NewClientCredentials(attestation.VerifyOptions{Roots: nsm.CA.Roots(), Policy: policy}))
+
+	_, err := c.Echo(context.Background(), &pb.EchoRequest{Message: "hello", Nonce: []byte("nonce")})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Echo error = %v, want code %v", err, codes.Unavailable)
+	}
+}
+
+func TestEchoUnsigned(t *testing.T) {
+	nsm, lis := startServer(t)
+	c := dial(t, lis, ratls.NewClientCredentials(attestation.VerifyOptions{Roots: nsm.CA.Roots()}))
+
+	_, err := c.Echo(context.Background(), &pb.EchoRequest{Message: "hello", Nonce: []byte("nonce"), SkipAttestation: true})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Echo error = %v, want code %v", err, codes.FailedPrecondition)
+	}
+	_, err = c.GetSigningKey(context.Background(), &pb.SigningKeyRequest{Nonce: []byte("nonce")})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("GetSigningKey error = %v, want code %v", err, codes.Unimplemented)
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+)
+
+// DefaultHealthInterval is the default interval between two probes of the NSM.
+const DefaultHealthInterval = 10 * time.Second
+
+// Health implements grpc.health.v1 for the enclave server. The server and its
+// services are reported as SERVING while the listener accepts connections
+// and the last attestation probe of the NSM succeeded, and NOT_SERVING
+// otherwise.
+type Health struct {
+	*health.Server
+	attester attester.Attester
+	services []string
+
+	mu        sync.Mutex
+	listening bool
+	nsmOK     bool
+}
+
+// NewHealth returns a Health probing att and reporting the status of the
+// server ("") and of the named services. All of them are NOT_SERVING until the
+// listener is up and the NSM was probed. att should not record metrics, so
+// that the probes are not counted as attestation requests.
+func NewHealth(att attester.Attester, services ...string) *Health {
+	h := &Health{Server: health.NewServer(), attester: att, services: append([]string{""}, services...)}
+	h.update()
+	return h
+}
+
+// SetListening records whether the listener accepts connections.
+func (h *Health) SetListening(listening bool) {
+	h.mu.Lock()
+	h.listening = listening
+	h.mu.Unlock()
+	h.update()
+}
+
+// Listener returns l reporting the listener state to h: listening from the
+// first call to Accept, which grpc.Server.Serve makes once it serves l, until
+// Accept fails, and again from the next call, or until l is closed, as Serve
+// does before returning.
+func (h *Health) Listener(l net.Listener) net.Listener {
+	return &healthListener{Listener: l, health: h}
+}
+
+type healthListener struct {
+	net.Listener
+	health    *Health
+	accepting atomic.Bool
+}
+
+func (l *healthListener) Accept() (net.Conn, error) {
+	if l.accepting.CompareAndSwap(false, true) {
+		l.health.SetListening(true)
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		l.accepting.Store(false)
+		l.health.SetListening(false)
+	}
+	return conn, err
+}
+
+func (l *healthListener) Close() error {
+	l.health.SetListening(false)
+	return l.Listener.Close()
+}
+
+// Probe requests an attestation document from the NSM and records whether it
+// is available.
+func (h *Health) Probe() {
+	_, err := h.attester.Attest(nil, nil, nil)
+	if err != nil {
+		log.Printf("Health probe: NSM unavailable: %v", err)
+	}
+	h.mu.Lock()
+	h.nsmOK = err == nil
+	h.mu.Unlock()
+	h.update()
+}
+
+// Run probes the NSM every interval until ctx is done.
+func (h *Health) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+	h.Probe()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.Probe()
+		}
+	}
+}
+
+func (h *Health) update() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if h.listening && h.nsmOK {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	for _, name := range h.services {
+		h.SetServingStatus(name, status)
+	}
+}
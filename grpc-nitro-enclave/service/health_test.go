@@ -0,0 +1,123 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+)
+
+// flakyNSM fails to attest while down is set.
+type flakyNSM struct {
+	*attestertest.NSM
+	down atomic.Bool
+}
+
+func (n *flakyNSM) Attest(nonce, userData, publicKey []byte) ([]byte, error) {
+	if n.down.Load() {
+		return nil, errors.New("nsm: device unavailable")
+	}
+	return n.NSM.Attest(nonce, userData, publicKey)
+}
+
+func TestHealth(t *testing.T) {
+	mock, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	nsm := &flakyNSM{NSM: mock}
+	h := service.NewHealth(nsm, pb.EchoService_ServiceDesc.ServiceName)
+
+	check := func(step string, want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		for _, name := range []string{"", pb.EchoService_ServiceDesc.ServiceName} {
+			r, err := h.Check(context.Background(), &healthpb.HealthCheckRequest{Service: name})
+			if err != nil {
+				t.Fatalf("%s: Check(%q): %v", step, name, err)
+			}
+			if r.GetStatus() != want {
+				t.Errorf("%s: Check(%q) = %v, want %v", step, name, r.GetStatus(), want)
+			}
+		}
+	}
+
+	check("initial", healthpb.HealthCheckResponse_NOT_SERVING)
+	h.Probe()
+	check("NSM probed", healthpb.HealthCheckResponse_NOT_SERVING)
+	h.SetListening(true)
+	check("listening", healthpb.HealthCheckResponse_SERVING)
+	nsm.down.Store(true)
+	h.Probe()
+	check("NSM down", healthpb.HealthCheckResponse_NOT_SERVING)
+	nsm.down.Store(false)
+	h.Probe()
+	check("NSM back", healthpb.HealthCheckResponse_SERVING)
+	h.SetListening(false)
+	check("listener closed", healthpb.HealthCheckResponse_NOT_SERVING)
+	h.SetListening(true)
+	check("listener reopened", healthpb.HealthCheckResponse_SERVING)
+
+	// Once shut down, the services stay NOT_SERVING
+	h.Shutdown()
+	check("shutdown", healthpb.HealthCheckResponse_NOT_SERVING)
+	h.Probe()
+	check("probe after shutdown", healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+func TestHealthListener(t *testing.T) {
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	h := service.NewHealth(nsm)
+	h.Probe()
+
+	status := func() healthpb.HealthCheckResponse_ServingStatus {
+		r, err := h.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		return r.GetStatus()
+	}
+
+	// A listener that Serve has not started accepting on is not reported
+	lis := h.Listener(bufconn.Listen(1 << 16))
+	if got := status(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("before Serve: status = %v, want NOT_SERVING", got)
+	}
+
+	s := grpc.NewServer()
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(lis) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for status() != healthpb.HealthCheckResponse_SERVING {
+		if time.Now().After(deadline) {
+			t.Fatal("status did not become SERVING once serving")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Stop()
+	<-served
+	if got := status(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("after Stop: status = %v, want NOT_SERVING", got)
+	}
+
+	// When Serve fails, the listener does not stay SERVING
+	failing := bufconn.Listen(1 << 16)
+	failing.Close()
+	if err := grpc.NewServer().Serve(h.Listener(failing)); err == nil {
+		t.Fatal("Serve on a closed listener succeeded")
+	}
+	if got := status(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("after failed Serve: status = %v, want NOT_SERVING", got)
+	}
+}
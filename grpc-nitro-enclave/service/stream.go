@@ -0,0 +1,223 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/signing"
+)
+
+// Metadata keys of the stream attestation. Binary values are base64 encoded
+// on the wire by gRPC.
+const (
+	// NonceMetadataKey carries the client nonce in the request metadata.
+	NonceMetadataKey = "echo-nonce-bin"
+	// AttestationMetadataKey carries the attestation document of the stream
+	// in the header metadata of the response.
+	AttestationMetadataKey = "echo-attestation-bin"
+)
+
+// MaxStreamCount is the maximum number of responses to an EchoServerStream request.
+const MaxStreamCount = 100000
+
+// Limits of the messages of an EchoClientStream, which are held in enclave
+// memory until the client closes its side of the stream.
+const (
+	MaxClientStreamMessages = 10000
+	MaxClientStreamBytes    = 1 << 20
+)
+
+// StreamTranscript binds the messages of a stream to its attestation document.
+// It starts with the SHA-256 hash of the document and absorbs every request
+// received, with its sequence number. The response with sequence number n is
+// signed over the hash of the transcript and n, so a response cannot be moved
+// to another stream or position, nor answer other requests than those received.
+type StreamTranscript struct {
+	hash []byte
+}
+
+// NewStreamTranscript returns the transcript of a stream attested by doc.
+func NewStreamTranscript(doc []byte) *StreamTranscript {
+	h := sha256.Sum256(doc)
+	return &StreamTranscript{hash: h[:]}
+}
+
+func sequenceBytes(sequence uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], sequence)
+	return b[:]
+}
+
+// AddRequest absorbs the request in into the transcript.
+func (t *StreamTranscript) AddRequest(in *pb.EchoStreamRequest) {
+	t.hash = signing.HashRequest(t.hash, sequenceBytes(in.GetSequence()), []byte(in.GetMessage()), sequenceBytes(uint64(in.GetCount())))
+}
+
+// Clone returns a copy of the transcript.
+func (t *StreamTranscript) Clone() *StreamTranscript {
+	return &StreamTranscript{hash: t.hash}
+}
+
+// ResponseHash returns the request hash covered by the signature of the
+// response with the given sequence number.
+func (t *StreamTranscript) ResponseHash(sequence uint64) []byte {
+	return signing.HashRequest(t.hash, sequenceBytes(sequence))
+}
+
+// stream tracks the requests and responses of an attested stream.
+type stream struct {
+	transcript *StreamTranscript
+	signer     *signing.Signer
+	received   uint64
+	sent       uint64
+}
+
+// startStream attests the stream with the nonce of the request metadata and
+// sends the attestation document in the header metadata.
+func (s *Echo) startStream(ss grpc.ServerStream) (*stream, error) {
+	if s.signer == nil {
+		return nil, status.Error(codes.FailedPrecondition, "responses are not signed, streams are not available")
+	}
+	md, _ := metadata.FromIncomingContext(ss.Context())
+	var nonce []byte
+	if values := md.Get(NonceMetadataKey); len(values) == 1 {
+		nonce = []byte(values[0])
+	}
+	if err := checkNonce(nonce); err != nil {
+		return nil, err
+	}
+
+	// Bind the signing key and the client nonce into the attestation document of the stream
+	attestationDoc, err := attester.AttestContext(ss.Context(), s.attester, nonce, nil, s.signer.PublicKey())
+	if err != nil {
+		log.Printf("Failed to obtain attestation document: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to obtain attestation document: %v", err)
+	}
+	if err := ss.SendHeader(metadata.Pairs(AttestationMetadataKey, string(attestationDoc))); err != nil {
+		return nil, err
+	}
+	return &stream{transcript: NewStreamTranscript(attestationDoc), signer: s.signer}, nil
+}
+
+// receive checks the sequence number of in and absorbs it into the transcript.
+func (st *stream) receive(in *pb.EchoStreamRequest) error {
+	if in.GetSequence() != st.received+1 {
+		return status.Errorf(codes.InvalidArgument, "request sequence number %d, expected %d", in.GetSequence(), st.received+1)
+	}
+	st.received++
+	st.transcript.AddRequest(in)
+	return nil
+}
+
+// response returns the next signed response carrying message.
+func (st *stream) response(message string) (*pb.EchoStreamResponse, error) {
+	st.sent++
+	counter, sig, err := st.signer.Sign(st.transcript.ResponseHash(st.sent), []byte(message))
+	if err != nil {
+		log.Printf("Failed to sign response: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to sign response: %v", err)
+	}
+	return &pb.EchoStreamResponse{
+		Sequence:  st.sent,
+		Message:   message,
+		Signature: &pb.ResponseSignature{Counter: counter, Signature: sig},
+	}, nil
+}
+
+func (s *Echo) EchoServerStream(in *pb.EchoStreamRequest, ss pb.EchoService_EchoServerStreamServer) error {
+	st, err := s.startStream(ss)
+	if err != nil {
+		return err
+	}
+	if err := st.receive(in); err != nil {
+		return err
+	}
+	count := in.GetCount()
+	if count == 0 {
+		count = 1
+	}
+	if count > MaxStreamCount {
+		return status.Errorf(codes.InvalidArgument, "count must be at most %d, got %d", MaxStreamCount, count)
+	}
+
+	message := "Echo: " + in.GetMessage()
+	for i := uint32(0); i < count; i++ {
+		resp, err := st.response(message)
+		if err != nil {
+			return err
+		}
+		if err := ss.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Echo) EchoClientStream(ss pb.EchoService_EchoClientStreamServer) error {
+	st, err := s.startStream(ss)
+	if err != nil {
+		return err
+	}
+	var messages []string
+	size := 0
+	for {
+		in, err := ss.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := st.receive(in); err != nil {
+			return err
+		}
+		size += len(in.GetMessage())
+		if len(messages) >= MaxClientStreamMessages || size > MaxClientStreamBytes {
+			return status.Errorf(codes.ResourceExhausted, "client stream exceeds %d messages or %d bytes", MaxClientStreamMessages, MaxClientStreamBytes)
+		}
+		messages = append(messages, in.GetMessage())
+	}
+
+	resp, err := st.response("Echo: " + strings.Join(messages, " "))
+	if err != nil {
+		return err
+	}
+	return ss.SendAndClose(resp)
+}
+
+func (s *Echo) EchoBidiStream(ss pb.EchoService_EchoBidiStreamServer) error {
+	st, err := s.startStream(ss)
+	if err != nil {
+		return err
+	}
+	for {
+		in, err := ss.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := st.receive(in); err != nil {
+			return err
+		}
+		resp, err := st.response("Echo: " + in.GetMessage())
+		if err != nil {
+			return err
+		}
+		if err := ss.Send(resp); err != nil {
+			return err
+		}
+	}
+}
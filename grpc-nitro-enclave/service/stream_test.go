@@ -0,0 +1,125 @@
+package service_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/echoclient"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/signing"
+)
+
+// startStreamServer serves EchoService with a signing key, in plaintext, and
+// returns a connection to it.
+func startStreamServer(t *testing.T, signed bool) (*attestertest.NSM, *grpc.ClientConn) {
+	t.Helper()
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	var signer *signing.Signer
+	if signed {
+		key, err := signing.GenerateKey()
+		if err != nil {
+			t.Fatalf("GenerateKey: %v", err)
+		}
+		if signer, err = signing.NewSigner(key); err != nil {
+			t.Fatalf("NewSigner: %v", err)
+		}
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, service.NewEcho(nsm, signer))
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return nsm, conn
+}
+
+func TestStreamRequiresNonce(t *testing.T) {
+	_, conn := startStreamServer(t, true)
+	stream, err := pb.NewEchoServiceClient(conn).EchoBidiStream(context.Background())
+	if err != nil {
+		t.Fatalf("EchoBidiStream: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Recv error = %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestStreamRejectsOutOfSequence(t *testing.T) {
+	_, conn := startStreamServer(t, true)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), service.NonceMetadataKey, "nonce")
+	stream, err := pb.NewEchoServiceClient(conn).EchoBidiStream(ctx)
+	if err != nil {
+		t.Fatalf("EchoBidiStream: %v", err)
+	}
+	if err := stream.Send(&pb.EchoStreamRequest{Sequence: 2, Message: "hello"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Recv error = %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestStreamRequiresSigner(t *testing.T) {
+	nsm, conn := startStreamServer(t, false)
+	c := echoclient.New(conn, attestation.VerifyOptions{Roots: nsm.CA.Roots()})
+	_, err := c.EchoClientStream(context.Background(), []string{"hello"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("EchoClientStream error = %v, want code %v", err, codes.FailedPrecondition)
+	}
+}
+
+func TestClientStreamLimits(t *testing.T) {
+	_, conn := startStreamServer(t, true)
+	tests := []struct {
+		name    string
+		count   int
+		message string
+	}{
+		{"messages", service.MaxClientStreamMessages + 1, "hi"},
+		{"bytes", service.MaxClientStreamBytes/(64<<10) + 1, strings.Repeat("x", 64<<10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), service.NonceMetadataKey, "nonce")
+			stream, err := pb.NewEchoServiceClient(conn).EchoClientStream(ctx)
+			if err != nil {
+				t.Fatalf("EchoClientStream: %v", err)
+			}
+			for i := 1; i <= tt.count; i++ {
+				// Send fails once the server has ended the stream
+				if err := stream.Send(&pb.EchoStreamRequest{Sequence: uint64(i), Message: tt.message}); err != nil {
+					break
+				}
+			}
+			if _, err := stream.CloseAndRecv(); status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("CloseAndRecv error = %v, want code %v", err, codes.ResourceExhausted)
+			}
+		})
+	}
+}
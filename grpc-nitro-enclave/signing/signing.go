@@ -0,0 +1,201 @@
+// Package signing signs enclave responses with a stable, attested key.
+//
+// The enclave holds an ECDSA P-256 signing key and binds its public key into
+// an attestation document once. Every response is then signed over a hash of
+// the request it answers, a counter and the response payload, so that a client
+// which verified the attestation of the key once can verify later responses
+// without a new attestation document per call.
+//
+// The signed digest is
+//
+//	SHA-256(Domain || request hash || counter (8 bytes, big endian) || payload)
+//
+// where the request hash is computed with HashRequest over the request fields
+// and is always 32 bytes long. A response cannot be replayed because the
+// request hash binds a fresh nonce of the client, or the transcript of a
+// stream. The counter is shared by all the clients of the signer, so it
+// orders the signatures but is not checked by Verifier.
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+)
+
+// Domain separates response signatures from other uses of the key.
+const Domain = "nitro-example response signature v1\x00"
+
+// ErrSignature is returned by Verify if the signature does not verify.
+var ErrSignature = errors.New("signing: invalid response signature")
+
+// HashRequest returns the SHA-256 hash of the length-prefixed request fields.
+func HashRequest(fields ...[]byte) []byte {
+	h := sha256.New()
+	var n [8]byte
+	for _, f := range fields {
+		binary.BigEndian.PutUint64(n[:], uint64(len(f)))
+		h.Write(n[:])
+		h.Write(f)
+	}
+	return h.Sum(nil)
+}
+
+// digest returns the digest signed for a response.
+func digest(requestHash []byte, counter uint64, payload []byte) ([]byte, error) {
+	if len(requestHash) != sha256.Size {
+		return nil, fmt.Errorf("signing: request hash must be %d bytes, got %d", sha256.Size, len(requestHash))
+	}
+	h := sha256.New()
+	h.Write([]byte(Domain))
+	h.Write(requestHash)
+	var c [8]byte
+	binary.BigEndian.PutUint64(c[:], counter)
+	h.Write(c[:])
+	h.Write(payload)
+	return h.Sum(nil), nil
+}
+
+// GenerateKey generates a new ECDSA P-256 signing key.
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// MarshalKey encodes key in SEC 1 DER form, e.g. to keep it in sealed storage.
+func MarshalKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	return x509.MarshalECPrivateKey(key)
+}
+
+// ParseKey decodes a key encoded by MarshalKey.
+func ParseKey(der []byte) (*ecdsa.PrivateKey, error) {
+	key, err := x509.ParseECPrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("signing: invalid key: %w", err)
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("signing: key is not a P-256 key")
+	}
+	return key, nil
+}
+
+// Signer signs responses. It is safe for concurrent use.
+type Signer struct {
+	key       *ecdsa.PrivateKey
+	publicKey []byte
+	counter   atomic.Uint64
+}
+
+// NewSigner returns a Signer using key. The counter starts at the current time
+// in nanoseconds, so that it keeps increasing across restarts when the key is
+// persisted.
+func NewSigner(key *ecdsa.PrivateKey) (*Signer, error) {
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	s := &Signer{key: key, publicKey: publicKey}
+	s.counter.Store(uint64(time.Now().UnixNano()))
+	return s, nil
+}
+
+// PublicKey returns the DER encoded PKIX public key of the signer, to be bound
+// into an attestation document.
+func (s *Signer) PublicKey() []byte {
+	return s.publicKey
+}
+
+// Sign signs payload as the response to the request with the given hash, and
+// returns the counter and the ASN.1 encoded signature.
+func (s *Signer) Sign(requestHash, payload []byte) (uint64, []byte, error) {
+	counter := s.counter.Add(1)
+	d, err := digest(requestHash, counter, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, d)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to sign response: %w", err)
+	}
+	return counter, sig, nil
+}
+
+// Verifier verifies the responses signed by an attested key. It is safe for
+// concurrent use.
+type Verifier struct {
+	key    *ecdsa.PublicKey
+	doc    *attestation.AttestationDocument
+	expiry time.Time
+}
+
+// NewVerifier verifies the attestation document doc with opts and returns a
+// Verifier for the signing key bound in its public_key field.
+func NewVerifier(doc []byte, opts attestation.VerifyOptions) (*Verifier, error) {
+	return NewVerifierContext(context.Background(), doc, opts)
+}
+
+// NewVerifierContext is like NewVerifier, and traces the verification of doc
+// as a child of the span of ctx, if any.
+func NewVerifierContext(ctx context.Context, doc []byte, opts attestation.VerifyOptions) (*Verifier, error) {
+	report := attestation.VerifyReportContext(ctx, doc, opts)
+	if !report.OK() {
+		return nil, report.Err
+	}
+	d := report.Document
+	if len(d.PublicKey) == 0 {
+		return nil, errors.New("signing: attestation document does not bind a signing key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(d.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("signing: invalid signing key: %w", err)
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("signing: signing key is a %T, expected an ECDSA P-256 key", pub)
+	}
+	return &Verifier{key: key, doc: d, expiry: report.Expiry()}, nil
+}
+
+// Document returns the verified attestation document of the signing key.
+func (v *Verifier) Document() *attestation.AttestationDocument {
+	return v.doc
+}
+
+// Expiry returns the time at which the certificate chain of the attestation
+// document expires. Clients should attest the signing key again by then.
+func (v *Verifier) Expiry() time.Time {
+	return v.expiry
+}
+
+// PublicKey returns the DER encoded PKIX public key of the signing key.
+func (v *Verifier) PublicKey() []byte {
+	return v.doc.PublicKey
+}
+
+// Matches reports whether publicKey is the signing key of the verifier.
+func (v *Verifier) Matches(publicKey []byte) bool {
+	return bytes.Equal(v.doc.PublicKey, publicKey)
+}
+
+// Verify checks that sig is a signature of payload with counter as the
+// response to the request with the given hash.
+func (v *Verifier) Verify(requestHash, payload []byte, counter uint64, sig []byte) error {
+	d, err := digest(requestHash, counter, payload)
+	if err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(v.key, d, sig) {
+		return ErrSignature
+	}
+	return nil
+}
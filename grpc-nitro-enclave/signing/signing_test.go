@@ -0,0 +1,128 @@
+package signing_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/signing"
+)
+
+// newPair returns a signer and a verifier of its attested key.
+func newPair(t *testing.T) (*signing.Signer, *signing.Verifier) {
+	t.Helper()
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	key, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	doc, err := nsm.Attest([]byte("nonce"), nil, s.PublicKey())
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+	v, err := signing.NewVerifier(doc, attestation.VerifyOptions{Roots: nsm.CA.Roots(), Nonce: []byte("nonce")})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	return s, v
+}
+
+func TestSignVerify(t *testing.T) {
+	s, v := newPair(t)
+	if !v.Matches(s.PublicKey()) {
+		t.Fatal("verifier does not match the signer key")
+	}
+	request := signing.HashRequest([]byte("hello"), []byte("nonce"))
+	counter, sig, err := s.Sign(request, []byte("Echo: hello"))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		request []byte
+		payload string
+		counter uint64
+		want    error
+	}{
+		{"other payload", request, "Echo: bye", counter, signing.ErrSignature},
+		{"other request", signing.HashRequest([]byte("hello"), []byte("other")), "Echo: hello", counter, signing.ErrSignature},
+		{"other counter", request, "Echo: hello", counter + 1, signing.ErrSignature},
+		{"valid", request, "Echo: hello", counter, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Verify(tt.request, []byte(tt.payload), tt.counter, sig)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyOutOfOrder(t *testing.T) {
+	s, v := newPair(t)
+
+	// The counter is shared with the calls of other clients, so the responses
+	// of one client can be far apart and complete in any order
+	type signed struct {
+		request []byte
+		counter uint64
+		sig     []byte
+	}
+	var responses []signed
+	for i := 0; i < 200; i++ {
+		request := signing.HashRequest([]byte("hello"), []byte{byte(i)})
+		counter, sig, err := s.Sign(request, nil)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		responses = append(responses, signed{request, counter, sig})
+	}
+	for _, i := range []int{199, 0, 100, 1} {
+		r := responses[i]
+		if err := v.Verify(r.request, nil, r.counter, r.sig); err != nil {
+			t.Fatalf("Verify(%d): %v", i, err)
+		}
+	}
+}
+
+func TestNewVerifierRequiresKey(t *testing.T) {
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	doc, err := nsm.Attest(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+	if _, err := signing.NewVerifier(doc, attestation.VerifyOptions{Roots: nsm.CA.Roots()}); err == nil {
+		t.Fatal("NewVerifier accepted a document without a signing key")
+	}
+}
+
+func TestMarshalKey(t *testing.T) {
+	key, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, err := signing.MarshalKey(key)
+	if err != nil {
+		t.Fatalf("MarshalKey: %v", err)
+	}
+	parsed, err := signing.ParseKey(der)
+	if err != nil {
+		t.Fatalf("ParseKey: %v", err)
+	}
+	if !parsed.Equal(key) {
+		t.Fatal("parsed key differs from the original")
+	}
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// OpenFileExporter returns an exporter writing every span as a line of JSON,
+// in the format of the stdout exporter of the SDK, to the file at path, which
+// is appended to and closed on Shutdown, or to the standard output if path is "-".
+func OpenFileExporter(path string) (sdktrace.SpanExporter, error) {
+	if path == "-" {
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileExporter{SpanExporter: exp, f: f}, nil
+}
+
+type fileExporter struct {
+	sdktrace.SpanExporter
+	f *os.File
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.f.Close())
+}
+
+// NewOTLPExporter returns an exporter sending spans with OTLP over HTTP, in
+// protobuf encoding, to the endpoint, such as http://collector:4318; the
+// /v1/traces path is added if missing. If client is not nil, the requests are
+// sent with it, for example through the vsock proxy of the parent instance;
+// otherwise the exporter of the SDK connects to the endpoint directly.
+func NewOTLPExporter(ctx context.Context, endpoint string, client *http.Client) (sdktrace.SpanExporter, error) {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	if client == nil {
+		return otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(url))
+	}
+	// The exporter of the SDK cannot be given an HTTP client before v1.36,
+	// which requires Go 1.23, so the tunneled requests are sent by an
+	// otlptrace.Client of our own.
+	return otlptrace.New(ctx, &httpClient{url: url, client: client})
+}
+
+// httpClient uploads the spans converted by otlptrace with an http.Client.
+type httpClient struct {
+	url    string
+	client *http.Client
+}
+
+func (c *httpClient) Start(context.Context) error { return nil }
+
+func (c *httpClient) Stop(context.Context) error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func (c *httpClient) UploadTraces(ctx context.Context, spans []*tracepb.ResourceSpans) error {
+	body, err := proto.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("tracing: failed to export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("tracing: failed to export spans: %s", resp.Status)
+	}
+	return nil
+}
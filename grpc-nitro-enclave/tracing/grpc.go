@@ -0,0 +1,27 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/stats"
+)
+
+// The trace context of a call travels in the traceparent entry of the gRPC
+// request metadata. The metadata travels inside the attested TLS connection,
+// so it crosses the TCP and vsock proxies on the parent instance unchanged.
+var propagator = propagation.TraceContext{}
+
+// ClientHandler returns a gRPC stats handler, to be set with
+// grpc.WithStatsHandler, that traces the calls of a client with tp and
+// propagates the trace to the server.
+func ClientHandler(tp trace.TracerProvider) stats.Handler {
+	return otelgrpc.NewClientHandler(otelgrpc.WithTracerProvider(tp), otelgrpc.WithPropagators(propagator))
+}
+
+// ServerHandler returns a gRPC stats handler, to be set with grpc.StatsHandler,
+// that traces the calls handled by a server with tp, as children of the client
+// span propagated in the metadata, if any.
+func ServerHandler(tp trace.TracerProvider) stats.Handler {
+	return otelgrpc.NewServerHandler(otelgrpc.WithTracerProvider(tp), otelgrpc.WithPropagators(propagator))
+}
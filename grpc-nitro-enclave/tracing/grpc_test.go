@@ -0,0 +1,139 @@
+package tracing_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attestation"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/attester/attestertest"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/echoclient"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/metrics"
+	pb "github.com/prof-project/nitro-example/grpc-nitro-enclave/proto"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/service"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/signing"
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/tracing"
+)
+
+// traced serves EchoService with a traced server and returns a client
+// propagating the trace context, each recording its spans with its own
+// provider like two processes. If the client is untraced, its calls carry no
+// trace context. The server spans are complete once stop returns.
+func traced(t *testing.T, untraced bool) (c *echoclient.Client, clientTP *sdktrace.TracerProvider, clientSpans, serverSpans *tracetest.SpanRecorder, stop func()) {
+	t.Helper()
+	nsm, err := attestertest.NewNSM()
+	if err != nil {
+		t.Fatalf("NewNSM: %v", err)
+	}
+	key, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+
+	serverTP, serverSpans := newRecorder()
+	clientTP, clientSpans = newRecorder()
+
+	// The metrics attester passes the context of the call on to the NSM.
+	att := metrics.NewServer(prometheus.NewRegistry()).Attester(nsm)
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.StatsHandler(tracing.ServerHandler(serverTP)))
+	pb.RegisterEchoServiceServer(s, service.NewEcho(att, signer))
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	if !untraced {
+		dialOpts = append(dialOpts, grpc.WithStatsHandler(tracing.ClientHandler(clientTP)))
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet", dialOpts...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	stop = func() {
+		conn.Close()
+		s.GracefulStop()
+	}
+	c = echoclient.New(conn, attestation.VerifyOptions{Roots: nsm.CA.Roots()})
+	return c, clientTP, clientSpans, serverSpans, stop
+}
+
+func TestUnaryPropagation(t *testing.T) {
+	c, tp, clientSpans, serverSpans, stop := traced(t, false)
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "client")
+	if _, err := c.EchoAttested(ctx, "hi"); err != nil {
+		t.Fatalf("EchoAttested: %v", err)
+	}
+	root.End()
+	stop()
+
+	const method = "echo.EchoService/Echo"
+	client, server := byName(t, clientSpans), byName(t, serverSpans)
+	checkChild(t, client[method], client["client"])
+	checkChild(t, server[method], client[method])
+	checkChild(t, server["nsm.attest"], server[method])
+	checkChild(t, client["attestation.verify"], client["client"])
+	checkChild(t, client["attestation.chain"], client["attestation.verify"])
+	checkChild(t, client["attestation.cose_verify"], client["attestation.verify"])
+	if client[method].SpanKind() != trace.SpanKindClient || server[method].SpanKind() != trace.SpanKindServer {
+		t.Errorf("RPC span kinds are %v and %v, want client and server", client[method].SpanKind(), server[method].SpanKind())
+	}
+	if client["attestation.load_roots"] != nil {
+		t.Error("roots traced as loaded although set in the options")
+	}
+}
+
+func TestStreamPropagation(t *testing.T) {
+	c, tp, clientSpans, serverSpans, stop := traced(t, false)
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "client")
+	if err := c.EchoServerStream(ctx, "hi", 3, func(string) error { return nil }); err != nil {
+		t.Fatalf("EchoServerStream: %v", err)
+	}
+	root.End()
+	stop()
+
+	const method = "echo.EchoService/EchoServerStream"
+	client, server := byName(t, clientSpans), byName(t, serverSpans)
+	checkChild(t, client[method], client["client"])
+	checkChild(t, server[method], client[method])
+	checkChild(t, server["nsm.attest"], server[method])
+	checkChild(t, client["attestation.verify"], client[method])
+}
+
+func TestUntracedCall(t *testing.T) {
+	c, _, clientSpans, serverSpans, stop := traced(t, true)
+
+	if _, err := c.EchoAttested(context.Background(), "hi"); err != nil {
+		t.Fatalf("EchoAttested: %v", err)
+	}
+	stop()
+
+	// Without a client span, the server starts a new trace.
+	if spans := byName(t, clientSpans); len(spans) != 0 {
+		t.Errorf("client recorded %d spans, want none", len(spans))
+	}
+	server := byName(t, serverSpans)
+	checkChild(t, server["nsm.attest"], server["echo.EchoService/Echo"])
+	if server["echo.EchoService/Echo"].Parent().IsValid() {
+		t.Error("server span of an untraced call has a parent")
+	}
+}
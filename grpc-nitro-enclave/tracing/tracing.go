@@ -0,0 +1,52 @@
+// Package tracing sets up the OpenTelemetry tracing of the client and the
+// server, on top of the OpenTelemetry Go SDK.
+//
+// Programs create a TracerProvider with NewProvider and start their root spans
+// with its tracers. Libraries start child spans with Start, which records a
+// span only if the context already carries a recording one, so that untraced
+// callers pay nothing. The trace context crosses process boundaries in the W3C
+// traceparent format, carried in gRPC metadata by the stats handlers of this
+// package.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the spans started with Start.
+const ScopeName = "github.com/prof-project/nitro-example/grpc-nitro-enclave"
+
+// NewProvider returns a TracerProvider exporting the spans of service in
+// batches with exp. It must be shut down to export the last spans.
+func NewProvider(service string, exp sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	)
+}
+
+// Start starts a child of the span carried by ctx, with the TracerProvider of
+// that span, and returns a context carrying the child. If ctx carries no
+// recording span, it returns ctx and a span that records nothing.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.IsRecording() {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return parent.TracerProvider().Tracer(ScopeName).Start(ctx, name, opts...)
+}
+
+// RecordError marks span as failed with err, if err is not nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,203 @@
+package tracing_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/prof-project/nitro-example/grpc-nitro-enclave/tracing"
+)
+
+// newRecorder returns a provider keeping the ended spans in the returned recorder.
+func newRecorder() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	rec := tracetest.NewSpanRecorder()
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)), rec
+}
+
+// byName returns the ended spans of rec by name, failing if a name is repeated.
+func byName(t *testing.T, rec *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+	t.Helper()
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		if spans[s.Name()] != nil {
+			t.Fatalf("span %q ended twice", s.Name())
+		}
+		spans[s.Name()] = s
+	}
+	return spans
+}
+
+// checkChild checks that child is a child of parent in the same trace.
+func checkChild(t *testing.T, child, parent sdktrace.ReadOnlySpan) {
+	t.Helper()
+	if child == nil || parent == nil {
+		t.Fatalf("missing span: child %v, parent %v", child, parent)
+	}
+	if child.SpanContext().TraceID() != parent.SpanContext().TraceID() || child.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("span %q is not a child of span %q", child.Name(), parent.Name())
+	}
+}
+
+func TestStart(t *testing.T) {
+	tp, rec := newRecorder()
+
+	ctx, span := tracing.Start(context.Background(), "orphan")
+	if span.IsRecording() || trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		t.Error("Start without a span in the context recorded a span")
+	}
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	_, child := tracing.Start(ctx, "child", trace.WithAttributes(attribute.Int("size", 3)))
+	tracing.RecordError(child, errors.New("boom"))
+	tracing.RecordError(child, nil)
+	child.End()
+	root.End()
+
+	spans := byName(t, rec)
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	c := spans["child"]
+	checkChild(t, c, spans["root"])
+	if c.Status().Code != codes.Error || c.Status().Description != "boom" {
+		t.Errorf("child span status = %+v, want error boom", c.Status())
+	}
+	if attrs := c.Attributes(); len(attrs) != 1 || attrs[0] != attribute.Int("size", 3) {
+		t.Errorf("child span attributes = %v", attrs)
+	}
+	if c.InstrumentationScope().Name != tracing.ScopeName {
+		t.Errorf("child span scope = %q, want %q", c.InstrumentationScope().Name, tracing.ScopeName)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+
+	// Every run appends to the file
+	for run := 0; run < 2; run++ {
+		exp, err := tracing.OpenFileExporter(path)
+		if err != nil {
+			t.Fatalf("OpenFileExporter: %v", err)
+		}
+		tp := tracing.NewProvider("enclave-test", exp)
+		ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+		_, child := tracing.Start(ctx, "child")
+		child.End()
+		root.End()
+		if err := tp.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	var names []string
+	for s := bufio.NewScanner(f); s.Scan(); {
+		var span struct {
+			Name     string
+			Resource []struct {
+				Key   string
+				Value struct{ Value any }
+			}
+		}
+		if err := json.Unmarshal(s.Bytes(), &span); err != nil {
+			t.Fatalf("invalid span %s: %v", s.Bytes(), err)
+		}
+		if r := span.Resource; len(r) != 1 || r[0].Key != "service.name" || r[0].Value.Value != "enclave-test" {
+			t.Errorf("span resource = %+v, want service.name enclave-test", r)
+		}
+		names = append(names, span.Name)
+	}
+	if len(names) != 4 || names[0] != "child" || names[1] != "root" {
+		t.Errorf("file holds spans %q, want child and root twice", names)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		reqs []*coltracepb.ExportTraceServiceRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		reqs = append(reqs, req)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name   string
+		client *http.Client
+	}{
+		{"direct", nil},
+		{"client", srv.Client()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			reqs = nil
+			mu.Unlock()
+
+			exp, err := tracing.NewOTLPExporter(context.Background(), srv.URL, tt.client)
+			if err != nil {
+				t.Fatalf("NewOTLPExporter: %v", err)
+			}
+			tp := tracing.NewProvider("enclave-test", exp)
+			_, span := tp.Tracer("test").Start(context.Background(), "root")
+			span.End()
+			if err := tp.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(reqs) != 1 || len(reqs[0].ResourceSpans) != 1 {
+				t.Fatalf("collector received %v", reqs)
+			}
+			rs := reqs[0].ResourceSpans[0]
+			if attrs := rs.Resource.Attributes; len(attrs) != 1 || attrs[0].Key != "service.name" || attrs[0].Value.GetStringValue() != "enclave-test" {
+				t.Errorf("resource attributes = %v, want service.name enclave-test", attrs)
+			}
+			if ss := rs.ScopeSpans; len(ss) != 1 || len(ss[0].Spans) != 1 || ss[0].Spans[0].Name != "root" {
+				t.Errorf("collector received spans %v, want root", ss)
+			}
+		})
+	}
+
+	failing, err := tracing.NewOTLPExporter(context.Background(), srv.URL+"/other", srv.Client())
+	if err != nil {
+		t.Fatalf("NewOTLPExporter: %v", err)
+	}
+	spans := tracetest.SpanStubs{{Name: "root"}}.Snapshots()
+	if err := failing.ExportSpans(context.Background(), spans); err == nil {
+		t.Error("ExportSpans to a failing collector succeeded")
+	}
+}
@@ -0,0 +1,76 @@
+// Package transport creates the listener of the enclave server, so that the
+// same binary can serve over vsock inside an enclave and over TCP or a unix
+// socket on a developer machine or in CI. Dial connects to services on the
+// other side, such as a key release service on the parent instance.
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mdlayher/vsock"
+)
+
+// Transports accepted by Listen.
+const (
+	VSock = "vsock"
+	TCP   = "tcp"
+	Unix  = "unix"
+)
+
+// Listen listens on address using the given transport. For vsock, address is
+// the port number; for tcp, a host:port pair; for unix, a socket path, which is
+// removed first if a stale socket exists.
+func Listen(transport, address string) (net.Listener, error) {
+	switch transport {
+	case VSock:
+		port, err := strconv.ParseUint(address, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vsock port %q: %w", address, err)
+		}
+		return vsock.Listen(uint32(port), &vsock.Config{})
+	case TCP:
+		return net.Listen("tcp", address)
+	case Unix:
+		if fi, err := os.Stat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(address)
+		}
+		return net.Listen("unix", address)
+	default:
+		return nil, fmt.Errorf("unknown transport %q, expected %q, %q or %q", transport, VSock, TCP, Unix)
+	}
+}
+
+// ParentCID is the vsock context ID of the parent instance, as seen from an enclave.
+const ParentCID = 3
+
+// Dial connects to address using the given transport. For vsock, address is
+// "cid:port", or just the port number to reach the parent instance; for tcp, a
+// host:port pair; for unix, a socket path.
+func Dial(ctx context.Context, transport, address string) (net.Conn, error) {
+	switch transport {
+	case VSock:
+		cid, port := uint64(ParentCID), address
+		if c, p, ok := strings.Cut(address, ":"); ok {
+			var err error
+			if cid, err = strconv.ParseUint(c, 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid vsock context ID %q: %w", c, err)
+			}
+			port = p
+		}
+		p, err := strconv.ParseUint(port, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vsock port %q: %w", port, err)
+		}
+		return vsock.Dial(uint32(cid), uint32(p), &vsock.Config{})
+	case TCP, Unix:
+		var d net.Dialer
+		return d.DialContext(ctx, transport, address)
+	default:
+		return nil, fmt.Errorf("unknown transport %q, expected %q, %q or %q", transport, VSock, TCP, Unix)
+	}
+}